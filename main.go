@@ -42,23 +42,67 @@ func main() {
 	// Create our HTTP Client with a http a cache transport.
 	c, err := evecache.New(storagePath)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println("error opening the http cache, caching in memory only: ", err)
+		c = evecache.NewMemoryOnly(evecache.DefaultOptions)
 	}
 	defer func() {
+		if h := c.Health(); h != evecache.Healthy {
+			fmt.Println("Warning: the http cache ran", h)
+		}
 		err := c.Close()
 		if err != nil {
 			fmt.Println("Error while trying to close evecache:", err)
 		}
 	}()
 	tp := httpcache.NewTransport(c)
-	client := &http.Client{Transport: tp}
+	// Requests that miss the cache go through the governor, which keeps us inside ESI's error budget.
+	governor := evesdk.NewGovernor(http.DefaultTransport, evesdk.DefaultGovernorOptions)
+	tp.Transport = governor
+	// Authenticated requests skip the cache, character data isn't kept on disk.
+	var transport http.RoundTripper = evecache.NewPublicOnly(tp)
+
+	// EVELAND_OFFLINE=1 serves everything from the cache, however old, and fails requests that aren't cached.
+	if os.Getenv("EVELAND_OFFLINE") != "" {
+		offline := evecache.NewOffline(tp)
+		defer func() {
+			fmt.Println("Offline:", offline.Stats())
+		}()
+		fmt.Println("Offline mode, serving ESI responses from the cache only")
+		transport = offline
+	}
+
+	// EVELAND_HTTP_RECORD=file captures every ESI exchange to a fixture file, EVELAND_HTTP_REPLAY=file serves
+	// them back without the cache or the network and fails any request that wasn't recorded.
+	if path := os.Getenv("EVELAND_HTTP_REPLAY"); path != "" {
+		replayer, err := evecache.NewReplayer(path)
+		if err != nil {
+			fmt.Println("error: ", err)
+			return
+		}
+		fmt.Println("Replaying ESI responses from", path)
+		transport = replayer
+	} else if path := os.Getenv("EVELAND_HTTP_RECORD"); path != "" {
+		recorder, err := evecache.NewRecorder(transport, path)
+		if err != nil {
+			fmt.Println("error: ", err)
+			return
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				fmt.Println("Error while trying to close fixture file:", err)
+			}
+		}()
+		fmt.Println("Recording ESI responses to", path)
+		transport = recorder
+	}
+	client := &http.Client{Transport: transport}
 
 	// Get our ESI (EVE API) API Client with our custom caching transport.
 	eveClient := goesi.NewAPIClient(client, "early testing, contact esniff@gmail.com")
-	eveSDK := evesdk.New(eveClient)
+	eveSDK := evesdk.New(eveClient, governor)
 
 	// Initialize our CLI.
-	cmd.Register(rootCmd, eveSDK, storagePath)
+	cmd.Register(rootCmd, eveSDK, c, storagePath)
 
 	// Execute our CLI.
 	Execute()
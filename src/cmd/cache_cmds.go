@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/epsniff/eveland/src/evecache"
+	"github.com/spf13/cobra"
+)
+
+func addCacheCommands(rootCmd *cobra.Command, cache *evecache.EveCache) {
+	var prefix = ""
+	var olderThan time.Duration
+	var key = ""
+	var out = ""
+	var bodyOnly = false
+
+	var CacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "cache",
+		Long: `
+	inspects and maintains the http cache in evecache_peb_db. Cache keys are the request URLs.
+	`,
+	}
+
+	// eveland cache stats
+	var CacheStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "stats",
+		Run: func(cmd *cobra.Command, args []string) {
+			if cache == nil {
+				fmt.Println("error: the http cache isn't open")
+				return
+			}
+			stats, err := cache.Stats()
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Health: %s, %d storage errors\n", stats.Health, stats.StorageErrors)
+			fmt.Printf("Entries: %d (%s, %s on disk, compression ratio %.1fx)\n",
+				stats.Entries, byteSize(stats.Bytes), byteSize(stats.StoredBytes), stats.CompressionRatio())
+			fmt.Printf("In memory: %d (%s)\n", stats.MemoryEntries, byteSize(stats.MemoryBytes))
+			fmt.Printf("Hits: %d from memory, %d from disk, %d misses, hit ratio %.1f%% since start\n",
+				stats.MemoryHits, stats.DiskHits, stats.Misses, stats.HitRatio()*100)
+			if stats.Entries > 0 {
+				fmt.Printf("Oldest: %s (%v ago)\n", stats.Oldest.Format(time.RFC3339), time.Since(stats.Oldest).Round(time.Second))
+				fmt.Printf("Newest: %s (%v ago)\n", stats.Newest.Format(time.RFC3339), time.Since(stats.Newest).Round(time.Second))
+			}
+		},
+	}
+
+	// eveland cache ls
+	var CacheLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "ls",
+		Long: `
+	lists cached responses, optionally only those whose URL starts with a prefix.
+	  go run main.go cache ls -p=https://esi.evetech.net/v1/markets/10000002/
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if cache == nil {
+				fmt.Println("error: the http cache isn't open")
+				return
+			}
+			now := time.Now()
+			err := cache.Entries(prefix, func(e evecache.Entry) error {
+				expires := "expired"
+				if e.Expires.After(now) {
+					expires = "expires in " + e.Expires.Sub(now).Round(time.Second).String()
+				}
+				fmt.Printf("%d\t%s\t%v old\t%s\t%s\n", e.Status, byteSize(int64(e.Size)), now.Sub(e.Date).Round(time.Second), expires, e.Key)
+				return nil
+			})
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+		},
+	}
+	CacheLsCmd.PersistentFlags().
+		StringVarP(&prefix, "prefix", "p", "", "only list URLs starting with this prefix. default is every entry.")
+
+	// eveland cache purge
+	var CachePurgeCmd = &cobra.Command{
+		Use:   "purge",
+		Short: "purge",
+		Long: `
+	removes cached responses by URL prefix, age, or both.
+	  go run main.go cache purge -p=https://esi.evetech.net/v1/markets/
+	  go run main.go cache purge --older-than=72h
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if cache == nil {
+				fmt.Println("error: the http cache isn't open")
+				return
+			}
+			if prefix == "" && olderThan <= 0 {
+				fmt.Println("error: pass --prefix, --older-than or both, to purge everything use --prefix=https://")
+				return
+			}
+			n, err := cache.Purge(prefix, olderThan)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Purged %d cache entries\n", n)
+		},
+	}
+	CachePurgeCmd.PersistentFlags().
+		StringVarP(&prefix, "prefix", "p", "", "only purge URLs starting with this prefix.")
+	CachePurgeCmd.PersistentFlags().
+		DurationVar(&olderThan, "older-than", 0, "only purge responses older than this, e.g. 24h.")
+
+	// eveland cache export
+	var CacheExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "export",
+		Long: `
+	writes one cached response out, as the raw http response or just its body.
+	  go run main.go cache export -k=https://esi.evetech.net/v1/universe/regions/ --body
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if cache == nil {
+				fmt.Println("error: the http cache isn't open")
+				return
+			}
+			if key == "" {
+				fmt.Println("error: --key is required")
+				return
+			}
+			raw, err := cache.Raw(key)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			if bodyOnly {
+				resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+				if err != nil {
+					fmt.Println("error parsing cached response: ", err)
+					return
+				}
+				raw, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					fmt.Println("error reading cached body: ", err)
+					return
+				}
+			}
+			if out == "" {
+				os.Stdout.Write(raw)
+				return
+			}
+			if err := os.WriteFile(out, raw, 0644); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Exported %s to %s\n", byteSize(int64(len(raw))), out)
+		},
+	}
+	CacheExportCmd.PersistentFlags().
+		StringVarP(&key, "key", "k", "", "the cache key, the request URL, to export.")
+	CacheExportCmd.PersistentFlags().
+		StringVarP(&out, "out", "o", "", "file to write to. default is stdout.")
+	CacheExportCmd.PersistentFlags().
+		BoolVar(&bodyOnly, "body", false, "write only the response body. default is the raw http response.")
+
+	CacheCmd.AddCommand(CacheStatsCmd, CacheLsCmd, CachePurgeCmd, CacheExportCmd)
+	rootCmd.AddCommand(CacheCmd)
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdedb"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/evesso"
+	"github.com/epsniff/eveland/src/ledger"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// run executes one eveland command line against the fake ESI.
+func run(t *testing.T, eveSDK *evesdk.EveLand, dbpath string, args ...string) {
+	t.Helper()
+	root := &cobra.Command{Use: "eve"}
+	Register(root, eveSDK, nil, dbpath)
+	root.SetArgs(args)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCommands(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 2
+
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	// Not a core trade region, loadmarketorders skips it.
+	esi.AddRegion(&evesdk.Region{RegionID: 10000001, Name: "Derelik Prime"})
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium", Volume: 0.01})
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite", Volume: 0.01})
+	esi.AddOrders(forge.RegionID,
+		&evesdk.MarketOrder{OrderID: 1, TypeID: 34, SystemID: 30000142, LocationID: 60003760, Price: 5, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now().UTC(), Duration: 90, Range_: "region"},
+		&evesdk.MarketOrder{OrderID: 2, TypeID: 34, SystemID: 30000142, LocationID: 60003760, Price: 4, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now().UTC(), Duration: 90, Range_: "station", IsBuyOrder: true},
+		&evesdk.MarketOrder{OrderID: 3, TypeID: 35, SystemID: 30000144, LocationID: 60003761, Price: 9, VolumeRemain: 10, VolumeTotal: 10, Issued: time.Now().UTC(), Duration: 90, Range_: "region"},
+	)
+
+	eveSDK := esi.EveLand()
+	dbpath := t.TempDir()
+
+	run(t, eveSDK, dbpath, "loadmarketorders", "--backend=sqlite")
+
+	dbm, err := dbmarketorders.Open(dbmarketorders.BackendSQLite, eveSDK, dbpath, dbmarketorders.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbm.Close()
+	assert.Equal(t, uint64(1), dbm.Generation())
+	orders, err := dbm.Query(context.Background(), dbmarketorders.Query{SystemIDs: []int32{30000142}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(orders))
+	assert.Equal(t, 0, esi.Requests("/v1/markets/10000001/orders/"))
+
+	run(t, eveSDK, dbpath, "loaditems")
+
+	dbi, err := dbitems.New(eveSDK, dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := dbi.GetItem(context.Background(), 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Pyerite", td.Name)
+	dbi.Close()
+
+	// A failed export leaves nothing at --out, a finished one replaces it whole. Names the empty SDE doesn't
+	// have are left blank.
+	if err := os.WriteFile(filepath.Join(dbpath, evesdedb.DBNAME), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	out := filepath.Join(outDir, "orders.csv")
+	run(t, eveSDK, dbpath, "export", "orders", "--backend=sqlite", "--format=xml", "--out="+out)
+	files, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, files)
+	run(t, eveSDK, dbpath, "export", "orders", "--backend=sqlite", "--out="+out)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(data), "Pyerite")
+	files, err = os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, files, 1)
+}
+
+// login logs a character in to the token store under dbpath through the fake SSO.
+func login(t *testing.T, sso *esitest.SSO, dbpath string, characterID int32, name string) {
+	t.Helper()
+	// Keep the token store's key out of the real config directory.
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dbpath, "config"))
+	store, err := evesso.OpenTokenStore(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sso.LoginAs(characterID, name)
+	_, err = evesso.New(sso.Config(), store).Login(context.Background(), func(authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadStructureMarkets(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	esi.UseSSO(sso)
+
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	esi.AddOrders(forge.RegionID,
+		&evesdk.MarketOrder{OrderID: 1, TypeID: 34, SystemID: 30000142, LocationID: 60003760, Price: 5, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now().UTC(), Duration: 90, Range_: "region"},
+	)
+	esi.AddStructure(&evesdk.Structure{StructureID: 1028858195912, Name: "Perimeter - Tranquility Trading Tower", SolarSystemID: 30000144})
+	esi.AddStructureOrders(1028858195912,
+		&evesdk.MarketOrder{OrderID: 2, TypeID: 34, Price: 4.9, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now().UTC(), Duration: 90, Range_: "station"},
+	)
+
+	eveSDK := esi.EveLand()
+	dbpath := t.TempDir()
+	login(t, sso, dbpath, 90000001, "Jita Trader")
+
+	run(t, eveSDK, dbpath, "loadmarketorders", "--backend=sqlite", "--structure=1028858195912")
+
+	dbm, err := dbmarketorders.Open(dbmarketorders.BackendSQLite, eveSDK, dbpath, dbmarketorders.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbm.Close()
+	orders, err := dbm.Query(context.Background(), dbmarketorders.Query{TypeIDs: []int32{34}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 2, len(orders)) {
+		for _, o := range orders {
+			assert.Equal(t, o.OrderID == 2, o.IsStructureOrder)
+			if o.IsStructureOrder {
+				assert.Equal(t, int32(30000144), o.SystemID)
+				assert.Equal(t, int64(1028858195912), o.LocationID)
+			}
+		}
+	}
+
+	// The structure order undercuts the character's order there.
+	esi.AddCharacterOrders(90000001, &evesdk.CharacterOrder{OrderID: 3, TypeID: 34, LocationID: 1028858195912, Price: 5, VolumeRemain: 10, VolumeTotal: 10})
+	run(t, eveSDK, dbpath, "my-orders", "--backend=sqlite")
+	assert.Equal(t, 1, esi.Requests("/v2/characters/90000001/orders/"))
+}
+
+func TestLedgerImport(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	esi.UseSSO(sso)
+	day := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	esi.AddWalletTransactions(90000001,
+		&evesdk.WalletTransaction{TransactionID: 1, Date: day, TypeID: 34, LocationID: 60003760, Quantity: 10, UnitPrice: 5, IsBuy: true},
+		&evesdk.WalletTransaction{TransactionID: 2, Date: day.AddDate(0, 0, 1), TypeID: 34, LocationID: 60003760, Quantity: 10, UnitPrice: 6},
+	)
+
+	eveSDK := esi.EveLand()
+	dbpath := t.TempDir()
+	login(t, sso, dbpath, 90000001, "Jita Trader")
+
+	run(t, eveSDK, dbpath, "ledger", "import")
+	// An older purchase from before ESI's 30 days, filed under the logged in character without -c.
+	csvFile := filepath.Join(t.TempDir(), "trades.csv")
+	err := os.WriteFile(csvFile, []byte("date,type_id,quantity,unit_price,is_buy\n2023-02-01,34,10,4,buy\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, eveSDK, dbpath, "ledger", "import", "-f="+csvFile)
+	esi.AddWalletTransactions(90000001, &evesdk.WalletTransaction{TransactionID: 3, Date: day.AddDate(0, 0, 2), TypeID: 34, LocationID: 60003760, Quantity: 1, UnitPrice: 5, IsBuy: true})
+	run(t, eveSDK, dbpath, "ledger", "import")
+	run(t, eveSDK, dbpath, "ledger", "report", "--by=month")
+
+	l, err := ledger.New(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	txs, err := l.Transactions(context.Background(), 90000001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, txs, 4)
+	res := ledger.Match(txs, ledger.Fees{})
+	if assert.Len(t, res.Trades, 1) {
+		assert.Equal(t, 20.0, res.Trades[0].Profit(), "the sale is matched against the older purchase from the file")
+	}
+	assert.Empty(t, res.Unmatched)
+}
+
+func TestNetworth(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 1
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	esi.UseSSO(sso)
+
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	esi.AddOrders(forge.RegionID,
+		&evesdk.MarketOrder{OrderID: 1, TypeID: 34, SystemID: 30000142, LocationID: 60003760, Price: 5, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now().UTC(), Duration: 90, Range_: "region", IsBuyOrder: true},
+	)
+	esi.AddAssets(90000001,
+		&evesdk.Asset{ItemID: 1, TypeID: 34, LocationID: 60003760, LocationType: "station", Quantity: 1000},
+		&evesdk.Asset{ItemID: 2, TypeID: 35, LocationID: 60003760, LocationType: "station", Quantity: 10},
+	)
+
+	eveSDK := esi.EveLand()
+	dbpath := t.TempDir()
+	login(t, sso, dbpath, 90000001, "Jita Trader")
+
+	run(t, eveSDK, dbpath, "loadmarketorders", "--backend=sqlite")
+	run(t, eveSDK, dbpath, "networth", "--backend=sqlite", "--hub=Jita")
+	assert.Equal(t, 2, esi.Requests("/v5/characters/90000001/assets/"), "every page of assets")
+}
+
+func TestLoadItemsFromSDE(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium from ESI"})
+	// Newer than the SDE dump.
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite", Volume: 0.01})
+
+	dbpath := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dbpath, evesdedb.DBNAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE invTypes (typeID INTEGER PRIMARY KEY, groupID INTEGER, typeName VARCHAR(100),
+		description TEXT, mass FLOAT, volume FLOAT, capacity FLOAT, portionSize INTEGER, published BOOLEAN,
+		marketGroupID INTEGER, iconID INTEGER, graphicID INTEGER);
+	INSERT INTO invTypes VALUES (34, 18, 'Tritanium', NULL, 0, 0.01, 0, 1, 1, 1857, NULL, NULL);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eveSDK := esi.EveLand()
+	run(t, eveSDK, dbpath, "loaditems", "--source=sde", "--enrich")
+	assert.Equal(t, 0, esi.Requests("/v3/universe/types/34/"), "the SDE already had it")
+	assert.Equal(t, 1, esi.Requests("/v3/universe/types/35/"))
+
+	dbi, err := dbitems.New(eveSDK, dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbi.Close()
+	td, err := dbi.GetItem(context.Background(), 34)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Tritanium", td.Name)
+	assert.Equal(t, int32(1857), td.MarketGroupId)
+	td, err = dbi.GetItem(context.Background(), 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Pyerite", td.Name)
+}
+
+func TestFindItem(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium", Volume: 0.01, Published: true})
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite", Volume: 0.01, Published: true})
+	esi.AddPrices(&evesdk.MarketPrice{TypeID: 34, AveragePrice: 4.5, AdjustedPrice: 4.2})
+
+	dbpath := t.TempDir()
+	eveSDK := esi.EveLand()
+	run(t, eveSDK, dbpath, "loaditems")
+	run(t, eveSDK, dbpath, "find-item", "-n=tritanim")
+	run(t, eveSDK, dbpath, "loadprices")
+	run(t, eveSDK, dbpath, "price", "-t=tritanium,35")
+
+	// loaditems indexed the names.
+	dbi, err := dbitems.New(eveSDK, dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbi.Close()
+	ids, err := dbi.ResolveTypes(context.Background(), []string{"pyer", "34"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int32{35, 34}, ids)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/epsniff/eveland/src/dbmarkethistory"
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/everef"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/spf13/cobra"
+)
+
+func addEveRefCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var dumpDir = ""
+	var ordersFile = ""
+	var backend = string(dbmarketorders.BackendBluge)
+	var regionIDs = []int32{}
+
+	// eveland import-everef
+	var ImportEveRefCmd = &cobra.Command{
+		Use:   "import-everef",
+		Short: "import-everef",
+		Long: `
+	imports market order and market history dumps downloaded from https://data.everef.net/ without calling ESI.
+	the newest market-orders-*.csv.bz2 in the directory replaces the order index, and every market-history-*.csv.bz2
+	is merged into the history database.
+	  go run main.go import-everef -d=_data/everef
+	  go run main.go import-everef -d=_data/everef -r=10000002 -r=10000043
+	  go run main.go import-everef -f=_data/everef/market-orders-2023-03-01_00-00-00.v3.csv.bz2
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			filter := everef.Filter{RegionIDs: regionIDs}
+
+			var historyFiles []string
+			if dumpDir != "" {
+				orderFiles, hf, err := everef.Dumps(dumpDir)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				historyFiles = hf
+				if ordersFile == "" && len(orderFiles) > 0 {
+					ordersFile = orderFiles[len(orderFiles)-1]
+				}
+			}
+			if ordersFile == "" && len(historyFiles) == 0 {
+				fmt.Println("nothing to import, pass a dump directory with -d or an order snapshot with -f")
+				return
+			}
+
+			if ordersFile != "" {
+				dbm, err := dbmarketorders.Rebuild(dbmarketorders.Backend(backend), nil, dbpath, dbmarketorders.Options{BulkLoad: true})
+				if err != nil {
+					fmt.Println("error creating db marketorders: ", err)
+					return
+				}
+				cnt, err := everef.ImportOrders(ctx, ordersFile, filter, dbm)
+				if err != nil {
+					fmt.Println("error importing market orders: ", err)
+					if err := dbm.Abort(); err != nil {
+						fmt.Println("error discarding staged market orders: ", err)
+					}
+					return
+				}
+				if err := dbm.Promote(); err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				fmt.Printf("Imported %d market orders from %s as generation %d\n", cnt, filepath.Base(ordersFile), dbm.Generation())
+			}
+
+			if len(historyFiles) > 0 {
+				dbh, err := dbmarkethistory.New(dbpath)
+				if err != nil {
+					fmt.Println("error creating db market history: ", err)
+					return
+				}
+				defer dbh.Close()
+				for _, f := range historyFiles {
+					cnt, err := everef.ImportHistory(ctx, f, filter, dbh)
+					if err != nil {
+						fmt.Println("error importing market history: ", err)
+						return
+					}
+					fmt.Printf("Imported %d market history rows from %s\n", cnt, filepath.Base(f))
+				}
+			}
+		},
+	}
+	ImportEveRefCmd.PersistentFlags().
+		StringVarP(&dumpDir, "dir", "d", "", "directory holding everef.net market-orders and market-history dumps.")
+	ImportEveRefCmd.PersistentFlags().
+		StringVarP(&ordersFile, "file", "f", "", "market order snapshot to import, defaults to the newest one in --dir.")
+	ImportEveRefCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+	ImportEveRefCmd.PersistentFlags().
+		Int32SliceVarP(&regionIDs, "region", "r", []int32{}, "only import these region ids, repeatable. default is every region.")
+
+	rootCmd.AddCommand(ImportEveRefCmd)
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdedb"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/orderexport"
+	"github.com/spf13/cobra"
+)
+
+func addExportCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var format = string(orderexport.CSV)
+	var out = ""
+	var backend = string(dbmarketorders.BackendBluge)
+	var regionNames = []string{}
+	var systemNames = []string{}
+	var types = []string{}
+	var side = "all"
+
+	var ExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "export",
+	}
+
+	// eveland export orders
+	var ExportOrdersCmd = &cobra.Command{
+		Use:   "orders",
+		Short: "orders",
+		Long: `
+	exports market orders from the order index as csv, jsonl or parquet, with type, system and station names.
+	  go run main.go export orders --format=parquet -o=forge.parquet --region="The Forge"
+	  go run main.go export orders -s=Jita -s=Perimeter -t=Tritanium --side=sell
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			evesde, err := evesdedb.New(dbpath)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			defer evesde.Close()
+
+			q := dbmarketorders.Query{}
+			switch side {
+			case "all":
+			case "buy":
+				q.OrderType = dbmarketorders.BuyOrders
+			case "sell":
+				q.OrderType = dbmarketorders.SellOrders
+			default:
+				fmt.Println("error: --side must be all, buy or sell")
+				return
+			}
+			inRegions := map[int32]bool{}
+			for _, name := range regionNames {
+				regionID, err := evesde.GetRegionID(name)
+				if err != nil {
+					fmt.Printf("error looking up region %s: %v\n", name, err)
+					return
+				}
+				systemIDs, err := evesde.SystemIDsInRegion(regionID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				for _, systemID := range systemIDs {
+					inRegions[systemID] = true
+				}
+				if len(systemNames) == 0 {
+					q.SystemIDs = append(q.SystemIDs, systemIDs...)
+				}
+			}
+			// With both, --system picks systems within --region.
+			for _, name := range systemNames {
+				systemID, err := evesde.GetSystemID(name)
+				if err != nil {
+					fmt.Printf("error looking up system %s: %v\n", name, err)
+					return
+				}
+				if len(regionNames) > 0 && !inRegions[int32(systemID)] {
+					fmt.Printf("error: system %s is not in %s\n", name, strings.Join(regionNames, " or "))
+					return
+				}
+				q.SystemIDs = append(q.SystemIDs, int32(systemID))
+			}
+
+			dbm, err := dbmarketorders.Open(dbmarketorders.Backend(backend), eveSDK, dbpath, dbmarketorders.Options{})
+			if err != nil {
+				fmt.Println("error creating db marketorders: ", err)
+				return
+			}
+			defer dbm.Close()
+
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+
+			if q.TypeIDs, err = dbi.ResolveTypes(ctx, types); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
+			// A file is written beside --out and renamed over it once complete, a failed export leaves nothing behind.
+			var w io.Writer = os.Stdout
+			var f *os.File
+			if out != "" {
+				f, err = os.CreateTemp(filepath.Dir(out), filepath.Base(out)+".tmp-*")
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer func() {
+					f.Close()
+					os.Remove(f.Name())
+				}()
+				w = f
+			}
+			ew, err := orderexport.NewWriter(orderexport.Format(format), w)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
+			// Names repeat a lot across orders, so resolve each ID once.
+			typeNames := map[int32]string{}
+			systemNamesByID := map[int32]string{}
+			stationNames := map[int64]string{}
+			// Orders are written as the store reads them, a whole region never sits in memory.
+			exported := 0
+			err = dbm.StreamQuery(ctx, q, func(order *evesdk.MarketOrder) error {
+				row := orderexport.NewRow(order)
+
+				name, ok := typeNames[order.TypeID]
+				if !ok {
+					if td, err := dbi.GetItem(ctx, order.TypeID); err == nil {
+						name = td.Name
+					}
+					typeNames[order.TypeID] = name
+				}
+				row.TypeName = name
+
+				name, ok = systemNamesByID[order.SystemID]
+				if !ok {
+					name, _ = evesde.SystemIDToName(order.SystemID)
+					systemNamesByID[order.SystemID] = name
+				}
+				row.SystemName = name
+
+				name, ok = stationNames[order.LocationID]
+				if !ok {
+					// Player structures aren't in the SDE, their name stays blank.
+					name, _ = evesde.StationIDToName(order.LocationID)
+					stationNames[order.LocationID] = name
+				}
+				row.StationName = name
+
+				if err := ew.Write(row); err != nil {
+					return fmt.Errorf("error writing order: %v", err)
+				}
+				exported++
+				return nil
+			})
+			if err != nil {
+				fmt.Println("error exporting market orders: ", err)
+				return
+			}
+			if err := ew.Close(); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			if out != "" {
+				if err := f.Chmod(0644); err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				if err := f.Close(); err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				if err := os.Rename(f.Name(), out); err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				fmt.Printf("Exported %d market orders to %s\n", exported, out)
+			}
+		},
+	}
+	ExportOrdersCmd.PersistentFlags().
+		StringVar(&format, "format", "csv", "output format, csv, jsonl or parquet. default is csv.")
+	ExportOrdersCmd.PersistentFlags().
+		StringVarP(&out, "out", "o", "", "file to write to. default is stdout.")
+	ExportOrdersCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+	ExportOrdersCmd.PersistentFlags().
+		StringSliceVarP(&regionNames, "region", "r", []string{}, "only export orders in these regions, repeatable.")
+	ExportOrdersCmd.PersistentFlags().
+		StringSliceVarP(&systemNames, "system", "s", []string{}, "only export orders in these systems, repeatable.")
+	ExportOrdersCmd.PersistentFlags().
+		StringSliceVarP(&types, "type", "t", []string{}, "only export orders for these types, ids or item names, repeatable.")
+	ExportOrdersCmd.PersistentFlags().
+		StringVar(&side, "side", "all", "which orders to export, all, buy or sell. default is all.")
+
+	ExportCmd.AddCommand(ExportOrdersCmd)
+	rootCmd.AddCommand(ExportCmd)
+}
@@ -3,32 +3,252 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/evesdedb"
 	"github.com/epsniff/eveland/src/evesdk"
 	"github.com/spf13/cobra"
 )
 
 func addItemCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var source = "esi"
+	var enrich = false
+	var maxAge = dbitems.DefaultMaxAge
+
 	// eveland loaditems
 	var LoadItemsCmd = &cobra.Command{
 		Use:   "loaditems",
 		Short: "loaditems",
+		Long: `
+	loads the item types. From ESI only new types and the ones fetched longer than --max-age ago are requested,
+	the stale ones with their ETag so unchanged types cost a 304. The first load is a request per type and takes a
+	long while, --source=sde reads them all from the SDE's invTypes in one pass instead. --enrich then fetches from
+	ESI just the types the SDE dump is missing, the ones added to the game since. Types loaded from the SDE are
+	left alone by later ESI loads, --max-age=0 revalidates them along with everything else.
+	  go run main.go loaditems
+	  go run main.go loaditems --source=sde --enrich
+	`,
 		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
 			dbi, err := dbitems.New(eveSDK, dbpath)
 			if err != nil {
 				fmt.Println("error creating db items: ", err)
 				return
 			}
-			if err := dbi.LoadItems(context.Background()); err != nil {
-				fmt.Println("error: ", err)
+			switch source {
+			case "esi":
+				report, err := dbi.LoadItems(ctx, maxAge)
+				if err != nil {
+					fmt.Println("error: ", err)
+				}
+				if report != nil {
+					fmt.Printf("Types: %s\n", report)
+				}
+			case "sde":
+				evesde, err := evesdedb.New(dbpath)
+				if err != nil {
+					fmt.Println("error: ", err)
+					break
+				}
+				_, err = dbi.LoadItemsFrom(ctx, evesde)
+				evesde.Close()
+				if err != nil {
+					fmt.Println("error: ", err)
+					break
+				}
+				if enrich {
+					n, err := dbi.LoadMissingItems(ctx)
+					if err != nil {
+						fmt.Println("error: ", err)
+						break
+					}
+					fmt.Printf("Added %d types from ESI\n", n)
+				}
+			default:
+				fmt.Printf("error: unknown source %q, use esi or sde\n", source)
 			}
 			if err := dbi.Close(); err != nil {
 				fmt.Println("error: ", err)
 				return
 			}
+			fmt.Printf("ESI %s\n", eveSDK.ESIStats())
+		},
+	}
+
+	// eveland loadgroups
+	var LoadGroupsCmd = &cobra.Command{
+		Use:   "loadgroups",
+		Short: "loadgroups",
+		Long: `
+	loads the market group tree and the item groups and categories, for market-groups and the trade filters.
+	  go run main.go loadgroups
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+			if err := dbi.LoadGroups(context.Background()); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("ESI %s\n", eveSDK.ESIStats())
 		},
 	}
 
-	rootCmd.AddCommand(LoadItemsCmd)
+	LoadItemsCmd.PersistentFlags().
+		StringVar(&source, "source", source, "where to load the types from, esi or sde. default is esi.")
+	LoadItemsCmd.PersistentFlags().
+		BoolVar(&enrich, "enrich", enrich, "with --source=sde, fetch the types missing from the sde from esi. default is false.")
+	LoadItemsCmd.PersistentFlags().
+		DurationVar(&maxAge, "max-age", maxAge, "revalidate types fetched longer ago than this, 0 revalidates them all. default is 24h.")
+
+	var marketGroupID int32
+	var categories bool
+
+	// eveland market-groups
+	var MarketGroupsCmd = &cobra.Command{
+		Use:   "market-groups",
+		Short: "market-groups",
+		Long: `
+	browses the market group tree. Without --group the top level groups are listed, with it the group's place in
+	the tree, the groups under it and its types. --categories lists the item categories and their groups instead.
+	The IDs are what best-trades' --market-group, --group and --category filters take. Run loadgroups first.
+	  go run main.go market-groups
+	  go run main.go market-groups -g=11
+	  go run main.go market-groups --categories
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+
+			if categories {
+				if err := printCategories(ctx, dbi); err != nil {
+					fmt.Println("error: ", err)
+				}
+				return
+			}
+
+			if marketGroupID != 0 {
+				path, err := dbi.MarketGroupPath(ctx, marketGroupID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				names := make([]string, 0, len(path))
+				for _, g := range path {
+					names = append(names, g.Name)
+				}
+				fmt.Printf("%d\t%s\n", marketGroupID, strings.Join(names, " > "))
+			}
+			children, err := dbi.MarketGroupChildren(ctx, marketGroupID)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			for _, g := range children {
+				fmt.Printf("  %d\t%s/\n", g.MarketGroupID, g.Name)
+			}
+			if marketGroupID != 0 {
+				g, err := dbi.GetMarketGroup(ctx, marketGroupID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				for _, typeID := range g.TypeIDs {
+					name := "(not loaded, use: loaditems)"
+					if td, err := dbi.GetItem(ctx, typeID); err == nil {
+						name = td.Name
+					}
+					fmt.Printf("  %d\t%s\n", typeID, name)
+				}
+			}
+		},
+	}
+	MarketGroupsCmd.PersistentFlags().
+		Int32VarP(&marketGroupID, "group", "g", 0, "the market group to show. default is the top level.")
+	MarketGroupsCmd.PersistentFlags().
+		BoolVar(&categories, "categories", false, "list the item categories and groups instead. default is false.")
+
+	var name string
+	var limit = dbitems.DefaultSearchLimit
+
+	// eveland find-item
+	var FindItemCmd = &cobra.Command{
+		Use:   "find-item",
+		Short: "find-item",
+		Long: `
+	finds item types by name, matching words by prefix or with a typo, and by description. Prints the type id, name,
+	group and volume of the best matches. The group names need loadgroups.
+	  go run main.go find-item -n=tritanim
+	  go run main.go find-item -n="antimatter l"
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			if name == "" {
+				fmt.Println("error: --name is required")
+				return
+			}
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+
+			types, err := dbi.Search(ctx, name, limit)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			if len(types) == 0 {
+				fmt.Printf("No items match %q\n", name)
+				return
+			}
+			for _, td := range types {
+				group := strconv.Itoa(int(td.GroupId))
+				if g, err := dbi.GetGroup(ctx, td.GroupId); err == nil {
+					group = g.Name
+				}
+				fmt.Printf("%d\t%s\t%s\t%v m3\n", td.TypeId, td.Name, group, td.Volume)
+			}
+		},
+	}
+	FindItemCmd.PersistentFlags().
+		StringVarP(&name, "name", "n", "", "the item name, or part of it, to look for.")
+	FindItemCmd.PersistentFlags().
+		IntVarP(&limit, "limit", "l", limit, "how many matches to print. default is 10.")
+
+	rootCmd.AddCommand(LoadItemsCmd, LoadGroupsCmd, MarketGroupsCmd, FindItemCmd)
+}
+
+func printCategories(ctx context.Context, dbi *dbitems.ItemDataDB) error {
+	cats, err := dbi.Categories(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range cats {
+		fmt.Printf("%d\t%s\n", c.CategoryID, c.Name)
+		groups := []string{}
+		for _, id := range c.GroupIDs {
+			if g, err := dbi.GetGroup(ctx, id); err == nil && g.Published {
+				groups = append(groups, fmt.Sprintf("%s (%d)", g.Name, g.GroupID))
+			}
+		}
+		sort.Strings(groups)
+		if len(groups) > 0 {
+			fmt.Printf("  %s\n", strings.Join(groups, ", "))
+		}
+	}
+	return nil
 }
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/evesdedb"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/ledger"
+	"github.com/spf13/cobra"
+)
+
+func addLedgerCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var characterID int32
+	var file = ""
+	var by = string(ledger.ByItem)
+	var from, to = "", ""
+	var fees = ledger.DefaultFees
+
+	var LedgerCmd = &cobra.Command{
+		Use:   "ledger",
+		Short: "ledger",
+		Long: `
+	keeps wallet transactions and reports the realized profit of trading. Sales are matched to the earliest unsold
+	purchases of the same type by the same character, then the sales tax and broker fees are taken off.
+	`,
+	}
+
+	// eveland ledger import
+	var LedgerImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "import",
+		Long: `
+	imports a character's wallet transactions from ESI, only the ones newer than the last import. ESI only keeps
+	30 days of transactions, so import at least that often. Older transactions can be imported from a CSV file
+	with a header row of date, type_id, quantity, unit_price and is_buy (true/false or buy/sell), and optionally
+	transaction_id, location_id and client_id.
+	  go run main.go ledger import -c=90000001
+	  go run main.go ledger import -c=90000001 -f=_data/trades.csv
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			l, err := ledger.New(dbpath)
+			if err != nil {
+				fmt.Println("error creating ledger: ", err)
+				return
+			}
+			defer l.Close()
+
+			var txs []*evesdk.WalletTransaction
+			if file != "" {
+				// FIFO matching is per character, so the file's rows go under the same character as its ESI imports.
+				if characterID == 0 {
+					char, err := lookupCharacter(dbpath, characterID)
+					if err != nil {
+						fmt.Println("error: ", err)
+						return
+					}
+					characterID = char.ID
+				}
+				f, err := os.Open(file)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer f.Close()
+				txs, err = ledger.ReadCSV(f)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+			} else {
+				authCtx, char, done, err := characterContext(ctx, dbpath, characterID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer done()
+				characterID = char.ID
+				last, err := l.LastTransactionID(ctx, char.ID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				txs, err = eveSDK.ListWalletTransactions(authCtx, char.ID, last)
+				if err != nil {
+					fmt.Printf("error listing wallet transactions for %s: %v\n", char.Name, err)
+					return
+				}
+			}
+
+			added, err := l.Add(ctx, characterID, txs)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Imported %d new transactions of %d\n", added, len(txs))
+		},
+	}
+	LedgerImportCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "the character whose transactions to import. default is the only logged in character.")
+	LedgerImportCmd.PersistentFlags().
+		StringVarP(&file, "file", "f", "", "import from a csv file instead. default is to fetch them from esi.")
+
+	// eveland ledger report
+	var LedgerReportCmd = &cobra.Command{
+		Use:   "report",
+		Short: "report",
+		Long: `
+	reports realized profit by item, route (where it was bought and where it was sold) or the day, week or month
+	it was sold in. --from and --to pick trades by the day they were sold, purchases before --from still count
+	as their cost.
+	  go run main.go ledger report --by=item
+	  go run main.go ledger report --by=month --from=2023-01-01 -c=90000001
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			var fromDay, toDay time.Time
+			for _, d := range []struct {
+				s   string
+				day *time.Time
+			}{{from, &fromDay}, {to, &toDay}} {
+				if d.s == "" {
+					continue
+				}
+				day, err := time.Parse("2006-01-02", d.s)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				*d.day = day
+			}
+
+			l, err := ledger.New(dbpath)
+			if err != nil {
+				fmt.Println("error creating ledger: ", err)
+				return
+			}
+			defer l.Close()
+
+			txs, err := l.Transactions(ctx, characterID)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			res := ledger.Match(txs, fees)
+
+			var trades []*ledger.Trade
+			for _, t := range res.Trades {
+				if (!fromDay.IsZero() && t.Sold.Before(fromDay)) || (!toDay.IsZero() && !t.Sold.Before(toDay.AddDate(0, 0, 1))) {
+					continue
+				}
+				trades = append(trades, t)
+			}
+			summaries, err := ledger.Summarize(trades, ledger.GroupBy(by))
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+			// Names are a nicety, without the SDE routes are listed by location ID.
+			evesde, err := evesdedb.New(dbpath)
+			if err != nil {
+				fmt.Println("warning: no station names: ", err)
+			} else {
+				defer evesde.Close()
+			}
+			itemName := func(typeID int32) string {
+				if td, err := dbi.GetItem(ctx, typeID); err == nil {
+					return td.Name
+				}
+				return strconv.Itoa(int(typeID))
+			}
+			stationName := func(locationID int64) string {
+				if evesde != nil {
+					if n, err := evesde.StationIDToName(locationID); err == nil && n != "" {
+						return n
+					}
+				}
+				return strconv.FormatInt(locationID, 10)
+			}
+
+			var total ledger.Summary
+			for _, s := range summaries {
+				var name string
+				switch ledger.GroupBy(by) {
+				case ledger.ByItem:
+					name = itemName(s.TypeID)
+				case ledger.ByRoute:
+					name = stationName(s.BuyLocationID) + " -> " + stationName(s.SellLocationID)
+				case ledger.ByMonth:
+					name = s.Period.Format("2006-01")
+				default:
+					name = s.Period.Format("2006-01-02")
+				}
+				fmt.Printf("%s: %d sold in %d trades, cost %.2f, revenue %.2f, fees %.2f, profit %.2f\n",
+					name, s.Quantity, s.Trades, s.Cost, s.Revenue, s.Fees, s.Profit)
+				total.Trades += s.Trades
+				total.Cost += s.Cost
+				total.Revenue += s.Revenue
+				total.Fees += s.Fees
+				total.Profit += s.Profit
+			}
+			fmt.Printf("Total: %d trades, cost %.2f, revenue %.2f, fees %.2f, profit %.2f\n",
+				total.Trades, total.Cost, total.Revenue, total.Fees, total.Profit)
+
+			var openValue float64
+			for _, lot := range res.Open {
+				openValue += float64(lot.Quantity) * lot.UnitPrice
+			}
+			fmt.Printf("%d lots still unsold, bought for %.2f\n", len(res.Open), openValue)
+			if len(res.Unmatched) > 0 {
+				fmt.Printf("%d sales had no recorded purchase and were left out, import older transactions with --file\n", len(res.Unmatched))
+			}
+		},
+	}
+	LedgerReportCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "only report this character's trades. default is every character.")
+	LedgerReportCmd.PersistentFlags().
+		StringVar(&by, "by", by, "group by item, route, day, week or month. default is item.")
+	LedgerReportCmd.PersistentFlags().
+		StringVar(&from, "from", "", "first day of sales to report, as 2006-01-02. default is the first trade.")
+	LedgerReportCmd.PersistentFlags().
+		StringVar(&to, "to", "", "last day of sales to report, as 2006-01-02. default is the last trade.")
+	LedgerReportCmd.PersistentFlags().
+		Float64Var(&fees.SalesTax, "sales-tax", fees.SalesTax, "sales tax on sales. default is 0.036, Accounting 5.")
+	LedgerReportCmd.PersistentFlags().
+		Float64Var(&fees.BrokerFee, "broker-fee", fees.BrokerFee, "broker fee on both sides, 0 if you trade by taking orders. default is 0.015, Broker Relations 5.")
+
+	LedgerCmd.AddCommand(LedgerImportCmd, LedgerReportCmd)
+	rootCmd.AddCommand(LedgerCmd)
+}
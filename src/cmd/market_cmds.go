@@ -11,19 +11,36 @@ import (
 )
 
 func addMarketOrdersCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var backend = string(dbmarketorders.BackendBluge)
+	var structureIDs = []int64{}
+	var characterID int32
+
 	// eveland loadmarketorders
 	var LoadMarketOrdersCmd = &cobra.Command{
 		Use:   "loadmarketorders",
 		Short: "loadmarketorders",
-		// go run main.go  loadmarketorders
+		Long: `
+	loads the market orders of the core trade regions, and of player structures given with --structure. Structure
+	markets need a character with docking access, logged in with sso login.
+	  go run main.go loadmarketorders
+	  go run main.go loadmarketorders --structure=1035466617946 --structure=1028858195912 -c=90000001
+	`,
 		Run: func(cmd *cobra.Command, args []string) {
-			dbmarketorders.RemoveDB(dbpath)
-
-			dbm, err := dbmarketorders.New(eveSDK, dbpath, true)
+			// Build into a staging generation so readers keep using the current index until we promote.
+			dbm, err := dbmarketorders.Rebuild(dbmarketorders.Backend(backend), eveSDK, dbpath, dbmarketorders.Options{BulkLoad: true})
 			if err != nil {
 				fmt.Println("error creating db marketorders: ", err)
 				return
 			}
+			promoted := false
+			defer func() {
+				if !promoted {
+					if err := dbm.Abort(); err != nil {
+						fmt.Println("error discarding staged market orders: ", err)
+					}
+				}
+			}()
+			fmt.Printf("Building market orders generation %d\n", dbm.Generation())
 
 			coreTradeRegions := map[string]struct{}{
 				"Aridia":       struct{}{},
@@ -75,7 +92,7 @@ func addMarketOrdersCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 				if _, ok := coreTradeRegions[region.Name]; !ok {
 					continue
 				}
-				cnt, err := dbm.LoadMarketOrders(context.TODO(), region)
+				cnt, err := dbm.Load(context.TODO(), region)
 				if err != nil {
 					fmt.Printf("error loading market orders for region %s: %v", region.Name, err)
 					return
@@ -83,12 +100,41 @@ func addMarketOrdersCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 				fmt.Printf("Loaded %d market orders for region %s \n", cnt, region.Name)
 			}
 
-			if err := dbm.Close(); err != nil {
+			if len(structureIDs) > 0 {
+				authCtx, char, done, err := characterContext(context.Background(), dbpath, characterID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer done()
+				for _, structureID := range structureIDs {
+					cnt, err := dbm.LoadStructure(authCtx, structureID)
+					if err != nil {
+						// Docking access comes and goes, one structure shouldn't hold back the rest of the market.
+						fmt.Printf("error loading market orders for structure %d as %s, skipping it: %v\n", structureID, char.Name, err)
+						continue
+					}
+					fmt.Printf("Loaded %d market orders for structure %d \n", cnt, structureID)
+				}
+			}
+
+			if err := dbm.Promote(); err != nil {
 				fmt.Println("error: ", err)
 				return
 			}
+			promoted = true
+			fmt.Printf("Promoted market orders generation %d\n", dbm.Generation())
+			fmt.Printf("ESI %s\n", eveSDK.ESIStats())
 		},
 	}
 
+	LoadMarketOrdersCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+
+	LoadMarketOrdersCmd.PersistentFlags().
+		Int64SliceVar(&structureIDs, "structure", structureIDs, "player structure ids whose markets to load too. default is none.")
+	LoadMarketOrdersCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "the character to read structure markets as. default is the only logged in character.")
+
 	rootCmd.AddCommand(LoadMarketOrdersCmd)
 }
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdedb"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/myorders"
+	"github.com/spf13/cobra"
+)
+
+func addMyOrdersCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var backend = string(dbmarketorders.BackendBluge)
+	var characterID int32
+	var file = ""
+
+	// eveland my-orders
+	var MyOrdersCmd = &cobra.Command{
+		Use:   "my-orders",
+		Short: "my-orders",
+		Long: `
+	checks a character's open orders against the loaded market orders, flagging the ones that have been undercut
+	or outbid and suggesting a new price. The orders come from ESI as a character logged in with sso login, or from
+	a saved /characters/{id}/orders/ response with --file. Run loadmarketorders first, with --structure for orders
+	in structures.
+	  go run main.go my-orders -c=90000001
+	  go run main.go my-orders -f=_data/my_orders.json
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			var orders []*evesdk.CharacterOrder
+			if file != "" {
+				var err error
+				orders, err = myorders.LoadFile(file)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+			} else {
+				authCtx, char, done, err := characterContext(ctx, dbpath, characterID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer done()
+				orders, err = eveSDK.ListCharacterOrders(authCtx, char.ID)
+				if err != nil {
+					fmt.Printf("error listing orders for %s: %v\n", char.Name, err)
+					return
+				}
+				fmt.Printf("%s has %d open orders\n", char.Name, len(orders))
+			}
+
+			dbm, err := dbmarketorders.Open(dbmarketorders.Backend(backend), eveSDK, dbpath, dbmarketorders.Options{})
+			if err != nil {
+				fmt.Println("error creating db marketorders: ", err)
+				return
+			}
+			defer dbm.Close()
+			fmt.Printf("Using market orders generation %d\n", dbm.Generation())
+
+			statuses, err := myorders.Check(ctx, dbm, orders)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+			// Names are a nicety, without the SDE orders are listed by location ID.
+			evesde, err := evesdedb.New(dbpath)
+			if err != nil {
+				fmt.Println("warning: no station names: ", err)
+			} else {
+				defer evesde.Close()
+			}
+
+			counts := map[myorders.State]int{}
+			for _, s := range statuses {
+				counts[s.State]++
+				o := s.Order
+				name := strconv.Itoa(int(o.TypeID))
+				if td, err := dbi.GetItem(ctx, o.TypeID); err == nil {
+					name = td.Name
+				}
+				location := strconv.FormatInt(o.LocationID, 10)
+				if evesde != nil {
+					if n, err := evesde.StationIDToName(o.LocationID); err == nil && n != "" {
+						location = n
+					}
+				}
+				side := "sell"
+				if o.IsBuyOrder {
+					side = "buy"
+				}
+
+				fmt.Printf("%-9s %-4s %s x%d @ %.2f in %s", s.State, side, name, o.VolumeRemain, o.Price, location)
+				switch s.State {
+				case myorders.Undercut, myorders.Outbid:
+					fmt.Printf(", best competitor %.2f, suggest %.2f\n", s.Competitor.Price, s.Suggested)
+				case myorders.Best:
+					fmt.Printf(", next competitor %.2f\n", s.Competitor.Price)
+				default:
+					fmt.Println()
+				}
+			}
+			fmt.Printf("%d orders: %d best, %d undercut, %d outbid, %d alone\n", len(statuses),
+				counts[myorders.Best], counts[myorders.Undercut], counts[myorders.Outbid], counts[myorders.Alone])
+			fmt.Printf("ESI %s\n", eveSDK.ESIStats())
+		},
+	}
+	MyOrdersCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+	MyOrdersCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "the character whose orders to check. default is the only logged in character.")
+	MyOrdersCmd.PersistentFlags().
+		StringVarP(&file, "file", "f", "", "read the orders from a saved esi response instead. default is to fetch them from esi.")
+
+	rootCmd.AddCommand(MyOrdersCmd)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/dbmarkethistory"
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdedb"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/networth"
+	"github.com/spf13/cobra"
+)
+
+func addNetworthCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var backend = string(dbmarketorders.BackendBluge)
+	var characterID int32
+	var file = ""
+	var hub = "jita"
+	var basis = string(networth.BestBuy)
+	var days = 30
+
+	// eveland networth
+	var NetworthCmd = &cobra.Command{
+		Use:   "networth",
+		Short: "networth",
+		Long: `
+	values a character's assets at a trade hub's prices and breaks the total down by the station or structure
+	they are in, counting what is inside ships and containers where the ship or container is. The assets come
+	from ESI as a character logged in with sso login, or from a saved /characters/{id}/assets/ response with
+	--file. Prices are the hub station's best buy or sell order, halfway between them, or the region's history
+	average. Run loadmarketorders first, or import-everef for the history.
+	  go run main.go networth -c=90000001 --hub=jita --basis=mid
+	  go run main.go networth -f=_data/assets.json --basis=history --days=7
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			h, ok := networth.Hubs[strings.ToLower(hub)]
+			if !ok {
+				fmt.Printf("error: unknown hub %q, use one of %s\n", hub, networth.HubNames())
+				return
+			}
+
+			var assets []*evesdk.Asset
+			if file != "" {
+				var err error
+				assets, err = networth.LoadFile(file)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+			} else {
+				authCtx, char, done, err := characterContext(ctx, dbpath, characterID)
+				if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				defer done()
+				assets, err = eveSDK.ListCharacterAssets(authCtx, char.ID)
+				var incomplete *evesdk.IncompleteError
+				if errors.As(err, &incomplete) {
+					// Valuing what did come back would understate the total.
+					fmt.Printf("error: not every asset page of %s could be fetched, try again: %v\n", char.Name, err)
+					return
+				} else if err != nil {
+					fmt.Printf("error listing assets for %s: %v\n", char.Name, err)
+					return
+				}
+				fmt.Printf("%s has %d asset stacks\n", char.Name, len(assets))
+			}
+
+			pricer := &networth.Pricer{Hub: h, Basis: networth.Basis(basis), Days: days}
+			if pricer.Basis == networth.HistoryAverage {
+				dbh, err := dbmarkethistory.New(dbpath)
+				if err != nil {
+					fmt.Println("error creating db market history: ", err)
+					return
+				}
+				defer dbh.Close()
+				pricer.History = dbh
+			} else {
+				dbm, err := dbmarketorders.Open(dbmarketorders.Backend(backend), eveSDK, dbpath, dbmarketorders.Options{})
+				if err != nil {
+					fmt.Println("error creating db marketorders: ", err)
+					return
+				}
+				defer dbm.Close()
+				fmt.Printf("Using market orders generation %d\n", dbm.Generation())
+				pricer.Orders = dbm
+			}
+			prices, err := pricer.Prices(ctx, networth.TypeIDs(assets))
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			v := networth.Value(assets, prices)
+
+			// Names are a nicety, without the SDE locations are listed by ID.
+			evesde, err := evesdedb.New(dbpath)
+			if err != nil {
+				fmt.Println("warning: no station names: ", err)
+			} else {
+				defer evesde.Close()
+			}
+			for _, loc := range v.Locations {
+				name := loc.LocationType + " " + strconv.FormatInt(loc.LocationID, 10)
+				if evesde != nil {
+					if n, err := evesde.StationIDToName(loc.LocationID); err == nil && n != "" {
+						name = n
+					}
+				}
+				fmt.Printf("%s: %.2f ISK in %d stacks", name, loc.Value, loc.Stacks)
+				if loc.Unpriced > 0 {
+					fmt.Printf(", %d without a price", loc.Unpriced)
+				}
+				fmt.Println()
+			}
+			fmt.Printf("Total: %.2f ISK at %s %s prices\n", v.Total, h.Name, basis)
+
+			if len(v.Unpriced) > 0 {
+				dbi, err := dbitems.New(eveSDK, dbpath)
+				if err != nil {
+					fmt.Println("error creating db items: ", err)
+					return
+				}
+				defer dbi.Close()
+				names := make([]string, 0, len(v.Unpriced))
+				for _, typeID := range v.Unpriced {
+					name := strconv.Itoa(int(typeID))
+					if td, err := dbi.GetItem(ctx, typeID); err == nil {
+						name = td.Name
+					}
+					names = append(names, name)
+				}
+				fmt.Printf("No %s price for: %s\n", basis, strings.Join(names, ", "))
+			}
+		},
+	}
+	NetworthCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+	NetworthCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "the character whose assets to value. default is the only logged in character.")
+	NetworthCmd.PersistentFlags().
+		StringVarP(&file, "file", "f", "", "read the assets from a saved esi response instead. default is to fetch them from esi.")
+	NetworthCmd.PersistentFlags().
+		StringVar(&hub, "hub", hub, "the trade hub to price at, one of "+networth.HubNames()+". default is jita.")
+	NetworthCmd.PersistentFlags().
+		StringVar(&basis, "basis", basis, "the price to value at, buy, sell, mid or history. default is buy.")
+	NetworthCmd.PersistentFlags().
+		IntVar(&days, "days", days, "days of history the history basis averages. default is 30.")
+
+	rootCmd.AddCommand(NetworthCmd)
+}
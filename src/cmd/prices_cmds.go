@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbitems"
+	"github.com/epsniff/eveland/src/dbprices"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/spf13/cobra"
+)
+
+func addPriceCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+	var types = []string{}
+
+	// eveland loadprices
+	var LoadPricesCmd = &cobra.Command{
+		Use:   "loadprices",
+		Short: "loadprices",
+		Long: `
+	loads CCP's average and adjusted price of every type from ESI's /markets/prices/. ESI refreshes them hourly.
+	  go run main.go loadprices
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dbp, err := dbprices.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db prices: ", err)
+				return
+			}
+			defer dbp.Close()
+
+			n, err := dbp.LoadPrices(context.Background())
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Loaded prices for %d types\n", n)
+			fmt.Printf("ESI %s\n", eveSDK.ESIStats())
+		},
+	}
+
+	// eveland price
+	var PriceCmd = &cobra.Command{
+		Use:   "price",
+		Short: "price",
+		Long: `
+	prints the average and adjusted prices of types, as last loaded with loadprices. Types are ids or item names.
+	  go run main.go price -t=34,35
+	  go run main.go price -t=Tritanium -t="Antimatter Charge L"
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			if len(types) == 0 {
+				fmt.Println("error: --types is required")
+				return
+			}
+
+			dbp, err := dbprices.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db prices: ", err)
+				return
+			}
+			defer dbp.Close()
+			loadedAt, err := dbp.LoadedAt()
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			if loadedAt.IsZero() {
+				fmt.Println("No prices loaded, use: loadprices")
+				return
+			}
+
+			dbi, err := dbitems.New(eveSDK, dbpath)
+			if err != nil {
+				fmt.Println("error creating db items: ", err)
+				return
+			}
+			defer dbi.Close()
+			typeIDs, err := dbi.ResolveTypes(ctx, types)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
+			for _, typeID := range typeIDs {
+				name := strconv.Itoa(int(typeID))
+				if td, err := dbi.GetItem(ctx, typeID); err == nil {
+					name = td.Name
+				}
+				price, err := dbp.GetPrice(ctx, typeID)
+				if errors.Is(err, dbprices.ErrNoPrice) {
+					fmt.Printf("%s: no price\n", name)
+					continue
+				} else if err != nil {
+					fmt.Println("error: ", err)
+					return
+				}
+				fmt.Printf("%s: average %.2f, adjusted %.2f\n", name, price.AveragePrice, price.AdjustedPrice)
+			}
+			fmt.Printf("Prices loaded %s ago\n", time.Since(loadedAt).Round(time.Minute))
+		},
+	}
+	PriceCmd.PersistentFlags().
+		StringSliceVarP(&types, "types", "t", types, "comma separated type ids or item names to price.")
+
+	rootCmd.AddCommand(LoadPricesCmd, PriceCmd)
+}
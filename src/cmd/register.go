@@ -1,17 +1,26 @@
 package cmd
 
 import (
+	"github.com/epsniff/eveland/src/evecache"
 	"github.com/epsniff/eveland/src/evesdk"
 	"github.com/spf13/cobra"
 )
 
 // Register is a helper function to register a command with the root command.
-func Register(cmd *cobra.Command, eveSDK *evesdk.EveLand, dbpath string) {
+func Register(cmd *cobra.Command, eveSDK *evesdk.EveLand, cache *evecache.EveCache, dbpath string) {
 	addMarketOrdersCommands(cmd, eveSDK, dbpath)
 	addRegionCommands(cmd, eveSDK, dbpath)
 	addItemCommands(cmd, eveSDK, dbpath)
+	addPriceCommands(cmd, eveSDK, dbpath)
 	addSystemCommands(cmd, eveSDK, dbpath)
 	addSDEUtilsCommands(cmd, eveSDK, dbpath)
+	addEveRefCommands(cmd, eveSDK, dbpath)
+	addExportCommands(cmd, eveSDK, dbpath)
+	addCacheCommands(cmd, cache)
+	addSSOCommands(cmd, dbpath)
 
 	addTradersToolsCommands(cmd, eveSDK, dbpath)
+	addMyOrdersCommands(cmd, eveSDK, dbpath)
+	addLedgerCommands(cmd, eveSDK, dbpath)
+	addNetworthCommands(cmd, eveSDK, dbpath)
 }
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesso"
+	"github.com/spf13/cobra"
+)
+
+// defaultScopes are the scopes the character commands need.
+var defaultScopes = []string{
+	"esi-markets.read_character_orders.v1",
+	"esi-markets.structure_markets.v1",
+	"esi-universe.read_structures.v1",
+	"esi-wallet.read_character_wallet.v1",
+	"esi-assets.read_assets.v1",
+}
+
+// ssoConfig is evesso.DefaultConfig with the client id from EVELAND_SSO_CLIENT_ID.
+func ssoConfig() evesso.Config {
+	cfg := evesso.DefaultConfig
+	cfg.ClientID = os.Getenv("EVELAND_SSO_CLIENT_ID")
+	cfg.Scopes = defaultScopes
+	return cfg
+}
+
+// characterContext opens the token store and returns ctx authenticated as the character, for goesi's
+// authenticated endpoints. A zero characterID picks the only logged in character. Call done when finished
+// with the context.
+func characterContext(ctx context.Context, dbpath string, characterID int32) (authCtx context.Context, char *evesso.Character, done func(), err error) {
+	store, err := evesso.OpenTokenStore(dbpath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			store.Close()
+		}
+	}()
+
+	char, err = pickCharacter(store, characterID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authCtx, err = evesso.New(ssoConfig(), store).Context(ctx, char.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return authCtx, char, func() { store.Close() }, nil
+}
+
+// lookupCharacter is characterContext for commands that only need to know which character, e.g. to file
+// transactions read from a file under it, so it doesn't touch the character's tokens.
+func lookupCharacter(dbpath string, characterID int32) (*evesso.Character, error) {
+	store, err := evesso.OpenTokenStore(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return pickCharacter(store, characterID)
+}
+
+// pickCharacter returns the logged in character characterID, or the only logged in one for 0.
+func pickCharacter(store *evesso.TokenStore, characterID int32) (*evesso.Character, error) {
+	if characterID == 0 {
+		chars, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(chars) != 1 {
+			return nil, fmt.Errorf("%d characters logged in, pick one with --character or log in with: sso login", len(chars))
+		}
+		characterID = chars[0].ID
+	}
+	return store.Get(characterID)
+}
+
+func addSSOCommands(rootCmd *cobra.Command, dbpath string) {
+	var cfg = ssoConfig()
+	var scopes = strings.Join(defaultScopes, ",")
+	var timeout = 5 * time.Minute
+	var characterID int32
+
+	var SSOCmd = &cobra.Command{
+		Use:   "sso",
+		Short: "sso",
+		Long: `
+	logs characters in through EVE SSO. Register an application at https://developers.eveonline.com with the
+	callback http://localhost:8089/callback and set EVELAND_SSO_CLIENT_ID, or pass --client-id. Tokens are kept
+	encrypted in evesso_peb_db, with the key in EVELAND_SSO_KEY or a key file under the user's config directory.
+	`,
+	}
+
+	// eveland sso login
+	var SSOLoginCmd = &cobra.Command{
+		Use:   "login",
+		Short: "login",
+		Long: `
+	logs a character in. Open the printed URL in a browser and approve the login, eveland waits for the callback.
+	  go run main.go sso login
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := evesso.OpenTokenStore(dbpath)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			defer store.Close()
+
+			cfg.Scopes = strings.Split(scopes, ",")
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			char, err := evesso.New(cfg, store).Login(ctx, func(authURL string) error {
+				fmt.Printf("Open this URL in your browser to log in:\n\n  %s\n\nWaiting for the login on %s\n", authURL, cfg.CallbackURL)
+				return nil
+			})
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Logged in %s (%d) with %d scopes\n", char.Name, char.ID, len(char.Scopes))
+		},
+	}
+	SSOLoginCmd.PersistentFlags().
+		StringVar(&cfg.ClientID, "client-id", cfg.ClientID, "the sso application's client id. default is $EVELAND_SSO_CLIENT_ID.")
+	SSOLoginCmd.PersistentFlags().
+		StringVar(&cfg.CallbackURL, "callback", cfg.CallbackURL, "the application's registered callback url. default is "+cfg.CallbackURL+".")
+	SSOLoginCmd.PersistentFlags().
+		StringVar(&scopes, "scopes", scopes, "comma separated scopes to request. default is the scopes eveland's character commands use.")
+	SSOLoginCmd.PersistentFlags().
+		DurationVar(&timeout, "timeout", timeout, "how long to wait for the login. default is 5m.")
+
+	// eveland sso characters
+	var SSOCharactersCmd = &cobra.Command{
+		Use:   "characters",
+		Short: "characters",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := evesso.OpenTokenStore(dbpath)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			defer store.Close()
+
+			chars, err := evesso.New(cfg, store).Characters()
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			if len(chars) == 0 {
+				fmt.Println("No characters logged in, use: sso login")
+				return
+			}
+			for _, char := range chars {
+				fmt.Printf("%d\t%s\tlogged in %s\t%s\n", char.ID, char.Name, char.Updated.Format(time.RFC3339), strings.Join(char.Scopes, " "))
+			}
+		},
+	}
+
+	// eveland sso logout
+	var SSOLogoutCmd = &cobra.Command{
+		Use:   "logout",
+		Short: "logout",
+		Long: `
+	revokes a character's refresh token and removes it from the token store.
+	  go run main.go sso logout -c=90000001
+	`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if characterID == 0 {
+				fmt.Println("error: --character is required")
+				return
+			}
+			store, err := evesso.OpenTokenStore(dbpath)
+			if err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			defer store.Close()
+
+			if err := evesso.New(cfg, store).Logout(context.Background(), characterID); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+			fmt.Printf("Logged out %d\n", characterID)
+		},
+	}
+	SSOLogoutCmd.PersistentFlags().
+		Int32VarP(&characterID, "character", "c", 0, "the character id to log out, see sso characters.")
+
+	SSOCmd.AddCommand(SSOLoginCmd, SSOCharactersCmd, SSOLogoutCmd)
+	rootCmd.AddCommand(SSOCmd)
+}
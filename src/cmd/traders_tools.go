@@ -20,6 +20,8 @@ func addTradersToolsCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 	var salesTax = 0.036 // 3.6% sales tax with accounting level 5, use (1 - salesTax) to convert, e.g. .036 to .964
 	var maxCargoSize = 16_000.0
 	var minProfit = 1_000_000
+	var backend = string(dbmarketorders.BackendBluge)
+	var filter dbitems.ItemFilter
 
 	var FindBestTradeRouteCmd = &cobra.Command{
 		Use:   "best-trades",
@@ -43,11 +45,13 @@ func addTradersToolsCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 				return
 			}
 
-			dbm, err := dbmarketorders.New(eveSDK, dbpath, false)
+			dbm, err := dbmarketorders.Open(dbmarketorders.Backend(backend), eveSDK, dbpath, dbmarketorders.Options{})
 			if err != nil {
 				fmt.Println("error creating db marketorders: ", err)
 				return
 			}
+			defer dbm.Close()
+			fmt.Printf("Using market orders generation %d\n", dbm.Generation())
 
 			dbi, err := dbitems.New(eveSDK, dbpath)
 			if err != nil {
@@ -63,7 +67,7 @@ func addTradersToolsCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 			ta := 0
 			for _, system := range systemsInRange {
 				systems++
-				traderRevenues, traderAcquires, err := dbm.GetMarketOrdersBySystemID(context.TODO(), int32(system.ID))
+				traderRevenues, traderAcquires, err := dbmarketorders.OrdersBySystemID(context.TODO(), dbm, int32(system.ID))
 				if err != nil {
 					fmt.Println("error getting market orders: ", err)
 					return
@@ -104,6 +108,12 @@ func addTradersToolsCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 					fmt.Println("error getting item: ", err)
 					return
 				}
+				if ok, err := dbi.Matches(context.TODO(), td, filter); err != nil {
+					fmt.Println("error filtering items: ", err)
+					return
+				} else if !ok {
+					continue
+				}
 
 				maxCargo := math.Floor(maxCargoSize / float64(td.Volume))
 
@@ -213,6 +223,14 @@ func addTradersToolsCommands(rootCmd *cobra.Command, eveSDK *evesdk.EveLand, dbp
 		StringVarP(&systemName, "system", "s", "Scheenins", "system name to use as the center of the search. default is Scheenins.")
 	FindBestTradeRouteCmd.PersistentFlags().
 		IntVarP(&jumps, "jumps", "j", 3, "number of jumps to search. default is 3.")
+	FindBestTradeRouteCmd.PersistentFlags().
+		StringVarP(&backend, "backend", "b", "bluge", "market order storage backend, bluge, columnar or sqlite. default is bluge.")
+	FindBestTradeRouteCmd.PersistentFlags().
+		Int32SliceVar(&filter.MarketGroupIDs, "market-group", nil, "only trade types under these market groups, see market-groups. default is every type.")
+	FindBestTradeRouteCmd.PersistentFlags().
+		Int32SliceVar(&filter.GroupIDs, "group", nil, "only trade types in these groups. default is every type.")
+	FindBestTradeRouteCmd.PersistentFlags().
+		Int32SliceVar(&filter.CategoryIDs, "category", nil, "only trade types in these categories, e.g. 7,8 for modules and charges. default is every type.")
 
 	rootCmd.AddCommand(FindBestTradeRouteCmd)
 }
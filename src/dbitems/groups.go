@@ -0,0 +1,353 @@
+package dbitems
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// ErrGroupsNotLoaded is returned when the group hierarchy is needed but LoadGroups never ran.
+var ErrGroupsNotLoaded = errors.New("market groups not loaded, use: loadgroups")
+
+// The hierarchy is kept next to the types, under prefixes that can't clash with the bare type ID keys.
+const (
+	marketGroupPrefix = "mg:"
+	groupPrefix       = "g:"
+	categoryPrefix    = "c:"
+)
+
+// hierarchy is the market group tree and the group and category tables, read from pebble on first use.
+type hierarchy struct {
+	marketGroups map[int32]*evesdk.MarketGroup
+	children     map[int32][]*evesdk.MarketGroup
+	groups       map[int32]*evesdk.Group
+	categories   map[int32]*evesdk.Category
+}
+
+// LoadGroups loads every market group, group and category from ESI.
+func (r *ItemDataDB) LoadGroups(ctx context.Context) error {
+	marketGroupIDs, err := r.eveSDK.ListMarketGroupIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing market groups: %v", err)
+	}
+	marketGroups, err := fetchAll(ctx, marketGroupIDs, r.eveSDK.GetMarketGroup)
+	if err != nil {
+		return fmt.Errorf("error getting market group: %v", err)
+	}
+	fmt.Printf("Number of market groups: %v\n", len(marketGroups))
+
+	groupIDs, err := r.eveSDK.ListAllGroupIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing groups: %v", err)
+	}
+	groups, err := fetchAll(ctx, groupIDs, r.eveSDK.GetGroup)
+	if err != nil {
+		return fmt.Errorf("error getting group: %v", err)
+	}
+	fmt.Printf("Number of groups: %v\n", len(groups))
+
+	categoryIDs, err := r.eveSDK.ListCategoryIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing categories: %v", err)
+	}
+	categories, err := fetchAll(ctx, categoryIDs, r.eveSDK.GetCategory)
+	if err != nil {
+		return fmt.Errorf("error getting category: %v", err)
+	}
+	fmt.Printf("Number of categories: %v\n", len(categories))
+
+	batch := r.pdb.NewBatch()
+	defer batch.Close()
+	set := func(key string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error while trying to marshal %s: %v", key, err)
+		}
+		return batch.Set([]byte(key), data, nil)
+	}
+	for _, g := range marketGroups {
+		if err := set(marketGroupPrefix+strconv.Itoa(int(g.MarketGroupID)), g); err != nil {
+			return err
+		}
+	}
+	for _, g := range groups {
+		if err := set(groupPrefix+strconv.Itoa(int(g.GroupID)), g); err != nil {
+			return err
+		}
+	}
+	for _, c := range categories {
+		if err := set(categoryPrefix+strconv.Itoa(int(c.CategoryID)), c); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("error while trying to write to db: err: %v", err)
+	}
+
+	r.mu.Lock()
+	r.tree = nil
+	r.mu.Unlock()
+	return nil
+}
+
+// GetMarketGroup returns a market group.
+func (r *ItemDataDB) GetMarketGroup(ctx context.Context, id int32) (*evesdk.MarketGroup, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	g, ok := h.marketGroups[id]
+	if !ok {
+		return nil, fmt.Errorf("no market group %d", id)
+	}
+	return g, nil
+}
+
+// MarketGroupChildren returns the market groups directly under parentID sorted by name, the top level ones
+// for 0.
+func (r *ItemDataDB) MarketGroupChildren(ctx context.Context, parentID int32) ([]*evesdk.MarketGroup, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	return h.children[parentID], nil
+}
+
+// MarketGroupPath returns the market group and its ancestors, the top level group first.
+func (r *ItemDataDB) MarketGroupPath(ctx context.Context, id int32) ([]*evesdk.MarketGroup, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	var path []*evesdk.MarketGroup
+	// The depth guard stops a parent loop from spinning forever.
+	for id != 0 && len(path) <= len(h.marketGroups) {
+		g, ok := h.marketGroups[id]
+		if !ok {
+			return nil, fmt.Errorf("no market group %d", id)
+		}
+		path = append([]*evesdk.MarketGroup{g}, path...)
+		id = g.ParentGroupID
+	}
+	return path, nil
+}
+
+// GetGroup returns an item group.
+func (r *ItemDataDB) GetGroup(ctx context.Context, id int32) (*evesdk.Group, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	g, ok := h.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("no group %d", id)
+	}
+	return g, nil
+}
+
+// GetCategory returns an item category.
+func (r *ItemDataDB) GetCategory(ctx context.Context, id int32) (*evesdk.Category, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := h.categories[id]
+	if !ok {
+		return nil, fmt.Errorf("no category %d", id)
+	}
+	return c, nil
+}
+
+// Categories returns every category sorted by name.
+func (r *ItemDataDB) Categories(ctx context.Context) ([]*evesdk.Category, error) {
+	h, err := r.hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	cats := make([]*evesdk.Category, 0, len(h.categories))
+	for _, c := range h.categories {
+		cats = append(cats, c)
+	}
+	sort.Slice(cats, func(i, j int) bool { return cats[i].Name < cats[j].Name })
+	return cats, nil
+}
+
+// ItemFilter picks types by where they sit in the hierarchy. A type matches when any of its market group's
+// ancestors is one of MarketGroupIDs, its group is one of GroupIDs or its group's category is one of
+// CategoryIDs. An empty filter matches everything.
+type ItemFilter struct {
+	MarketGroupIDs []int32
+	GroupIDs       []int32
+	CategoryIDs    []int32
+}
+
+// IsEmpty reports whether the filter matches everything.
+func (f ItemFilter) IsEmpty() bool {
+	return len(f.MarketGroupIDs) == 0 && len(f.GroupIDs) == 0 && len(f.CategoryIDs) == 0
+}
+
+// Matches reports whether the type passes the filter.
+func (r *ItemDataDB) Matches(ctx context.Context, td *evesdk.TypeData, f ItemFilter) (bool, error) {
+	if f.IsEmpty() {
+		return true, nil
+	}
+	h, err := r.hierarchy()
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range f.GroupIDs {
+		if id == td.GroupId {
+			return true, nil
+		}
+	}
+	if g, ok := h.groups[td.GroupId]; ok {
+		for _, id := range f.CategoryIDs {
+			if id == g.CategoryID {
+				return true, nil
+			}
+		}
+	}
+	if len(f.MarketGroupIDs) > 0 && td.MarketGroupId != 0 {
+		path, err := r.MarketGroupPath(ctx, td.MarketGroupId)
+		if err != nil {
+			return false, err
+		}
+		for _, g := range path {
+			for _, id := range f.MarketGroupIDs {
+				if id == g.MarketGroupID {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (r *ItemDataDB) hierarchy() (*hierarchy, error) {
+	r.mu.RLock()
+	h := r.tree
+	r.mu.RUnlock()
+	if h != nil {
+		return h, nil
+	}
+
+	h = &hierarchy{
+		marketGroups: map[int32]*evesdk.MarketGroup{},
+		children:     map[int32][]*evesdk.MarketGroup{},
+		groups:       map[int32]*evesdk.Group{},
+		categories:   map[int32]*evesdk.Category{},
+	}
+	err := r.scan(marketGroupPrefix, func(data []byte) error {
+		var g evesdk.MarketGroup
+		if err := json.Unmarshal(data, &g); err != nil {
+			return err
+		}
+		h.marketGroups[g.MarketGroupID] = &g
+		h.children[g.ParentGroupID] = append(h.children[g.ParentGroupID], &g)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(h.marketGroups) == 0 {
+		return nil, ErrGroupsNotLoaded
+	}
+	for _, children := range h.children {
+		sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	}
+	err = r.scan(groupPrefix, func(data []byte) error {
+		var g evesdk.Group
+		if err := json.Unmarshal(data, &g); err != nil {
+			return err
+		}
+		h.groups[g.GroupID] = &g
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.scan(categoryPrefix, func(data []byte) error {
+		var c evesdk.Category
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		h.categories[c.CategoryID] = &c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.tree = h
+	r.mu.Unlock()
+	return h, nil
+}
+
+func (r *ItemDataDB) scan(prefix string, fn func(data []byte) error) error {
+	iter := r.pdb.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(prefix),
+		UpperBound: []byte(prefix[:len(prefix)-1] + string(prefix[len(prefix)-1]+1)),
+	})
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := fn(iter.Value()); err != nil {
+			return fmt.Errorf("error while trying to unmarshal %s: %v", iter.Key(), err)
+		}
+	}
+	return iter.Error()
+}
+
+// fetchAll gets each ID with a few requests in flight, retrying failures a few times. What was fetched is
+// returned even when some failed, with the first failure.
+func fetchAll[T any](ctx context.Context, ids []int32, get func(ctx context.Context, id int32) (*T, error)) ([]*T, error) {
+	var sem = make(chan int, 4)
+	var mu sync.Mutex
+	var firstErr error
+	out := make([]*T, 0, len(ids))
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- 1
+		go func(id int32) {
+			defer func() {
+				wg.Done()
+				<-sem
+			}()
+			const tries = 5
+			var v *T
+			var err error
+		retry:
+			for try := 0; try < tries; try++ {
+				if v, err = get(ctx, id); err == nil || try == tries-1 {
+					break
+				}
+				select {
+				case <-ctx.Done():
+					break retry
+				case <-time.After(time.Duration(try+1) * time.Second):
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%d: %v", id, err)
+				}
+				return
+			}
+			out = append(out, v)
+		}(id)
+	}
+	wg.Wait()
+	return out, firstErr
+}
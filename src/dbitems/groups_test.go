@@ -0,0 +1,90 @@
+package dbitems
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroups(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 1
+	esi.AddMarketGroup(&evesdk.MarketGroup{MarketGroupID: 11, Name: "Ammunition & Charges"})
+	esi.AddMarketGroup(&evesdk.MarketGroup{MarketGroupID: 99, ParentGroupID: 11, Name: "Hybrid Charges"})
+	esi.AddMarketGroup(&evesdk.MarketGroup{MarketGroupID: 990, ParentGroupID: 99, Name: "Small", TypeIDs: []int32{230}})
+	esi.AddMarketGroup(&evesdk.MarketGroup{MarketGroupID: 9, Name: "Ship Equipment"})
+	esi.AddGroup(&evesdk.Group{GroupID: 85, CategoryID: 8, Name: "Hybrid Charge", Published: true, TypeIDs: []int32{230}})
+	esi.AddGroup(&evesdk.Group{GroupID: 18, CategoryID: 4, Name: "Mineral", Published: true, TypeIDs: []int32{34}})
+	esi.AddCategory(&evesdk.Category{CategoryID: 8, Name: "Charge", Published: true, GroupIDs: []int32{85}})
+	esi.AddCategory(&evesdk.Category{CategoryID: 4, Name: "Material", Published: true, GroupIDs: []int32{18}})
+	ctx := context.Background()
+
+	dbi, err := New(esi.EveLand(), t.TempDir())
+	require.NoError(t, err)
+	defer dbi.Close()
+	_, err = dbi.MarketGroupChildren(ctx, 0)
+	assert.True(t, errors.Is(err, ErrGroupsNotLoaded))
+
+	require.NoError(t, dbi.LoadGroups(ctx))
+
+	roots, err := dbi.MarketGroupChildren(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	assert.Equal(t, "Ammunition & Charges", roots[0].Name, "sorted by name")
+
+	path, err := dbi.MarketGroupPath(ctx, 990)
+	require.NoError(t, err)
+	require.Len(t, path, 3)
+	assert.Equal(t, int32(11), path[0].MarketGroupID)
+	assert.Equal(t, int32(990), path[2].MarketGroupID)
+
+	cats, err := dbi.Categories(ctx)
+	require.NoError(t, err)
+	assert.Len(t, cats, 2)
+
+	antimatter := &evesdk.TypeData{TypeId: 230, GroupId: 85, MarketGroupId: 990}
+	tritanium := &evesdk.TypeData{TypeId: 34, GroupId: 18}
+	for _, tc := range []struct {
+		name       string
+		filter     ItemFilter
+		antimatter bool
+		tritanium  bool
+	}{
+		{"empty", ItemFilter{}, true, true},
+		{"top level market group", ItemFilter{MarketGroupIDs: []int32{11}}, true, false},
+		{"other market group", ItemFilter{MarketGroupIDs: []int32{9}}, false, false},
+		{"group", ItemFilter{GroupIDs: []int32{18}}, false, true},
+		{"category", ItemFilter{CategoryIDs: []int32{8}}, true, false},
+		{"any of them", ItemFilter{MarketGroupIDs: []int32{99}, CategoryIDs: []int32{4}}, true, true},
+	} {
+		ok, err := dbi.Matches(ctx, antimatter, tc.filter)
+		require.NoError(t, err)
+		assert.Equal(t, tc.antimatter, ok, tc.name)
+		ok, err = dbi.Matches(ctx, tritanium, tc.filter)
+		require.NoError(t, err)
+		assert.Equal(t, tc.tritanium, ok, tc.name)
+	}
+}
+
+func TestFetchAllStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tries := 0
+	start := time.Now()
+	out, err := fetchAll(ctx, []int32{34}, func(ctx context.Context, id int32) (*int32, error) {
+		tries++
+		cancel()
+		return nil, errors.New("502 Bad Gateway")
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502 Bad Gateway")
+	assert.Empty(t, out)
+	assert.Equal(t, 1, tries, "no retries once the context is done")
+	assert.Less(t, time.Since(start), time.Second, "no backoff once the context is done")
+}
@@ -1,6 +1,7 @@
 package dbitems
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blugelabs/bluge"
 	"github.com/cockroachdb/pebble"
 	"github.com/epsniff/eveland/src/evesdk"
 )
@@ -17,6 +19,13 @@ import (
 type EveLand interface {
 	ListAllTypeIDs(ctx context.Context) ([]int32, error)
 	GetTypeData(ctx context.Context, typeID int32) (*evesdk.TypeData, error)
+	GetTypeDataIfChanged(ctx context.Context, typeID int32, etag string) (*evesdk.TypeData, string, error)
+	ListMarketGroupIDs(ctx context.Context) ([]int32, error)
+	GetMarketGroup(ctx context.Context, marketGroupID int32) (*evesdk.MarketGroup, error)
+	ListAllGroupIDs(ctx context.Context) ([]int32, error)
+	GetGroup(ctx context.Context, groupID int32) (*evesdk.Group, error)
+	ListCategoryIDs(ctx context.Context) ([]int32, error)
+	GetCategory(ctx context.Context, categoryID int32) (*evesdk.Category, error)
 }
 
 type ItemDataDB struct {
@@ -24,8 +33,12 @@ type ItemDataDB struct {
 
 	mu        sync.RWMutex
 	typeCache map[int32]*evesdk.TypeData
+	tree      *hierarchy
 
-	pdb *pebble.DB
+	dbpath string
+	pdb    *pebble.DB
+	// index is the text index Search uses, opened on first use.
+	index *bluge.Writer
 }
 
 func New(eveSDK EveLand, dbpath string) (*ItemDataDB, error) {
@@ -40,10 +53,15 @@ func New(eveSDK EveLand, dbpath string) (*ItemDataDB, error) {
 		return nil, fmt.Errorf("error opening: %v", err)
 	}
 
-	return &ItemDataDB{eveSDK: eveSDK, pdb: pdb, typeCache: make(map[int32]*evesdk.TypeData)}, nil
+	return &ItemDataDB{eveSDK: eveSDK, dbpath: dbpath, pdb: pdb, typeCache: make(map[int32]*evesdk.TypeData)}, nil
 }
 
 func (r *ItemDataDB) Close() error {
+	if r.index != nil {
+		if err := r.index.Close(); err != nil {
+			return fmt.Errorf("error closing Bluge index writer: %v", err)
+		}
+	}
 	err := r.pdb.Close()
 	if err != nil {
 		return fmt.Errorf("error closing: %v", err)
@@ -82,71 +100,224 @@ func (r *ItemDataDB) GetItem(ctx context.Context, id int32) (*evesdk.TypeData, e
 	return td, nil
 }
 
-func (r *ItemDataDB) LoadItems(ctx context.Context) error {
-	types, err := r.eveSDK.ListAllTypeIDs(context.Background())
+// DefaultMaxAge is how long a fetched type is trusted before LoadItems revalidates it.
+const DefaultMaxAge = 24 * time.Hour
+
+// typeMeta is when a type was last fetched from ESI and the ETag it came with, kept under metaKey.
+type typeMeta struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	ETag      string    `json:"etag,omitempty"`
+}
+
+// RefreshReport counts what LoadItems did with each type ESI lists.
+type RefreshReport struct {
+	// Added types weren't stored before.
+	Added int
+	// Changed and Unchanged types were stale and revalidated, Unchanged ones came back the same or 304.
+	Changed   int
+	Unchanged int
+	// Fresh types were fetched within the max age, or loaded from the SDE, and skipped.
+	Fresh int
+}
+
+func (r *RefreshReport) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d unchanged, %d fresh", r.Added, r.Changed, r.Unchanged, r.Fresh)
+}
+
+// LoadItems fetches the types ESI lists that are new, or were last fetched more than maxAge ago. Stale types
+// are revalidated with their ETag, so unchanged ones cost a 304. Types loaded from the SDE have no fetch time
+// and are skipped, revalidating them would be a full request per type. A zero maxAge revalidates every type,
+// those from the SDE included.
+func (r *ItemDataDB) LoadItems(ctx context.Context, maxAge time.Duration) (*RefreshReport, error) {
+	return r.refresh(ctx, maxAge, false)
+}
+
+type fetchedType struct {
+	id      int32
+	td      *evesdk.TypeData
+	meta    *typeMeta
+	old     []byte
+	changed bool
+}
+
+func (r *ItemDataDB) refresh(ctx context.Context, maxAge time.Duration, onlyNew bool) (*RefreshReport, error) {
+	types, err := r.eveSDK.ListAllTypeIDs(ctx)
 	if err != nil {
-		fmt.Println("Error while trying to list all type ids:", err)
+		return nil, fmt.Errorf("error while trying to list all type ids: %v", err)
 	}
 	fmt.Printf("Number of types: %v\n", len(types))
 
-	// sem is a channel that will allow up to 4 concurrent operations.
-	var sem = make(chan int, 2)
-	// Create a mutex to protect the marketOrders slice	append.
-	typeMu := &sync.RWMutex{}
-	typeDataList := []*evesdk.TypeData{}
-	var wg sync.WaitGroup
-	wg.Add(len(types))
-	for i, t := range types {
-		go func(i int, typeId int32) {
-			defer func() {
-				wg.Done()
-				<-sem
-			}()
-			try := 0
-		retry:
-			td, err := r.eveSDK.GetTypeData(context.Background(), typeId)
+	report := &RefreshReport{}
+	now := time.Now().UTC()
+	todo := map[int32]*fetchedType{}
+	ids := []int32{}
+	for _, id := range types {
+		old, err := r.get(TypeIDKey(id))
+		if err != nil {
+			return nil, err
+		}
+		f := &fetchedType{id: id, old: old, meta: &typeMeta{}}
+		if old != nil {
+			if onlyNew {
+				report.Fresh++
+				continue
+			}
+			data, err := r.get(metaKey(id))
 			if err != nil {
-				err := fmt.Errorf("error while trying to get type data: %v", err)
-				fmt.Printf("Error: try: %v, type: %v, err: %v\n", try, typeId, err)
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				if try < 5 {
-					goto retry
+				return nil, err
+			}
+			if data != nil {
+				if err := json.Unmarshal(data, f.meta); err != nil {
+					return nil, fmt.Errorf("error while trying to unmarshal meta of %d: %v", id, err)
 				}
 			}
-			typeMu.Lock()
-			typeDataList = append(typeDataList, td)
-			typeMu.Unlock()
-			if i%300 == 0 {
-				fmt.Printf("Processed %d types.\n", i)
+			if maxAge > 0 && (f.meta.FetchedAt.IsZero() || now.Sub(f.meta.FetchedAt) < maxAge) {
+				report.Fresh++
+				continue
 			}
-		}(i, t)
-		time.Sleep(10 * time.Millisecond)
+		}
+		todo[id] = f
+		ids = append(ids, id)
+	}
+	fmt.Printf("Number of types to fetch: %v\n", len(todo))
+
+	done, fetchErr := fetchAll(ctx, ids, func(ctx context.Context, id int32) (*fetchedType, error) {
+		f := todo[id]
+		etag := f.meta.ETag
+		if f.old == nil {
+			etag = ""
+		}
+		td, newETag, err := r.eveSDK.GetTypeDataIfChanged(ctx, f.id, etag)
+		if err != nil {
+			return nil, err
+		}
+		f.meta = &typeMeta{FetchedAt: time.Now().UTC(), ETag: newETag}
+		if td != nil {
+			data, err := json.Marshal(td)
+			if err != nil {
+				return nil, err
+			}
+			// A new ETag doesn't always mean new data.
+			f.td, f.changed = td, !bytes.Equal(data, f.old)
+		}
+		return f, nil
+	})
+
+	written := []*evesdk.TypeData{}
+	meta := map[int32]*typeMeta{}
+	for _, f := range done {
+		meta[f.id] = f.meta
+		switch {
+		case f.old == nil:
+			report.Added++
+		case f.changed:
+			report.Changed++
+		default:
+			report.Unchanged++
+		}
+		if f.changed {
+			written = append(written, f.td)
+		}
+	}
+	// Keep what did get fetched even if some types failed.
+	if err := r.writeTypes(written, meta); err != nil {
+		return nil, err
 	}
-	wg.Wait() // Wait for all goroutines to finish.
-	fmt.Printf("Number of type data: %v\n", len(typeDataList))
+	if fetchErr != nil {
+		return report, fmt.Errorf("error while trying to get type data: %v", fetchErr)
+	}
+	fmt.Printf("Done writing to type database, %s\n", report)
+	return report, nil
+}
+
+func (r *ItemDataDB) get(key []byte) ([]byte, error) {
+	data, closer, err := r.pdb.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error while trying to read from db: err: %v", err)
+	}
+	defer closer.Close()
+	return append([]byte(nil), data...), nil
+}
+
+// TypeSource lists every item type in one go, evesdedb.EveSDEDB satisfies it from the SDE's invTypes.
+type TypeSource interface {
+	ListTypes(ctx context.Context) ([]*evesdk.TypeData, error)
+}
+
+// LoadItemsFrom fills the db from src in one pass instead of a request per type, returning how many types it
+// wrote. Types src doesn't know keep what was stored for them.
+func (r *ItemDataDB) LoadItemsFrom(ctx context.Context, src TypeSource) (int, error) {
+	types, err := src.ListTypes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while trying to list types: %v", err)
+	}
+	if err := r.writeTypes(types, nil); err != nil {
+		return 0, err
+	}
+	fmt.Printf("Done writing to type database, number of types: %v\n", len(types))
+	return len(types), nil
+}
 
-	for _, td := range typeDataList {
-		// marshal the data as json
+// LoadMissingItems fetches from ESI only the types it lists that aren't stored yet, e.g. the ones added to the
+// game since the SDE dump LoadItemsFrom read, returning how many it added.
+func (r *ItemDataDB) LoadMissingItems(ctx context.Context) (int, error) {
+	report, err := r.refresh(ctx, 0, true)
+	if report == nil {
+		return 0, err
+	}
+	return report.Added, err
+}
+
+// writeTypes stores types and the fetch metadata in one batch, drops the cached types and updates the text
+// index. Types without metadata lose any they had, LoadItems then leaves them alone until asked to revalidate
+// everything.
+func (r *ItemDataDB) writeTypes(types []*evesdk.TypeData, meta map[int32]*typeMeta) error {
+	batch := r.pdb.NewBatch()
+	defer batch.Close()
+	for _, td := range types {
 		data, err := json.Marshal(td)
 		if err != nil {
 			return fmt.Errorf("error while trying to marshal type data: %v", err)
 		}
-		err = r.pdb.Set(TypeIDKey(td.TypeId), data, pebble.Sync)
+		if err := batch.Set(TypeIDKey(td.TypeId), data, nil); err != nil {
+			return fmt.Errorf("error while trying to write to batch: %v", err)
+		}
+		if _, ok := meta[td.TypeId]; !ok {
+			if err := batch.Delete(metaKey(td.TypeId), nil); err != nil {
+				return fmt.Errorf("error while trying to write to batch: %v", err)
+			}
+		}
+	}
+	for id, m := range meta {
+		data, err := json.Marshal(m)
 		if err != nil {
-			return fmt.Errorf("error while trying to write to db: err: %v", err)
+			return fmt.Errorf("error while trying to marshal type meta: %v", err)
+		}
+		if err := batch.Set(metaKey(id), data, nil); err != nil {
+			return fmt.Errorf("error while trying to write to batch: %v", err)
 		}
 	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("error while trying to write to db: err: %v", err)
+	}
 
-	fmt.Printf("Done writing to type database, number of types: %v\n", len(typeDataList))
-
-	return nil
+	r.mu.Lock()
+	r.typeCache = make(map[int32]*evesdk.TypeData)
+	r.mu.Unlock()
+	return r.indexTypes(types)
 }
 
 func TypeIDKey(typeID int32) []byte {
 	return []byte(strconv.Itoa(int(typeID)))
 }
 
+// metaKey is where a type's fetch metadata lives, beside its TypeIDKey.
+func metaKey(typeID int32) []byte {
+	return []byte("meta:" + strconv.Itoa(int(typeID)))
+}
+
 func db_location(baseDir string) (string, error) {
 	dbpath := filepath.Join(baseDir, "eveitems_peb_db")
 
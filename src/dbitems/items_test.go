@@ -0,0 +1,60 @@
+package dbitems
+
+import (
+	"context"
+	"testing"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type types []*evesdk.TypeData
+
+func (t types) ListTypes(ctx context.Context) ([]*evesdk.TypeData, error) {
+	return t, nil
+}
+
+func TestLoadItems(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium", Volume: 0.01})
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite", Volume: 0.01})
+	ctx := context.Background()
+
+	dbi, err := New(esi.EveLand(), t.TempDir())
+	require.NoError(t, err)
+	defer dbi.Close()
+
+	report, err := dbi.LoadItems(ctx, DefaultMaxAge)
+	require.NoError(t, err)
+	assert.Equal(t, RefreshReport{Added: 2}, *report)
+
+	report, err = dbi.LoadItems(ctx, DefaultMaxAge)
+	require.NoError(t, err)
+	assert.Equal(t, RefreshReport{Fresh: 2}, *report, "nothing is stale yet")
+	assert.Equal(t, 1, esi.Requests("/v3/universe/types/34/"))
+
+	// Revalidating everything costs a 304 per unchanged type.
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite (renamed)", Volume: 0.01})
+	_, err = dbi.GetItem(ctx, 35)
+	require.NoError(t, err)
+	report, err = dbi.LoadItems(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, RefreshReport{Changed: 1, Unchanged: 1}, *report)
+	assert.Equal(t, 1, esi.NotModified())
+	td, err := dbi.GetItem(ctx, 35)
+	require.NoError(t, err)
+	assert.Equal(t, "Pyerite (renamed)", td.Name, "the cached type was dropped")
+
+	// Types from the SDE have no fetch time, they are only revalidated along with everything else.
+	_, err = dbi.LoadItemsFrom(ctx, types{{TypeId: 34, Name: "Tritanium", Volume: 0.01}})
+	require.NoError(t, err)
+	report, err = dbi.LoadItems(ctx, DefaultMaxAge)
+	require.NoError(t, err)
+	assert.Equal(t, RefreshReport{Fresh: 2}, *report)
+	report, err = dbi.LoadItems(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, RefreshReport{Unchanged: 2}, *report)
+}
@@ -0,0 +1,252 @@
+package dbitems
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/analysis/analyzer"
+	"github.com/cockroachdb/pebble"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// DefaultSearchLimit is how many types Search returns when asked for no limit.
+const DefaultSearchLimit = 10
+
+// The text index over the type names and descriptions lives beside the pebble db. It only holds what's needed
+// to find a type ID, the types themselves are read back from pebble.
+const (
+	nameField        = "name"
+	exactNameField   = "exact_name"
+	descriptionField = "description"
+	publishedField   = "published"
+)
+
+// Search returns the types whose name best matches text, most relevant first. Each word of text matches
+// the words of a name by prefix, or with a typo or two for the longer words, so "trit" and "tritanim" both find
+// Tritanium. A name equal to text ranks first, published types rank above unpublished ones, and types that only
+// mention text in their description come last. The index is built from the stored types on first use.
+func (r *ItemDataDB) Search(ctx context.Context, text string, limit int) ([]*evesdk.TypeData, error) {
+	terms := analyzer.NewStandardAnalyzer().Analyze([]byte(text))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("nothing to search for in %q", text)
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	index, err := r.searchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nameQuery := bluge.NewBooleanQuery()
+	for _, t := range terms {
+		term := string(t.Term)
+		termQuery := bluge.NewBooleanQuery().SetMinShould(1).
+			AddShould(bluge.NewPrefixQuery(term).SetField(nameField).SetBoost(2))
+		if fuzziness := fuzzinessFor(term); fuzziness > 0 {
+			termQuery.AddShould(bluge.NewFuzzyQuery(term).SetField(nameField).SetFuzziness(fuzziness))
+		}
+		nameQuery.AddMust(termQuery)
+	}
+	textQuery := bluge.NewBooleanQuery().SetMinShould(1).AddShould(
+		nameQuery,
+		bluge.NewMatchQuery(text).SetField(descriptionField).SetOperator(bluge.MatchQueryOperatorAnd).SetBoost(0.1))
+	query := bluge.NewBooleanQuery().AddMust(textQuery).AddShould(
+		bluge.NewTermQuery(exactName(text)).SetField(exactNameField).SetBoost(10),
+		bluge.NewTermQuery("true").SetField(publishedField))
+
+	reader, err := index.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("error opening Bluge index reader: %v", err)
+	}
+	defer reader.Close()
+
+	results, err := reader.Search(ctx, bluge.NewTopNSearch(limit, query))
+	if err != nil {
+		return nil, fmt.Errorf("error searching index: %v", err)
+	}
+	ids := []int32{}
+	match, err := results.Next()
+	for err == nil && match != nil {
+		err = match.VisitStoredFields(func(field string, value []byte) bool {
+			if field == "_id" {
+				id, perr := strconv.Atoi(string(value))
+				if perr == nil {
+					ids = append(ids, int32(id))
+				}
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			break
+		}
+		match, err = results.Next()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error iterating results: %v", err)
+	}
+
+	types := make([]*evesdk.TypeData, 0, len(ids))
+	for _, id := range ids {
+		td, err := r.GetItem(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, td)
+	}
+	return types, nil
+}
+
+// ResolveType returns the type ID for nameOrID, either a type ID or an item name. A name has to match one type
+// exactly, ignoring case, or be the only one it matches, otherwise the error lists what it did match.
+func (r *ItemDataDB) ResolveType(ctx context.Context, nameOrID string) (int32, error) {
+	nameOrID = strings.TrimSpace(nameOrID)
+	if id, err := strconv.ParseInt(nameOrID, 10, 32); err == nil {
+		return int32(id), nil
+	}
+
+	types, err := r.Search(ctx, nameOrID, 5)
+	if err != nil {
+		return 0, err
+	}
+	if len(types) == 0 {
+		return 0, fmt.Errorf("no item matches %q, see: find-item", nameOrID)
+	}
+	for _, td := range types {
+		if strings.EqualFold(td.Name, nameOrID) {
+			return td.TypeId, nil
+		}
+	}
+	if len(types) == 1 {
+		return types[0].TypeId, nil
+	}
+	names := make([]string, 0, len(types))
+	for _, td := range types {
+		names = append(names, fmt.Sprintf("%s (%d)", td.Name, td.TypeId))
+	}
+	return 0, fmt.Errorf("%q matches several items, one of: %s", nameOrID, strings.Join(names, ", "))
+}
+
+// ResolveTypes resolves each of namesOrIDs with ResolveType.
+func (r *ItemDataDB) ResolveTypes(ctx context.Context, namesOrIDs []string) ([]int32, error) {
+	ids := make([]int32, 0, len(namesOrIDs))
+	for _, s := range namesOrIDs {
+		id, err := r.ResolveType(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// IndexItems rebuilds the text index from every stored type, returning how many it indexed. LoadItems and
+// LoadItemsFrom keep the index up to date, this is only needed for types stored before there was one.
+func (r *ItemDataDB) IndexItems(ctx context.Context) (int, error) {
+	// Type keys are bare type IDs, they sort before the prefixed keys of the metadata and hierarchy.
+	iter := r.pdb.NewIter(&pebble.IterOptions{LowerBound: []byte("0"), UpperBound: []byte(":")})
+	defer iter.Close()
+	types := []*evesdk.TypeData{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var td evesdk.TypeData
+		if err := json.Unmarshal(iter.Value(), &td); err != nil {
+			return 0, fmt.Errorf("error while trying to unmarshal %s: %v", iter.Key(), err)
+		}
+		types = append(types, &td)
+	}
+	if err := iter.Error(); err != nil {
+		return 0, fmt.Errorf("error while trying to read from db: err: %v", err)
+	}
+	if err := r.indexTypes(types); err != nil {
+		return 0, err
+	}
+	return len(types), nil
+}
+
+// indexTypes adds or replaces the types in the text index.
+func (r *ItemDataDB) indexTypes(types []*evesdk.TypeData) error {
+	if len(types) == 0 {
+		return nil
+	}
+	index, err := r.openIndex()
+	if err != nil {
+		return err
+	}
+	batch := bluge.NewBatch()
+	for _, td := range types {
+		doc := bluge.NewDocument(string(TypeIDKey(td.TypeId))).
+			AddField(bluge.NewTextField(nameField, td.Name)).
+			AddField(bluge.NewKeywordField(exactNameField, exactName(td.Name))).
+			AddField(bluge.NewTextField(descriptionField, td.Description)).
+			AddField(bluge.NewKeywordField(publishedField, strconv.FormatBool(td.Published)))
+		batch.Update(doc.ID(), doc)
+	}
+	if err := index.Batch(batch); err != nil {
+		return fmt.Errorf("error writing to bluge index: %v", err)
+	}
+	return nil
+}
+
+// searchIndex returns the text index, building it first if it's empty.
+func (r *ItemDataDB) searchIndex(ctx context.Context) (*bluge.Writer, error) {
+	index, err := r.openIndex()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := index.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("error opening Bluge index reader: %v", err)
+	}
+	count, err := reader.Count()
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error counting indexed types: %v", err)
+	}
+	if count == 0 {
+		n, err := r.IndexItems(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("no items loaded, use: loaditems")
+		}
+	}
+	return index, nil
+}
+
+func (r *ItemDataDB) openIndex() (*bluge.Writer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index != nil {
+		return r.index, nil
+	}
+	index, err := bluge.OpenWriter(bluge.DefaultConfig(filepath.Join(r.dbpath, "eveitems_bluge_idx")))
+	if err != nil {
+		return nil, fmt.Errorf("error opening bluge index: %v", err)
+	}
+	r.index = index
+	return index, nil
+}
+
+// fuzzinessFor is how many typos a search word may have, none for short words that would match nearly anything.
+func fuzzinessFor(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func exactName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
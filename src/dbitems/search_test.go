@@ -0,0 +1,66 @@
+package dbitems
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	dbpath := t.TempDir()
+	dbi, err := New(nil, dbpath)
+	require.NoError(t, err)
+
+	_, err = dbi.LoadItemsFrom(ctx, types{
+		{TypeId: 34, Name: "Tritanium", Description: "The main building block in space structures.", Published: true},
+		{TypeId: 35, Name: "Pyerite", Published: true},
+		{TypeId: 238, Name: "Antimatter Charge S", Published: true},
+		{TypeId: 230, Name: "Antimatter Charge L", Published: true},
+		{TypeId: 17470, Name: "Tritanium Test", Published: false},
+	})
+	require.NoError(t, err)
+
+	names := func(text string) []string {
+		found, err := dbi.Search(ctx, text, 0)
+		require.NoError(t, err)
+		names := []string{}
+		for _, td := range found {
+			names = append(names, td.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"Tritanium", "Tritanium Test"}, names("trit"), "prefix, published first")
+	assert.Equal(t, []string{"Tritanium", "Tritanium Test"}, names("tritanim"), "a typo")
+	assert.Equal(t, []string{"Antimatter Charge L"}, names("antimatter l"))
+	assert.Equal(t, []string{"Tritanium"}, names("building block"), "the description")
+	assert.Empty(t, names("megacyte"))
+
+	id, err := dbi.ResolveType(ctx, "tritanium")
+	require.NoError(t, err)
+	assert.Equal(t, int32(34), id)
+	id, err = dbi.ResolveType(ctx, "35")
+	require.NoError(t, err)
+	assert.Equal(t, int32(35), id)
+	_, err = dbi.ResolveType(ctx, "antimatter charge")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Antimatter Charge S (238)")
+
+	// Types stored before the index existed are indexed on the first search.
+	require.NoError(t, dbi.Close())
+	require.NoError(t, os.RemoveAll(filepath.Join(dbpath, "eveitems_bluge_idx")))
+	dbi, err = New(nil, dbpath)
+	require.NoError(t, err)
+	defer dbi.Close()
+	ids, err := dbi.ResolveTypes(ctx, []string{"Pyerite", "trit"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "matches several items")
+	assert.Nil(t, ids)
+	ids, err = dbi.ResolveTypes(ctx, []string{"Pyerite", "Tritanium"})
+	require.NoError(t, err)
+	assert.Equal(t, []int32{35, 34}, ids)
+}
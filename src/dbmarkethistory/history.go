@@ -0,0 +1,136 @@
+package dbmarkethistory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// HistoryDay is one day of market history for a type in a region, as published by ESI and everef.net.
+type HistoryDay struct {
+	RegionID   int32     `json:"region_id,omitempty"`
+	TypeID     int32     `json:"type_id,omitempty"`
+	Date       time.Time `json:"date,omitempty"`
+	Average    float64   `json:"average,omitempty"`
+	Highest    float64   `json:"highest,omitempty"`
+	Lowest     float64   `json:"lowest,omitempty"`
+	OrderCount int64     `json:"order_count,omitempty"`
+	Volume     int64     `json:"volume,omitempty"`
+}
+
+// HistoryDataDB stores daily market history snapshots in pebble, keyed by region, type and date.
+type HistoryDataDB struct {
+	pdb *pebble.DB
+}
+
+func New(dbpath string) (*HistoryDataDB, error) {
+	pebDbPath, err := db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error prepping db location: %v", err)
+	}
+	fmt.Println("Storing market history on disk in pebbledb at: ", pebDbPath)
+
+	pdb, err := pebble.Open(pebDbPath, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening: %v", err)
+	}
+
+	return &HistoryDataDB{pdb: pdb}, nil
+}
+
+func (h *HistoryDataDB) Close() error {
+	err := h.pdb.Close()
+	if err != nil {
+		return fmt.Errorf("error closing: %v", err)
+	}
+	return nil
+}
+
+// Upsert writes the history days in one batch, replacing any stored day for the same region, type and date.
+func (h *HistoryDataDB) Upsert(ctx context.Context, days []*HistoryDay) error {
+	batch := h.pdb.NewBatch()
+	defer batch.Close()
+
+	for _, day := range days {
+		data, err := json.Marshal(day)
+		if err != nil {
+			return fmt.Errorf("error marshalling history day: %v", err)
+		}
+		if err := batch.Set(HistoryKey(day.RegionID, day.TypeID, day.Date), data, nil); err != nil {
+			return fmt.Errorf("error writing to batch: %v", err)
+		}
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("error writing to db: %v", err)
+	}
+	return nil
+}
+
+// GetHistory returns the stored days for a type in a region between from and to (inclusive), oldest first.
+func (h *HistoryDataDB) GetHistory(ctx context.Context, regionID, typeID int32, from, to time.Time) ([]*HistoryDay, error) {
+	iter := h.pdb.NewIter(&pebble.IterOptions{
+		LowerBound: HistoryKey(regionID, typeID, from),
+		UpperBound: HistoryKey(regionID, typeID, to.AddDate(0, 0, 1)),
+	})
+	defer iter.Close()
+
+	days := []*HistoryDay{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var day HistoryDay
+		if err := json.Unmarshal(iter.Value(), &day); err != nil {
+			return nil, fmt.Errorf("error unmarshalling history day: %v", err)
+		}
+		days = append(days, &day)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("error iterating over history: %v", err)
+	}
+	return days, nil
+}
+
+// AveragePrice returns the volume weighted average price of a type in a region over the last n days of stored
+// history ending at to. ok is false when there is no history in that window.
+func (h *HistoryDataDB) AveragePrice(ctx context.Context, regionID, typeID int32, to time.Time, n int) (avg float64, ok bool, err error) {
+	days, err := h.GetHistory(ctx, regionID, typeID, to.AddDate(0, 0, -n), to)
+	if err != nil {
+		return 0, false, err
+	}
+	var total float64
+	var volume int64
+	for _, day := range days {
+		total += day.Average * float64(day.Volume)
+		volume += day.Volume
+	}
+	if volume == 0 {
+		return 0, false, nil
+	}
+	return total / float64(volume), true, nil
+}
+
+// HistoryKey sorts by region, then type, then date so a date range is one contiguous key range.
+func HistoryKey(regionID, typeID int32, date time.Time) []byte {
+	return []byte(strconv.Itoa(int(regionID)) + ":" + strconv.Itoa(int(typeID)) + ":" + date.UTC().Format("2006-01-02"))
+}
+
+func db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "evehistory_peb_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
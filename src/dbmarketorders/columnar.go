@@ -0,0 +1,893 @@
+package dbmarketorders
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// ColumnarOrderDB is a MarketOrderStore that keeps market orders in a compact columnar layout.
+//
+// Each order field is stored as its own fixed-width column, with rows sorted by system ID and then type ID,
+// so the orders for a system are one contiguous run of rows and the orders for a type are found through a
+// small permutation index. The columns are persisted as a single snapshot file that is memory mapped on open,
+// so queries read directly from the page cache without decoding per-field values.
+//
+// Upserts are held in memory on top of the snapshot until there are chunkSize of them, then written out as a
+// sorted chunk in the snapshot format beside it. Chunks and deletes are merged into a new snapshot on Close.
+type ColumnarOrderDB struct {
+	eveSDK EveLand
+
+	path      string
+	chunkSize int
+
+	mu      sync.RWMutex
+	snap    *columnSnapshot
+	chunks  []*columnChunk
+	pending map[int64]*evesdk.MarketOrder
+	deleted map[int64]struct{}
+
+	// pin is held when the store was opened with NewColumnar, Open keeps its own.
+	pin *generation
+}
+
+// NewColumnar opens (or creates) the current generation of the columnar order snapshot stored under dbpath.
+// The generation stays pinned until the store is closed.
+func NewColumnar(eveSDK EveLand, dbpath string) (*ColumnarOrderDB, error) {
+	dbdir, err := columnar_db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting/creating columnar database directory: %v", err)
+	}
+	gen, err := acquireCurrent(dbdir)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newColumnarAt(eveSDK, gen.dir)
+	if err != nil {
+		gen.release()
+		return nil, err
+	}
+	c.pin = gen
+	return c, nil
+}
+
+func newColumnarAt(eveSDK EveLand, dbdir string) (*ColumnarOrderDB, error) {
+	c := &ColumnarOrderDB{
+		eveSDK:    eveSDK,
+		path:      filepath.Join(dbdir, columnarSnapshotFile),
+		chunkSize: columnarChunkSize,
+		pending:   map[int64]*evesdk.MarketOrder{},
+		deleted:   map[int64]struct{}{},
+	}
+
+	snap, err := openColumnSnapshot(c.path)
+	if err != nil {
+		return nil, err
+	}
+	c.snap = snap
+
+	return c, nil
+}
+
+// RemoveColumnarDB removes the columnar snapshot directory under dbpath.
+func RemoveColumnarDB(dbpath string) error {
+	dbdir, err := columnar_db_location(dbpath)
+	if err != nil {
+		return fmt.Errorf("error getting/creating columnar database directory: %v", err)
+	}
+	if err := os.RemoveAll(dbdir); err != nil {
+		return fmt.Errorf("error removing columnar database directory: %v", err)
+	}
+	return nil
+}
+
+// LoadMarketOrders is the same as Load.
+func (c *ColumnarOrderDB) LoadMarketOrders(ctx context.Context, region *evesdk.Region) (int, error) {
+	return c.Load(ctx, region)
+}
+
+// Load fetches all market orders for the region and stages them for the next snapshot.
+func (c *ColumnarOrderDB) Load(ctx context.Context, region *evesdk.Region) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	if c.eveSDK == nil {
+		return 0, fmt.Errorf("eveSDK is nil")
+	}
+	return loadRegion(ctx, c.eveSDK, region, c.Upsert)
+}
+
+// LoadStructure fetches all market orders in the structure and stages them for the next snapshot.
+func (c *ColumnarOrderDB) LoadStructure(ctx context.Context, structureID int64) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	if c.eveSDK == nil {
+		return 0, fmt.Errorf("eveSDK is nil")
+	}
+	return loadStructure(ctx, c.eveSDK, structureID, c.Upsert)
+}
+
+// Upsert stages the orders, replacing any snapshot row with the same order ID.
+func (c *ColumnarOrderDB) Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error {
+	if c == nil {
+		return fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, order := range orders {
+		c.pending[order.OrderID] = order
+		delete(c.deleted, order.OrderID)
+	}
+	if len(c.pending) >= c.chunkSize {
+		return c.spill()
+	}
+	return nil
+}
+
+// spill writes the pending orders out as a new chunk.
+func (c *ColumnarOrderDB) spill() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	orders := make([]*evesdk.MarketOrder, 0, len(c.pending))
+	for _, order := range c.pending {
+		orders = append(orders, order)
+	}
+	columns, err := columnsOf(orders)
+	if err != nil {
+		return err
+	}
+	chunk, err := writeColumnChunk(c.path, columns)
+	if err != nil {
+		return err
+	}
+	c.chunks = append(c.chunks, chunk)
+	c.pending = map[int64]*evesdk.MarketOrder{}
+	return nil
+}
+
+// Delete hides the orders from queries and drops them from the next snapshot.
+func (c *ColumnarOrderDB) Delete(ctx context.Context, orderIDs []int64) error {
+	if c == nil {
+		return fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range orderIDs {
+		delete(c.pending, id)
+		c.deleted[id] = struct{}{}
+	}
+	return nil
+}
+
+// Query returns the orders matching q. System and type filters are answered from the snapshot indexes.
+func (c *ColumnarOrderDB) Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error) {
+	return collectQuery(ctx, q, c.StreamQuery)
+}
+
+// StreamQuery calls fn with each order matching q, decoding snapshot rows one at a time.
+func (c *ColumnarOrderDB) StreamQuery(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) error {
+	if c == nil {
+		return fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// The snapshot is layer -1, chunk i is layer i.
+	visitLayer := func(layer int, snap *columnSnapshot) error {
+		visit := func(row int) error {
+			if c.shadowed(snap.orderID[row], layer) {
+				return nil
+			}
+			order := snap.order(row)
+			if !q.Matches(order) {
+				return nil
+			}
+			return fn(order)
+		}
+
+		switch {
+		case len(q.SystemIDs) > 0:
+			for _, systemID := range distinct(q.SystemIDs) {
+				start, end := snap.systemRows(systemID)
+				for row := start; row < end; row++ {
+					if err := visit(row); err != nil {
+						return err
+					}
+				}
+			}
+		case len(q.TypeIDs) > 0:
+			for _, typeID := range distinct(q.TypeIDs) {
+				for _, row := range snap.typeRows(typeID) {
+					if err := visit(int(row)); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			for row := 0; row < snap.rowCount(); row++ {
+				if err := visit(row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := visitLayer(-1, c.snap); err != nil {
+		return err
+	}
+	for i, chunk := range c.chunks {
+		if err := visitLayer(i, chunk.columnSnapshot); err != nil {
+			return err
+		}
+	}
+
+	for _, order := range c.pending {
+		if q.Matches(order) {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// distinct returns ids without repeats, a repeated ID would visit its rows twice.
+func distinct(ids []int32) []int32 {
+	seen := make(map[int32]struct{}, len(ids))
+	out := make([]int32, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// shadowed reports whether a row of the given layer, the snapshot (-1) or a chunk, has been deleted or replaced
+// by a newer chunk or a pending order.
+func (c *ColumnarOrderDB) shadowed(orderID int64, layer int) bool {
+	if _, ok := c.pending[orderID]; ok {
+		return true
+	}
+	if _, ok := c.deleted[orderID]; ok {
+		return true
+	}
+	for _, chunk := range c.chunks[layer+1:] {
+		if chunk.contains(orderID) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMarketOrdersBySystemID returns the buy and sell orders for a system, keyed by type ID.
+// See OrderDataDB.GetMarketOrdersBySystemID for the heap ordering.
+func (c *ColumnarOrderDB) GetMarketOrdersBySystemID(ctx context.Context, systemID int32) (
+	buyOrders map[int32]*MaxHeap, sellOrders map[int32]*MinHeap, err error) {
+
+	if c == nil {
+		return nil, nil, fmt.Errorf("ColumnarOrderDB is nil")
+	}
+	return OrdersBySystemID(ctx, c, systemID)
+}
+
+// GetMarketOrdersByTypeID returns every stored order for the given type ID, across all systems.
+func (c *ColumnarOrderDB) GetMarketOrdersByTypeID(ctx context.Context, typeID int32) ([]*evesdk.MarketOrder, error) {
+	return c.Query(ctx, Query{TypeIDs: []int32{typeID}})
+}
+
+// Close writes any staged changes into a new snapshot, then unmaps the current one and removes the chunks
+// whether or not that worked.
+func (c *ColumnarOrderDB) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.flush()
+	if cerr := c.snap.close(); err == nil && cerr != nil {
+		err = fmt.Errorf("error unmapping snapshot: %v", cerr)
+	}
+	for _, chunk := range c.chunks {
+		if cerr := chunk.remove(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}
+	c.snap = nil
+	c.chunks = nil
+	c.pending = map[int64]*evesdk.MarketOrder{}
+	c.deleted = map[int64]struct{}{}
+	if rerr := c.pin.release(); err == nil && rerr != nil {
+		err = fmt.Errorf("error releasing generation %d: %v", c.pin.gen, rerr)
+	}
+	return err
+}
+
+// flush merges the snapshot, the chunks and the pending orders into a new snapshot.
+func (c *ColumnarOrderDB) flush() error {
+	if len(c.pending) == 0 && len(c.deleted) == 0 && len(c.chunks) == 0 {
+		return nil
+	}
+	if err := c.spill(); err != nil {
+		return err
+	}
+
+	layers := make([]*columnSnapshot, 0, 1+len(c.chunks))
+	layers = append(layers, c.snap)
+	refs := make([]rowRef, 0, c.snap.rowCount())
+	for layer := -1; layer < len(c.chunks); layer++ {
+		snap := c.snap
+		if layer >= 0 {
+			snap = c.chunks[layer].columnSnapshot
+			layers = append(layers, snap)
+		}
+		for row := 0; row < snap.rowCount(); row++ {
+			if !c.shadowed(snap.orderID[row], layer) {
+				refs = append(refs, rowRef{layer: uint32(layer + 1), row: uint32(row)})
+			}
+		}
+	}
+	return writeColumnSnapshot(c.path, layers, refs)
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+// Snapshot file
+//
+// The snapshot is a little endian file made of a fixed header, a dictionary of range strings and then one
+// column per field. Every section starts on an 8 byte boundary so the columns can be used in place from the
+// mapped file.
+//
+//	header:  magic[8] rows:u64 systems:u64 types:u64 ranges:u64
+//	ranges:  (len:u16 bytes)... padded to 8
+//	columns: order_id:i64 location_id:i64 price:f64 issued:i64
+//	         type_id:i32 system_id:i32 volume_total:i32 volume_remain:i32 min_volume:i32 duration:i32
+//	         flags:u8 range:u8
+//
+// flags has bit 0 set for buy orders and bit 1 for structure orders, snapshots from before structure orders
+// only ever have bit 0.
+//	indexes: system_index:(system_id,start,end)u32 type_perm:u32[rows] type_index:(type_id,start,end)u32
+
+const columnarSnapshotFile = "orders.col"
+
+// columnarChunkSize is how many upserted orders are held in memory before they're written out as a chunk.
+const columnarChunkSize = 100000
+
+var columnarMagic = [8]byte{'E', 'V', 'E', 'C', 'O', 'L', '0', '1'}
+
+const columnarHeaderSize = 8 + 4*8
+
+const (
+	flagBuy       uint8 = 1 << 0
+	flagStructure uint8 = 1 << 1
+)
+
+type columnSnapshot struct {
+	data  []byte
+	unmap func() error
+
+	rows   int
+	ranges []string
+
+	orderID      []int64
+	locationID   []int64
+	price        []float64
+	issued       []int64
+	typeID       []int32
+	systemID     []int32
+	volumeTotal  []int32
+	volumeRemain []int32
+	minVolume    []int32
+	duration     []int32
+	flags        []uint8
+	rangeCode    []uint8
+
+	systemIndex []uint32
+	typePerm    []uint32
+	typeIndex   []uint32
+}
+
+func openColumnSnapshot(path string) (*columnSnapshot, error) {
+	if !nativeLittleEndian() {
+		return nil, fmt.Errorf("columnar order snapshots require a little endian host")
+	}
+
+	data, unmap, err := mapFile(path)
+	if os.IsNotExist(err) {
+		return &columnSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error mapping snapshot %s: %v", path, err)
+	}
+	s := &columnSnapshot{data: data, unmap: unmap}
+	if err := s.decode(); err != nil {
+		_ = unmap()
+		return nil, fmt.Errorf("error decoding snapshot %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *columnSnapshot) close() error {
+	if s == nil || s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.unmap = nil
+	s.data = nil
+	return err
+}
+
+func (s *columnSnapshot) decode() error {
+	if len(s.data) < columnarHeaderSize || string(s.data[:8]) != string(columnarMagic[:]) {
+		return fmt.Errorf("not a columnar order snapshot")
+	}
+	rows := int(binary.LittleEndian.Uint64(s.data[8:]))
+	systems := int(binary.LittleEndian.Uint64(s.data[16:]))
+	types := int(binary.LittleEndian.Uint64(s.data[24:]))
+	ranges := int(binary.LittleEndian.Uint64(s.data[32:]))
+
+	off := columnarHeaderSize
+	for i := 0; i < ranges; i++ {
+		if off+2 > len(s.data) {
+			return io.ErrUnexpectedEOF
+		}
+		n := int(binary.LittleEndian.Uint16(s.data[off:]))
+		off += 2
+		if off+n > len(s.data) {
+			return io.ErrUnexpectedEOF
+		}
+		s.ranges = append(s.ranges, string(s.data[off:off+n]))
+		off += n
+	}
+	off = align8(off)
+
+	if len(s.data) < off+columnarBodySize(rows, systems, types) {
+		return io.ErrUnexpectedEOF
+	}
+	s.rows = rows
+	s.orderID = columnInt64(s.data, &off, rows)
+	s.locationID = columnInt64(s.data, &off, rows)
+	s.price = columnFloat64(s.data, &off, rows)
+	s.issued = columnInt64(s.data, &off, rows)
+	s.typeID = columnInt32(s.data, &off, rows)
+	s.systemID = columnInt32(s.data, &off, rows)
+	s.volumeTotal = columnInt32(s.data, &off, rows)
+	s.volumeRemain = columnInt32(s.data, &off, rows)
+	s.minVolume = columnInt32(s.data, &off, rows)
+	s.duration = columnInt32(s.data, &off, rows)
+	s.flags = columnUint8(s.data, &off, rows)
+	s.rangeCode = columnUint8(s.data, &off, rows)
+	s.systemIndex = columnUint32(s.data, &off, 3*systems)
+	s.typePerm = columnUint32(s.data, &off, rows)
+	s.typeIndex = columnUint32(s.data, &off, 3*types)
+	return nil
+}
+
+// systemRows returns the [start, end) row range holding the orders for systemID.
+func (s *columnSnapshot) systemRows(systemID int32) (int, int) {
+	if s == nil {
+		return 0, 0
+	}
+	n := len(s.systemIndex) / 3
+	i := sort.Search(n, func(i int) bool { return int32(s.systemIndex[3*i]) >= systemID })
+	if i == n || int32(s.systemIndex[3*i]) != systemID {
+		return 0, 0
+	}
+	return int(s.systemIndex[3*i+1]), int(s.systemIndex[3*i+2])
+}
+
+// typeRows returns the rows holding the orders for typeID.
+func (s *columnSnapshot) typeRows(typeID int32) []uint32 {
+	if s == nil {
+		return nil
+	}
+	n := len(s.typeIndex) / 3
+	i := sort.Search(n, func(i int) bool { return int32(s.typeIndex[3*i]) >= typeID })
+	if i == n || int32(s.typeIndex[3*i]) != typeID {
+		return nil
+	}
+	return s.typePerm[s.typeIndex[3*i+1]:s.typeIndex[3*i+2]]
+}
+
+// order materializes a single row.
+func (s *columnSnapshot) order(r int) *evesdk.MarketOrder {
+	o := &evesdk.MarketOrder{
+		OrderID:      s.orderID[r],
+		TypeID:       s.typeID[r],
+		LocationID:   s.locationID[r],
+		SystemID:     s.systemID[r],
+		VolumeTotal:  s.volumeTotal[r],
+		VolumeRemain: s.volumeRemain[r],
+		MinVolume:    s.minVolume[r],
+		Price:        s.price[r],
+		IsBuyOrder:   s.flags[r]&flagBuy != 0,
+		Issued:       time.Unix(0, s.issued[r]).UTC(),
+		Duration:     s.duration[r],
+
+		IsStructureOrder: s.flags[r]&flagStructure != 0,
+	}
+	if code := int(s.rangeCode[r]); code < len(s.ranges) {
+		o.Range_ = s.ranges[code]
+	}
+	return o
+}
+
+func (s *columnSnapshot) rowCount() int {
+	if s == nil {
+		return 0
+	}
+	return s.rows
+}
+
+// columnsOf lays orders out in memory the way a snapshot file does, without the indexes.
+func columnsOf(orders []*evesdk.MarketOrder) (*columnSnapshot, error) {
+	s := &columnSnapshot{rows: len(orders)}
+	codes := map[string]uint8{}
+	for _, o := range orders {
+		code, ok := codes[o.Range_]
+		if !ok {
+			if len(s.ranges) == 255 {
+				return nil, fmt.Errorf("too many distinct order ranges")
+			}
+			code = uint8(len(s.ranges))
+			codes[o.Range_] = code
+			s.ranges = append(s.ranges, o.Range_)
+		}
+		var flags uint8
+		if o.IsBuyOrder {
+			flags |= flagBuy
+		}
+		if o.IsStructureOrder {
+			flags |= flagStructure
+		}
+		s.orderID = append(s.orderID, o.OrderID)
+		s.locationID = append(s.locationID, o.LocationID)
+		s.price = append(s.price, o.Price)
+		s.issued = append(s.issued, o.Issued.UnixNano())
+		s.typeID = append(s.typeID, o.TypeID)
+		s.systemID = append(s.systemID, o.SystemID)
+		s.volumeTotal = append(s.volumeTotal, o.VolumeTotal)
+		s.volumeRemain = append(s.volumeRemain, o.VolumeRemain)
+		s.minVolume = append(s.minVolume, o.MinVolume)
+		s.duration = append(s.duration, o.Duration)
+		s.flags = append(s.flags, flags)
+		s.rangeCode = append(s.rangeCode, code)
+	}
+	return s, nil
+}
+
+// columnChunk is a batch of upserted orders written beside the snapshot in the same format. It only lives
+// until the store is closed.
+type columnChunk struct {
+	*columnSnapshot
+	path string
+	// byID holds the rows sorted by order ID.
+	byID []uint32
+}
+
+// writeColumnChunk writes the rows of s to a new chunk file beside the snapshot at path and maps it.
+func writeColumnChunk(path string, s *columnSnapshot) (*columnChunk, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".chunk-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating chunk: %v", err)
+	}
+	name := f.Name()
+	f.Close()
+
+	refs := make([]rowRef, s.rowCount())
+	for i := range refs {
+		refs[i] = rowRef{row: uint32(i)}
+	}
+	if err := writeColumnSnapshot(name, []*columnSnapshot{s}, refs); err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	written, err := openColumnSnapshot(name)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+
+	byID := make([]uint32, written.rowCount())
+	for i := range byID {
+		byID[i] = uint32(i)
+	}
+	sort.Slice(byID, func(i, j int) bool { return written.orderID[byID[i]] < written.orderID[byID[j]] })
+	return &columnChunk{columnSnapshot: written, path: name, byID: byID}, nil
+}
+
+// contains reports whether the chunk has a row for orderID.
+func (c *columnChunk) contains(orderID int64) bool {
+	i := sort.Search(len(c.byID), func(i int) bool { return c.orderID[c.byID[i]] >= orderID })
+	return i < len(c.byID) && c.orderID[c.byID[i]] == orderID
+}
+
+// remove unmaps the chunk and deletes its file.
+func (c *columnChunk) remove() error {
+	err := c.close()
+	if rerr := os.Remove(c.path); err == nil && rerr != nil {
+		err = fmt.Errorf("error removing chunk: %v", rerr)
+	}
+	return err
+}
+
+// rowRef is a row of one of the snapshots being merged by writeColumnSnapshot.
+type rowRef struct {
+	layer uint32
+	row   uint32
+}
+
+// writeColumnSnapshot writes the referenced rows of layers to path, going through a temp file so readers never
+// see a partial snapshot. Only the row references and the type index are held in memory, the columns are
+// copied from the layers one at a time.
+func writeColumnSnapshot(path string, layers []*columnSnapshot, refs []rowRef) error {
+	systemID := func(r rowRef) int32 { return layers[r.layer].systemID[r.row] }
+	typeID := func(r rowRef) int32 { return layers[r.layer].typeID[r.row] }
+	orderID := func(r rowRef) int64 { return layers[r.layer].orderID[r.row] }
+	rangeOf := func(r rowRef) string {
+		s := layers[r.layer]
+		if code := int(s.rangeCode[r.row]); code < len(s.ranges) {
+			return s.ranges[code]
+		}
+		return ""
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if systemID(a) != systemID(b) {
+			return systemID(a) < systemID(b)
+		}
+		if typeID(a) != typeID(b) {
+			return typeID(a) < typeID(b)
+		}
+		return orderID(a) < orderID(b)
+	})
+	rows := len(refs)
+
+	ranges := []string{}
+	rangeCodes := map[string]uint8{}
+	for _, r := range refs {
+		rng := rangeOf(r)
+		if _, ok := rangeCodes[rng]; ok {
+			continue
+		}
+		if len(ranges) == 255 {
+			return fmt.Errorf("too many distinct order ranges")
+		}
+		rangeCodes[rng] = uint8(len(ranges))
+		ranges = append(ranges, rng)
+	}
+
+	systemIndex := []uint32{}
+	for i := 0; i < rows; {
+		j := i
+		for j < rows && systemID(refs[j]) == systemID(refs[i]) {
+			j++
+		}
+		systemIndex = append(systemIndex, uint32(systemID(refs[i])), uint32(i), uint32(j))
+		i = j
+	}
+
+	typePerm := make([]uint32, rows)
+	for i := range typePerm {
+		typePerm[i] = uint32(i)
+	}
+	sort.SliceStable(typePerm, func(i, j int) bool { return typeID(refs[typePerm[i]]) < typeID(refs[typePerm[j]]) })
+	typeIndex := []uint32{}
+	for i := 0; i < rows; {
+		j := i
+		for j < rows && typeID(refs[typePerm[j]]) == typeID(refs[typePerm[i]]) {
+			j++
+		}
+		typeIndex = append(typeIndex, uint32(typeID(refs[typePerm[i]])), uint32(i), uint32(j))
+		i = j
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %v", err)
+	}
+	defer os.Remove(tmp)
+
+	w := &columnWriter{w: bufio.NewWriterSize(f, 1<<20)}
+	w.raw(columnarMagic[:])
+	w.u64(uint64(rows))
+	w.u64(uint64(len(systemIndex) / 3))
+	w.u64(uint64(len(typeIndex) / 3))
+	w.u64(uint64(len(ranges)))
+	for _, r := range ranges {
+		w.u16(uint16(len(r)))
+		w.raw([]byte(r))
+	}
+	w.pad()
+
+	for _, r := range refs {
+		w.u64(uint64(orderID(r)))
+	}
+	for _, r := range refs {
+		w.u64(uint64(layers[r.layer].locationID[r.row]))
+	}
+	for _, r := range refs {
+		w.f64(layers[r.layer].price[r.row])
+	}
+	for _, r := range refs {
+		w.u64(uint64(layers[r.layer].issued[r.row]))
+	}
+	for _, col := range []func(s *columnSnapshot) []int32{
+		func(s *columnSnapshot) []int32 { return s.typeID },
+		func(s *columnSnapshot) []int32 { return s.systemID },
+		func(s *columnSnapshot) []int32 { return s.volumeTotal },
+		func(s *columnSnapshot) []int32 { return s.volumeRemain },
+		func(s *columnSnapshot) []int32 { return s.minVolume },
+		func(s *columnSnapshot) []int32 { return s.duration },
+	} {
+		for _, r := range refs {
+			w.u32(uint32(col(layers[r.layer])[r.row]))
+		}
+		w.pad()
+	}
+	for _, r := range refs {
+		w.raw([]byte{layers[r.layer].flags[r.row]})
+	}
+	w.pad()
+	for _, r := range refs {
+		w.raw([]byte{rangeCodes[rangeOf(r)]})
+	}
+	w.pad()
+	for _, v := range systemIndex {
+		w.u32(v)
+	}
+	w.pad()
+	for _, v := range typePerm {
+		w.u32(v)
+	}
+	w.pad()
+	for _, v := range typeIndex {
+		w.u32(v)
+	}
+	w.pad()
+
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err == nil {
+		w.err = f.Sync()
+	}
+	if err := f.Close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return fmt.Errorf("error writing snapshot: %v", w.err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error replacing snapshot: %v", err)
+	}
+	return nil
+}
+
+type columnWriter struct {
+	w   *bufio.Writer
+	n   int
+	err error
+	buf [8]byte
+}
+
+func (c *columnWriter) raw(b []byte) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = c.w.Write(b)
+	c.n += len(b)
+}
+
+func (c *columnWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(c.buf[:], v)
+	c.raw(c.buf[:2])
+}
+
+func (c *columnWriter) u32(v uint32) {
+	binary.LittleEndian.PutUint32(c.buf[:], v)
+	c.raw(c.buf[:4])
+}
+
+func (c *columnWriter) u64(v uint64) {
+	binary.LittleEndian.PutUint64(c.buf[:], v)
+	c.raw(c.buf[:8])
+}
+
+func (c *columnWriter) f64(v float64) {
+	c.u64(math.Float64bits(v))
+}
+
+func (c *columnWriter) pad() {
+	if n := align8(c.n) - c.n; n > 0 {
+		c.raw(make([]byte, n))
+	}
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+func columnarBodySize(rows, systems, types int) int {
+	return 4*8*rows + 6*align8(4*rows) + 2*align8(rows) + align8(4*3*systems) + align8(4*rows) + align8(4*3*types)
+}
+
+func columnInt64(data []byte, off *int, n int) []int64 {
+	defer func() { *off += align8(8 * n) }()
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*int64)(unsafe.Pointer(&data[*off])), n)
+}
+
+func columnFloat64(data []byte, off *int, n int) []float64 {
+	defer func() { *off += align8(8 * n) }()
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*float64)(unsafe.Pointer(&data[*off])), n)
+}
+
+func columnInt32(data []byte, off *int, n int) []int32 {
+	defer func() { *off += align8(4 * n) }()
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*int32)(unsafe.Pointer(&data[*off])), n)
+}
+
+func columnUint32(data []byte, off *int, n int) []uint32 {
+	defer func() { *off += align8(4 * n) }()
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&data[*off])), n)
+}
+
+func columnUint8(data []byte, off *int, n int) []uint8 {
+	defer func() { *off += align8(n) }()
+	if n == 0 {
+		return nil
+	}
+	return data[*off : *off+n : *off+n]
+}
+
+func nativeLittleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+func columnar_db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "orders_columnar_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
@@ -0,0 +1,126 @@
+package dbmarketorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnarLoadMarketOrders(t *testing.T) {
+	issued := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockMarketOrders := []*evesdk.MarketOrder{
+		{OrderID: 1, Price: 2.0, SystemID: 30000142, TypeID: 42, LocationID: 60003760, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: true, Range_: "region"},
+		{OrderID: 2, Price: 66.0, SystemID: 30000142, TypeID: 24, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: true, Range_: "station"},
+		{OrderID: 3, Price: 22.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: false, Range_: "region"},
+		{OrderID: 4, Price: 10.0, SystemID: 30000123, TypeID: 42, VolumeRemain: 50, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: false, Range_: "region"},
+	}
+
+	n, err := createRandomTempSubdir()
+	if err != nil {
+		t.Fatal("error creating random temp dir: ", err)
+	}
+	dbm, err := NewColumnar(NewMockEveLand(mockMarketOrders), n)
+	if err != nil {
+		t.Fatal("error creating new ColumnarOrderDB: ", err)
+	}
+
+	cnt, err := dbm.LoadMarketOrders(context.Background(), &evesdk.Region{RegionID: 10000002, Name: "The Forge"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cnt)
+	assert.NoError(t, dbm.Close())
+
+	// Reopen so the queries are served from the mapped snapshot.
+	dbm, err = NewColumnar(nil, n)
+	if err != nil {
+		t.Fatal("error reopening ColumnarOrderDB: ", err)
+	}
+	defer dbm.Close()
+
+	bos, sos, err := dbm.GetMarketOrdersBySystemID(context.TODO(), 30000142)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(bos))
+	assert.Equal(t, 1, len(sos))
+	assert.Equal(t, mockMarketOrders[0].String(), bos[42].Peek().String())
+
+	byType, err := dbm.GetMarketOrdersByTypeID(context.TODO(), 42)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(byType))
+
+	repeated, err := dbm.Query(context.TODO(), Query{SystemIDs: []int32{30000142, 30000142}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(repeated), "a repeated system is only read once")
+	repeated, err = dbm.Query(context.TODO(), Query{TypeIDs: []int32{42, 42}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(repeated), "a repeated type is only read once")
+
+	bos, sos, err = dbm.GetMarketOrdersBySystemID(context.TODO(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(bos))
+	assert.Equal(t, 0, len(sos))
+}
+
+func TestColumnarChunks(t *testing.T) {
+	issued := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	order := func(id int64, price float64) *evesdk.MarketOrder {
+		return &evesdk.MarketOrder{OrderID: id, Price: price, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, Range_: "region"}
+	}
+	ctx := context.Background()
+
+	n, err := createRandomTempSubdir()
+	if err != nil {
+		t.Fatal("error creating random temp dir: ", err)
+	}
+	dbm, err := NewColumnar(nil, n)
+	if err != nil {
+		t.Fatal("error creating new ColumnarOrderDB: ", err)
+	}
+	dbm.chunkSize = 2
+
+	assert.NoError(t, dbm.Upsert(ctx, []*evesdk.MarketOrder{order(1, 1), order(2, 2)}))
+	assert.NoError(t, dbm.Upsert(ctx, []*evesdk.MarketOrder{order(2, 20), order(3, 3)}))
+	assert.NoError(t, dbm.Delete(ctx, []int64{3}))
+	assert.NoError(t, dbm.Upsert(ctx, []*evesdk.MarketOrder{order(4, 4)}))
+	assert.Equal(t, 2, len(dbm.chunks), "every chunkSize orders are written out")
+	assert.Equal(t, 1, len(dbm.pending))
+
+	prices := func() map[int64]float64 {
+		orders, err := dbm.Query(ctx, Query{SystemIDs: []int32{30000142}})
+		assert.NoError(t, err)
+		prices := map[int64]float64{}
+		for _, o := range orders {
+			_, dup := prices[o.OrderID]
+			assert.False(t, dup, "order %d returned twice", o.OrderID)
+			prices[o.OrderID] = o.Price
+		}
+		return prices
+	}
+	want := map[int64]float64{1: 1, 2: 20, 4: 4}
+	assert.Equal(t, want, prices())
+
+	dir := filepath.Dir(dbm.path)
+	assert.NoError(t, dbm.Close())
+	chunks, err := filepath.Glob(filepath.Join(dir, columnarSnapshotFile+".chunk-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, chunks, "chunks are removed on Close")
+
+	dbm, err = NewColumnar(nil, n)
+	if err != nil {
+		t.Fatal("error reopening ColumnarOrderDB: ", err)
+	}
+	assert.Equal(t, want, prices())
+
+	// A snapshot that can't be written still leaves nothing mapped or behind.
+	dbm.chunkSize = 1
+	assert.NoError(t, dbm.Upsert(ctx, []*evesdk.MarketOrder{order(5, 5)}))
+	assert.NoError(t, os.Mkdir(dbm.path+".tmp", 0700))
+	assert.Error(t, dbm.Close())
+	assert.Nil(t, dbm.snap)
+	chunks, err = filepath.Glob(filepath.Join(dir, columnarSnapshotFile+".chunk-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,344 @@
+package dbmarketorders
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Rebuilds never touch the index that readers are using. Each backend directory holds numbered generations:
+//
+//	orders_bluge_db/
+//	  CURRENT          the generation readers should open
+//	  gen-000003/      the current generation
+//	  gen-000002/      the previous generation, removed once no reader holds it
+//	  staging-000004/  a rebuild in progress
+//
+// A rebuild writes into a staging directory and Promote renames it to its generation directory and then
+// atomically replaces CURRENT. Readers pin the generation they opened with a shared lock on its READERS.lock
+// file, and old generations are only removed once that lock can be taken exclusively.
+//
+// Generation 0 is the backend directory itself, which is where stores built before generations lived.
+
+const (
+	currentGenerationFile = "CURRENT"
+	generationLockFile    = "READERS.lock"
+	generationPrefix      = "gen-"
+	stagingPrefix         = "staging-"
+)
+
+// generation is a reader's pin on one generation directory.
+type generation struct {
+	gen  uint64
+	dir  string
+	lock *os.File
+}
+
+// Generation returns the generation number the store was opened at.
+func (g *generation) Generation() uint64 {
+	if g == nil {
+		return 0
+	}
+	return g.gen
+}
+
+func (g *generation) release() error {
+	if g == nil || g.lock == nil {
+		return nil
+	}
+	err := unlockFile(g.lock)
+	if cerr := g.lock.Close(); err == nil {
+		err = cerr
+	}
+	g.lock = nil
+	return err
+}
+
+// generationalStore ties an open backend to the generation it was opened at, releasing the pin on Close.
+type generationalStore struct {
+	backendStore
+	*generation
+}
+
+func (s *generationalStore) Close() error {
+	err := s.backendStore.Close()
+	if rerr := s.generation.release(); err == nil && rerr != nil {
+		err = fmt.Errorf("error releasing generation %d: %v", s.gen, rerr)
+	}
+	return err
+}
+
+// Build is a market order store being built in a staging directory. Readers keep using the current
+// generation until Promote is called.
+type Build struct {
+	backendStore
+
+	root    string
+	gen     uint64
+	staging string
+	closed  bool
+}
+
+// Rebuild starts building a new generation of the backend's store under dbpath.
+func Rebuild(backend Backend, eveSDK EveLand, dbpath string, opts Options) (*Build, error) {
+	root, err := backendRoot(backend, dbpath)
+	if err != nil {
+		return nil, err
+	}
+
+	gen, err := latestGeneration(root)
+	if err != nil {
+		return nil, err
+	}
+	// Claim the next free generation number, another rebuild may be running at the same time.
+	var staging string
+	for {
+		gen++
+		staging = filepath.Join(root, fmt.Sprintf("%s%06d", stagingPrefix, gen))
+		err := os.Mkdir(staging, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("error creating staging directory: %v", err)
+		}
+	}
+
+	store, err := openBackendAt(backend, eveSDK, staging, opts)
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+
+	return &Build{backendStore: store, root: root, gen: gen, staging: staging}, nil
+}
+
+// Generation returns the generation number this build will be promoted to.
+func (b *Build) Generation() uint64 {
+	return b.gen
+}
+
+// Promote closes the build and makes it the current generation. Older generations are removed once
+// their readers have closed them.
+func (b *Build) Promote() error {
+	b.closed = true
+	if err := b.backendStore.Close(); err != nil {
+		return fmt.Errorf("error closing staged store: %v", err)
+	}
+
+	lockPath := filepath.Join(b.staging, generationLockFile)
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		return fmt.Errorf("error creating generation lock file: %v", err)
+	}
+
+	dir := generationDir(b.root, b.gen)
+	if err := os.Rename(b.staging, dir); err != nil {
+		return fmt.Errorf("error promoting staging directory: %v", err)
+	}
+
+	current := filepath.Join(b.root, currentGenerationFile)
+	tmp := current + ".tmp"
+	err := os.WriteFile(tmp, []byte(strconv.FormatUint(b.gen, 10)+"\n"), 0600)
+	if err != nil {
+		err = fmt.Errorf("error writing %s: %v", tmp, err)
+	} else if err = os.Rename(tmp, current); err != nil {
+		err = fmt.Errorf("error swapping current generation: %v", err)
+	}
+	if err != nil {
+		// Put the build back in staging so Abort can throw it away, rather than leave a generation nothing
+		// points at.
+		os.Remove(tmp)
+		if rerr := os.Rename(dir, b.staging); rerr != nil {
+			os.RemoveAll(dir)
+		}
+		return err
+	}
+
+	return CollectGenerations(b.root)
+}
+
+// Abort closes the build and throws it away. It is safe to call after a failed Promote.
+func (b *Build) Abort() error {
+	var err error
+	if !b.closed {
+		b.closed = true
+		err = b.backendStore.Close()
+	}
+	if rerr := os.RemoveAll(b.staging); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// CollectGenerations removes every generation under root that is older than the current one and has no readers.
+func CollectGenerations(root string) error {
+	current, err := currentGeneration(root)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("error listing generations: %v", err)
+	}
+	for _, e := range entries {
+		gen, ok := parseGenerationName(e.Name(), generationPrefix)
+		if !ok || gen >= current {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		lock, err := os.Open(filepath.Join(dir, generationLockFile))
+		if err != nil {
+			continue
+		}
+		if locked, err := tryLockExclusive(lock); err != nil || !locked {
+			// Still pinned by a reader, try again after the next promote.
+			lock.Close()
+			continue
+		}
+		err = os.RemoveAll(dir)
+		unlockFile(lock)
+		lock.Close()
+		if err != nil {
+			return fmt.Errorf("error removing generation %d: %v", gen, err)
+		}
+	}
+	return nil
+}
+
+// CurrentGeneration returns the generation readers of the backend's store under dbpath will open.
+func CurrentGeneration(backend Backend, dbpath string) (uint64, error) {
+	root, err := backendRoot(backend, dbpath)
+	if err != nil {
+		return 0, err
+	}
+	return currentGeneration(root)
+}
+
+// acquireCurrent pins the current generation under root with a shared lock.
+func acquireCurrent(root string) (*generation, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt == 10 {
+			return nil, fmt.Errorf("current generation under %s keeps disappearing", root)
+		}
+		gen, err := currentGeneration(root)
+		if err != nil {
+			return nil, err
+		}
+		if gen == 0 {
+			return &generation{gen: 0, dir: root}, nil
+		}
+
+		dir := generationDir(root, gen)
+		lockPath := filepath.Join(dir, generationLockFile)
+		lock, err := os.Open(lockPath)
+		if os.IsNotExist(err) {
+			// Collected between reading CURRENT and opening it, CURRENT has moved on.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error opening generation lock: %v", err)
+		}
+		if err := lockShared(lock); err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("error locking generation %d: %v", gen, err)
+		}
+		// The collector may have removed the directory while we waited for the lock.
+		if _, err := os.Stat(lockPath); os.IsNotExist(err) {
+			unlockFile(lock)
+			lock.Close()
+			continue
+		}
+		return &generation{gen: gen, dir: dir, lock: lock}, nil
+	}
+}
+
+func currentGeneration(root string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(root, currentGenerationFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading current generation: %v", err)
+	}
+	gen, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing current generation: %v", err)
+	}
+	return gen, nil
+}
+
+// latestGeneration returns the highest generation number in use under root, promoted or staging.
+func latestGeneration(root string) (uint64, error) {
+	latest, err := currentGeneration(root)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0, fmt.Errorf("error listing generations: %v", err)
+	}
+	for _, e := range entries {
+		for _, prefix := range []string{generationPrefix, stagingPrefix} {
+			if gen, ok := parseGenerationName(e.Name(), prefix); ok && gen > latest {
+				latest = gen
+			}
+		}
+	}
+	return latest, nil
+}
+
+func generationDir(root string, gen uint64) string {
+	if gen == 0 {
+		return root
+	}
+	return filepath.Join(root, fmt.Sprintf("%s%06d", generationPrefix, gen))
+}
+
+func parseGenerationName(name, prefix string) (uint64, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	gen, err := strconv.ParseUint(strings.TrimPrefix(name, prefix), 10, 64)
+	return gen, err == nil
+}
+
+func backendRoot(backend Backend, dbpath string) (string, error) {
+	var root string
+	var err error
+	switch backend {
+	case BackendBluge, "":
+		root, err = db_location(dbpath)
+	case BackendColumnar:
+		root, err = columnar_db_location(dbpath)
+	case BackendSQLite:
+		root, err = sqlite_db_location(dbpath)
+	default:
+		return "", fmt.Errorf("unknown market order backend: %q", backend)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting/creating %s database directory: %v", backend, err)
+	}
+	return root, nil
+}
+
+func openBackendAt(backend Backend, eveSDK EveLand, dir string, opts Options) (backendStore, error) {
+	var store backendStore
+	var err error
+	switch backend {
+	case BackendBluge, "":
+		store, err = newBlugeAt(eveSDK, dir, opts.BulkLoad)
+	case BackendColumnar:
+		store, err = newColumnarAt(eveSDK, dir)
+	case BackendSQLite:
+		store, err = newSQLiteAt(eveSDK, dir)
+	default:
+		return nil, fmt.Errorf("unknown market order backend: %q", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
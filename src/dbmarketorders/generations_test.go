@@ -0,0 +1,157 @@
+package dbmarketorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuildPromote(t *testing.T) {
+	region := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	first := []*evesdk.MarketOrder{
+		{OrderID: 1, Price: 2.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now(), Duration: 90, IsBuyOrder: true},
+	}
+	second := []*evesdk.MarketOrder{
+		{OrderID: 2, Price: 3.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now(), Duration: 90, IsBuyOrder: true},
+		{OrderID: 3, Price: 4.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now(), Duration: 90, IsBuyOrder: false},
+	}
+
+	for _, backend := range []Backend{BackendBluge, BackendColumnar, BackendSQLite} {
+		t.Run(string(backend), func(t *testing.T) {
+			n, err := createRandomTempSubdir()
+			if err != nil {
+				t.Fatal("error creating random temp dir: ", err)
+			}
+			ctx := context.Background()
+
+			build, err := Rebuild(backend, NewMockEveLand(first), n, Options{BulkLoad: true})
+			if err != nil {
+				t.Fatal("error starting rebuild: ", err)
+			}
+			_, err = build.Load(ctx, region)
+			assert.NoError(t, err)
+			assert.NoError(t, build.Promote())
+			assert.Equal(t, uint64(1), build.Generation())
+
+			// A reader on generation 1 keeps seeing it while generation 2 is built and promoted.
+			reader, err := Open(backend, nil, n, Options{})
+			if err != nil {
+				t.Fatal("error opening reader: ", err)
+			}
+			assert.Equal(t, uint64(1), reader.Generation())
+
+			build, err = Rebuild(backend, NewMockEveLand(second), n, Options{BulkLoad: true})
+			if err != nil {
+				t.Fatal("error starting rebuild: ", err)
+			}
+			_, err = build.Load(ctx, region)
+			assert.NoError(t, err)
+			assert.NoError(t, build.Promote())
+
+			orders, err := reader.Query(ctx, Query{})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(orders))
+
+			root, err := backendRoot(backend, n)
+			assert.NoError(t, err)
+			_, err = os.Stat(generationDir(root, 1))
+			assert.NoError(t, err, "generation 1 should survive while it has a reader")
+
+			assert.NoError(t, reader.Close())
+			assert.NoError(t, CollectGenerations(root))
+			_, err = os.Stat(generationDir(root, 1))
+			assert.True(t, os.IsNotExist(err), "generation 1 should be collected once released")
+
+			reader, err = Open(backend, nil, n, Options{})
+			if err != nil {
+				t.Fatal("error opening reader: ", err)
+			}
+			defer reader.Close()
+			assert.Equal(t, uint64(2), reader.Generation())
+			orders, err = reader.Query(ctx, Query{})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(orders))
+		})
+	}
+}
+
+func TestPromoteFailureKeepsNoGeneration(t *testing.T) {
+	n, err := createRandomTempSubdir()
+	if err != nil {
+		t.Fatal("error creating random temp dir: ", err)
+	}
+	build, err := Rebuild(BackendColumnar, NewMockEveLand(nil), n, Options{BulkLoad: true})
+	if err != nil {
+		t.Fatal("error starting rebuild: ", err)
+	}
+	root, err := backendRoot(BackendColumnar, n)
+	assert.NoError(t, err)
+
+	// A non-empty directory where CURRENT goes makes the swap fail.
+	current := filepath.Join(root, currentGenerationFile)
+	assert.NoError(t, os.MkdirAll(filepath.Join(current, "in-the-way"), 0700))
+	assert.Error(t, build.Promote())
+	_, err = os.Stat(generationDir(root, 1))
+	assert.True(t, os.IsNotExist(err), "the failed generation is moved back to staging")
+
+	assert.NoError(t, build.Abort())
+	assert.NoError(t, os.RemoveAll(current))
+	gen, err := latestGeneration(root)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), gen, "nothing is left to claim the generation number")
+}
+
+func TestConstructorsPinGeneration(t *testing.T) {
+	region := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	orders := []*evesdk.MarketOrder{
+		{OrderID: 1, Price: 2.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: time.Now(), Duration: 90, IsBuyOrder: true},
+	}
+	constructors := map[Backend]func(dbpath string) (interface{ Close() error }, error){
+		BackendBluge:    func(dbpath string) (interface{ Close() error }, error) { return New(nil, dbpath, false) },
+		BackendColumnar: func(dbpath string) (interface{ Close() error }, error) { return NewColumnar(nil, dbpath) },
+		BackendSQLite:   func(dbpath string) (interface{ Close() error }, error) { return NewSQLite(nil, dbpath) },
+	}
+
+	for backend, open := range constructors {
+		t.Run(string(backend), func(t *testing.T) {
+			n, err := createRandomTempSubdir()
+			if err != nil {
+				t.Fatal("error creating random temp dir: ", err)
+			}
+			ctx := context.Background()
+			root, err := backendRoot(backend, n)
+			assert.NoError(t, err)
+
+			promote := func() {
+				build, err := Rebuild(backend, NewMockEveLand(orders), n, Options{BulkLoad: true})
+				if err != nil {
+					t.Fatal("error starting rebuild: ", err)
+				}
+				_, err = build.Load(ctx, region)
+				assert.NoError(t, err)
+				assert.NoError(t, build.Promote())
+			}
+
+			promote()
+			store, err := open(n)
+			if err != nil {
+				t.Fatal("error opening store: ", err)
+			}
+			promote()
+
+			assert.NoError(t, CollectGenerations(root))
+			_, err = os.Stat(generationDir(root, 1))
+			assert.NoError(t, err, "generation 1 should survive while the store is open")
+
+			assert.NoError(t, store.Close())
+			assert.NoError(t, CollectGenerations(root))
+			_, err = os.Stat(generationDir(root, 1))
+			assert.True(t, os.IsNotExist(err), "generation 1 should be collected once closed")
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package dbmarketorders
+
+import "os"
+
+// Without flock readers can't pin a generation, so old generations are only removed when the
+// operating system lets go of their files.
+
+func lockShared(f *os.File) error {
+	return nil
+}
+
+func tryLockExclusive(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
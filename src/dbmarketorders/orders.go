@@ -3,7 +3,6 @@ package dbmarketorders
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,7 +12,9 @@ import (
 )
 
 type EveLand interface {
-	ListAllMarketOrdersForRegion(ctx context.Context, region *evesdk.Region) ([]*evesdk.MarketOrder, error)
+	StreamMarketOrdersForRegion(ctx context.Context, region *evesdk.Region, fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error)
+	GetStructure(ctx context.Context, structureID int64) (*evesdk.Structure, error)
+	StreamMarketOrdersForStructure(ctx context.Context, structure *evesdk.Structure, fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error)
 }
 
 type OrderDataDB struct {
@@ -24,6 +25,12 @@ type OrderDataDB struct {
 
 	index        *bluge.Writer
 	offlineIndex *bluge.OfflineWriter
+	// inserted holds the order IDs written by the offline writer, which can't replace documents. Public
+	// structure orders are listed both by their region and by their structure.
+	inserted map[int64]struct{}
+
+	// pin is held when the store was opened with New, Open keeps its own.
+	pin *generation
 }
 
 func RemoveDB(dbpath string) error {
@@ -39,16 +46,32 @@ func RemoveDB(dbpath string) error {
 	return nil
 }
 
+// New opens the current generation of the bluge backed order store. When isOffline is set the index is opened
+// with bluge's offline writer for bulk loading, otherwise with the online writer which supports upserts, deletes
+// and queries. The generation stays pinned until the store is closed.
 func New(eveSDK EveLand, dbpath string, isOffline bool) (*OrderDataDB, error) {
-	odb := &OrderDataDB{
-		eveSDK: eveSDK,
-	}
-
 	// Create the database directory if it doesn't exist
 	dbdir, err := db_location(dbpath)
 	if err != nil {
 		return nil, fmt.Errorf("error getting/creating bluge database directory: %v", err)
 	}
+	gen, err := acquireCurrent(dbdir)
+	if err != nil {
+		return nil, err
+	}
+	odb, err := newBlugeAt(eveSDK, gen.dir, isOffline)
+	if err != nil {
+		gen.release()
+		return nil, err
+	}
+	odb.pin = gen
+	return odb, nil
+}
+
+func newBlugeAt(eveSDK EveLand, dbdir string, isOffline bool) (*OrderDataDB, error) {
+	odb := &OrderDataDB{
+		eveSDK: eveSDK,
+	}
 
 	odb.dbpath = dbdir
 	config := bluge.DefaultConfig(odb.dbpath)
@@ -68,6 +91,7 @@ func New(eveSDK EveLand, dbpath string, isOffline bool) (*OrderDataDB, error) {
 			return nil, fmt.Errorf("error opening bluge index writer: %v", err)
 		}
 		odb.offlineIndex = offlineIndex
+		odb.inserted = map[int64]struct{}{}
 	}
 
 	return odb, nil
@@ -86,10 +110,13 @@ func (o *OrderDataDB) Close() error {
 	if o.offlineIndex != nil {
 		err := o.offlineIndex.Close()
 		if err != nil {
-			err = fmt.Errorf("error closing Bluge index writer: %v", err)
+			return fmt.Errorf("error closing Bluge offline index writer: %v", err)
 		}
 	}
 
+	if err := o.pin.release(); err != nil {
+		return fmt.Errorf("error releasing generation %d: %v", o.pin.gen, err)
+	}
 	return nil
 }
 
@@ -106,41 +133,46 @@ func (o *OrderDataDB) GetMarketOrdersBySystemID(ctx context.Context, systemID in
 	if o == nil {
 		return nil, nil, fmt.Errorf("OrderDataDB is nil")
 	}
+	return OrdersBySystemID(ctx, o, systemID)
+}
+
+// Query returns the orders matching q. It needs the online writer, a store opened for bulk loading can't be searched.
+func (o *OrderDataDB) Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error) {
+	return collectQuery(ctx, q, o.StreamQuery)
+}
+
+// StreamQuery calls fn with each order matching q as the index's matches are iterated. Like Query it needs the
+// online writer.
+func (o *OrderDataDB) StreamQuery(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) (err error) {
+	if o == nil {
+		return fmt.Errorf("OrderDataDB is nil")
+	}
+	if o.index == nil {
+		return fmt.Errorf("bluge index is opened for bulk loading and can't be queried")
+	}
 
 	reader, err := o.index.Reader()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error opening Bluge index reader: %v", err)
+		return fmt.Errorf("error opening Bluge index reader: %v", err)
 	}
 
 	defer func() {
-		err = reader.Close()
-		if err != nil {
-			err = fmt.Errorf("error closing Bluge index reader: %v", err)
+		cerr := reader.Close()
+		if cerr != nil && err == nil {
+			err = fmt.Errorf("error closing Bluge index reader: %v", cerr)
 		}
 	}()
 
-	query := bluge.
-		NewNumericRangeQuery(float64(systemID), float64(systemID+1)).
-		// NewNumericRangeQuery(0, 1000000000000000000).
-		SetField("system_id")
-	request := bluge.NewAllMatches(query).WithStandardAggregations()
-
-	// request := bluge.NewAllMatches(bluge.NewMatchAllQuery()).WithStandardAggregations()
+	request := bluge.NewAllMatches(blugeQuery(q)).WithStandardAggregations()
 
-	results, err := reader.Search(context.Background(), request)
+	results, err := reader.Search(ctx, request)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error searching index: %v", err)
+		return fmt.Errorf("error searching index: %v", err)
 	}
 
-	buyOrders = map[int32]*MaxHeap{}
-	sellOrders = map[int32]*MinHeap{}
-
 	// iterate through the document matches
 	match, err := results.Next()
-	i := 0
 	for err == nil && match != nil {
-		// fmt.Printf("Found %v matches, err: %v, match: %v", i, err, match)
-
 		var order *evesdk.MarketOrder = &evesdk.MarketOrder{}
 		// load the identifier for this match
 		err = match.VisitStoredFields(func(field string, bv []byte) bool {
@@ -181,42 +213,73 @@ func (o *OrderDataDB) GetMarketOrdersBySystemID(ctx context.Context, systemID in
 				order.Duration = int32(tmp)
 			case "range":
 				order.Range_ = string(value)
+			case "is_structure_order":
+				order.IsStructureOrder, _ = strconv.ParseBool(string(value))
 			default:
-				fmt.Printf("Unknown field: %v\n", field)
+				// Fields this version doesn't know, e.g. written by a newer one, are skipped.
 			}
 			return true
 		})
 		if err != nil {
-			log.Fatalf("error loading stored fields: %v", err)
+			return fmt.Errorf("error loading stored fields: %v", err)
 		}
 
-		if order.IsBuyOrder {
-			bos, ok := buyOrders[order.TypeID]
-			if !ok {
-				bos = NewMaxHeap()
-				buyOrders[order.TypeID] = bos
-			}
-			bos.Push(order)
-		} else {
-			sos, ok := sellOrders[order.TypeID]
-			if !ok {
-				sos = NewMinHeap()
-				sellOrders[order.TypeID] = sos
-			}
-			sos.Push(order)
+		if err := fn(order); err != nil {
+			return err
 		}
 
 		// load the next document match
 		match, err = results.Next()
-		i = i + 1
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("error iterating through results: %v", err)
+		return fmt.Errorf("error iterating through results: %v", err)
+	}
+	return nil
+}
+
+// blugeQuery translates a Query into a bluge query over the indexed order fields.
+func blugeQuery(q Query) bluge.Query {
+	bq := bluge.NewBooleanQuery()
+	filtered := false
+
+	if len(q.SystemIDs) > 0 {
+		bq.AddMust(numericAnyOf("system_id", q.SystemIDs))
+		filtered = true
+	}
+	if len(q.TypeIDs) > 0 {
+		bq.AddMust(numericAnyOf("type_id", q.TypeIDs))
+		filtered = true
+	}
+	switch q.OrderType {
+	case BuyOrders:
+		bq.AddMust(bluge.NewTermQuery("true").SetField("is_buy_order"))
+		filtered = true
+	case SellOrders:
+		bq.AddMust(bluge.NewTermQuery("false").SetField("is_buy_order"))
+		filtered = true
+	}
+
+	if !filtered {
+		return bluge.NewMatchAllQuery()
+	}
+	return bq
+}
+
+func numericAnyOf(field string, ids []int32) bluge.Query {
+	bq := bluge.NewBooleanQuery()
+	for _, id := range ids {
+		bq.AddShould(bluge.NewNumericRangeQuery(float64(id), float64(id+1)).SetField(field))
 	}
-	return buyOrders, sellOrders, nil
+	return bq
 }
 
+// LoadMarketOrders is kept for callers that predate MarketOrderStore, it is the same as Load.
 func (o *OrderDataDB) LoadMarketOrders(ctx context.Context, region *evesdk.Region) (found int, err error) {
+	return o.Load(ctx, region)
+}
+
+// Load lists every market order for the region and writes them to the index.
+func (o *OrderDataDB) Load(ctx context.Context, region *evesdk.Region) (found int, err error) {
 
 	// List all market orders.
 	if o == nil {
@@ -225,40 +288,96 @@ func (o *OrderDataDB) LoadMarketOrders(ctx context.Context, region *evesdk.Regio
 	if o.eveSDK == nil {
 		return 0, fmt.Errorf("eveSDK is nil")
 	}
-	orders, err := o.eveSDK.ListAllMarketOrdersForRegion(ctx, region)
-	if err != nil {
-		return 0, fmt.Errorf("error while trying to list all market orders: %v", err)
+	return loadRegion(ctx, o.eveSDK, region, o.Upsert)
+}
+
+// LoadStructure lists every market order in the structure and writes them to the index.
+func (o *OrderDataDB) LoadStructure(ctx context.Context, structureID int64) (int, error) {
+	if o == nil {
+		return 0, fmt.Errorf("OrderDataDB is nil")
+	}
+	if o.eveSDK == nil {
+		return 0, fmt.Errorf("eveSDK is nil")
 	}
+	return loadStructure(ctx, o.eveSDK, structureID, o.Upsert)
+}
 
-	count := 0
-	for _, order := range orders {
-		orderIdAsBytes := OrderIdKey(order.OrderID)
+// Upsert writes the orders to the index, replacing any existing document for the same order ID.
+// In bulk load mode the offline writer can't replace documents, so orders already inserted are skipped.
+func (o *OrderDataDB) Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error {
+	if o == nil {
+		return fmt.Errorf("OrderDataDB is nil")
+	}
 
-		//doc := bluge.NewDocument(orderIdAsBytes)
-		isBuyOrder := "false"
-		if order.IsBuyOrder {
-			isBuyOrder = "true"
+	if o.offlineIndex != nil {
+		for _, order := range orders {
+			if _, ok := o.inserted[order.OrderID]; ok {
+				continue
+			}
+			if err := o.offlineIndex.Insert(orderDocument(order)); err != nil {
+				return fmt.Errorf("error inserting order %d: %v", order.OrderID, err)
+			}
+			o.inserted[order.OrderID] = struct{}{}
 		}
-		doc := bluge.NewDocument(orderIdAsBytes).
-			AddField(bluge.NewNumericField("order_id", float64(order.OrderID)).StoreValue()).
-			AddField(bluge.NewNumericField("type_id", float64(order.TypeID)).StoreValue()).
-			AddField(bluge.NewNumericField("location_id", float64(order.LocationID)).StoreValue()).
-			AddField(bluge.NewNumericField("system_id", float64(order.SystemID)).StoreValue()).
-			AddField(bluge.NewNumericField("volume_total", float64(order.VolumeTotal)).StoreValue()).
-			AddField(bluge.NewNumericField("volume_remain", float64(order.VolumeRemain)).StoreValue()).
-			AddField(bluge.NewNumericField("min_volume", float64(order.MinVolume)).StoreValue()).
-			AddField(bluge.NewNumericField("price", order.Price).StoreValue()).
-			AddField(bluge.NewTextField("is_buy_order", isBuyOrder).StoreValue()).
-			AddField(bluge.NewDateTimeField("issued", order.Issued).StoreValue()).
-			AddField(bluge.NewNumericField("duration", float64(order.Duration)).StoreValue()).
-			AddField(bluge.NewTextField("range", order.Range_).StoreValue())
-
-		o.offlineIndex.Insert(doc)
-
-		count = count + 1
-	}
-
-	return count, nil
+		return nil
+	}
+
+	batch := bluge.NewBatch()
+	for _, order := range orders {
+		doc := orderDocument(order)
+		batch.Update(doc.ID(), doc)
+	}
+	if err := o.index.Batch(batch); err != nil {
+		return fmt.Errorf("error writing batch to Bluge index: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the orders from the index. It isn't supported in bulk load mode.
+func (o *OrderDataDB) Delete(ctx context.Context, orderIDs []int64) error {
+	if o == nil {
+		return fmt.Errorf("OrderDataDB is nil")
+	}
+	if o.index == nil {
+		return fmt.Errorf("bluge index is opened for bulk loading and can't delete orders")
+	}
+
+	batch := bluge.NewBatch()
+	for _, id := range orderIDs {
+		batch.Delete(bluge.Identifier(OrderIdKey(id)))
+	}
+	if err := o.index.Batch(batch); err != nil {
+		return fmt.Errorf("error deleting from Bluge index: %v", err)
+	}
+	return nil
+}
+
+func orderDocument(order *evesdk.MarketOrder) *bluge.Document {
+	orderIdAsBytes := OrderIdKey(order.OrderID)
+
+	isBuyOrder := "false"
+	if order.IsBuyOrder {
+		isBuyOrder = "true"
+	}
+	// Documents written before structure orders don't have the field, they read back as station orders.
+	isStructureOrder := "false"
+	if order.IsStructureOrder {
+		isStructureOrder = "true"
+	}
+	return bluge.NewDocument(orderIdAsBytes).
+		AddField(bluge.NewNumericField("order_id", float64(order.OrderID)).StoreValue()).
+		AddField(bluge.NewNumericField("type_id", float64(order.TypeID)).StoreValue()).
+		AddField(bluge.NewNumericField("location_id", float64(order.LocationID)).StoreValue()).
+		AddField(bluge.NewNumericField("system_id", float64(order.SystemID)).StoreValue()).
+		AddField(bluge.NewNumericField("volume_total", float64(order.VolumeTotal)).StoreValue()).
+		AddField(bluge.NewNumericField("volume_remain", float64(order.VolumeRemain)).StoreValue()).
+		AddField(bluge.NewNumericField("min_volume", float64(order.MinVolume)).StoreValue()).
+		AddField(bluge.NewNumericField("price", order.Price).StoreValue()).
+		AddField(bluge.NewTextField("is_buy_order", isBuyOrder).StoreValue()).
+		AddField(bluge.NewDateTimeField("issued", order.Issued).StoreValue()).
+		AddField(bluge.NewNumericField("duration", float64(order.Duration)).StoreValue()).
+		AddField(bluge.NewTextField("range", order.Range_).StoreValue()).
+		AddField(bluge.NewTextField("is_structure_order", isStructureOrder).StoreValue())
 }
 
 func OrderIdKey(orderId int64) string {
@@ -15,7 +15,8 @@ import (
 )
 
 type MockEveLand struct {
-	marketOrders []*evesdk.MarketOrder
+	marketOrders    []*evesdk.MarketOrder
+	structureOrders []*evesdk.MarketOrder
 }
 
 func NewMockEveLand(marketOrders []*evesdk.MarketOrder) *MockEveLand {
@@ -24,8 +25,16 @@ func NewMockEveLand(marketOrders []*evesdk.MarketOrder) *MockEveLand {
 	}
 }
 
-func (m *MockEveLand) ListAllMarketOrdersForRegion(ctx context.Context, region *evesdk.Region) ([]*evesdk.MarketOrder, error) {
-	return m.marketOrders, nil
+func (m *MockEveLand) StreamMarketOrdersForRegion(ctx context.Context, region *evesdk.Region, fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error) {
+	return &evesdk.PageReport{Pages: 1}, fn(m.marketOrders)
+}
+
+func (m *MockEveLand) GetStructure(ctx context.Context, structureID int64) (*evesdk.Structure, error) {
+	return &evesdk.Structure{StructureID: structureID, Name: "Perimeter - Tranquility Trading Tower", SolarSystemID: 30000144}, nil
+}
+
+func (m *MockEveLand) StreamMarketOrdersForStructure(ctx context.Context, structure *evesdk.Structure, fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error) {
+	return &evesdk.PageReport{Pages: 1}, fn(m.structureOrders)
 }
 
 func TestLoadMarketOrders(t *testing.T) {
@@ -0,0 +1,283 @@
+package dbmarketorders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteOrdersFile = "orders.sqlite"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS market_orders (
+	order_id      INTEGER PRIMARY KEY,
+	type_id       INTEGER NOT NULL,
+	location_id   INTEGER NOT NULL,
+	system_id     INTEGER NOT NULL,
+	volume_total  INTEGER NOT NULL,
+	volume_remain INTEGER NOT NULL,
+	min_volume    INTEGER NOT NULL,
+	price         REAL    NOT NULL,
+	is_buy_order  INTEGER NOT NULL,
+	issued        INTEGER NOT NULL,
+	duration      INTEGER NOT NULL,
+	range         TEXT    NOT NULL,
+	is_structure_order INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS market_orders_system_type ON market_orders (system_id, type_id);
+CREATE INDEX IF NOT EXISTS market_orders_type ON market_orders (type_id);
+`
+
+const sqliteOrderColumns = `order_id, type_id, location_id, system_id, volume_total, volume_remain, min_volume,
+	price, is_buy_order, issued, duration, range, is_structure_order`
+
+// SQLiteOrderDB is a MarketOrderStore backed by a single sqlite table.
+type SQLiteOrderDB struct {
+	eveSDK EveLand
+
+	db *sql.DB
+
+	// pin is held when the store was opened with NewSQLite, Open keeps its own.
+	pin *generation
+}
+
+// NewSQLite opens (or creates) the current generation of the sqlite order database under dbpath. The
+// generation stays pinned until the store is closed.
+func NewSQLite(eveSDK EveLand, dbpath string) (*SQLiteOrderDB, error) {
+	dbdir, err := sqlite_db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting/creating sqlite database directory: %v", err)
+	}
+	gen, err := acquireCurrent(dbdir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSQLiteAt(eveSDK, gen.dir)
+	if err != nil {
+		gen.release()
+		return nil, err
+	}
+	s.pin = gen
+	return s, nil
+}
+
+func newSQLiteAt(eveSDK EveLand, dbdir string) (*SQLiteOrderDB, error) {
+	db, err := sql.Open("sqlite3", filepath.Join(dbdir, sqliteOrdersFile))
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite order database: %v", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating market_orders table: %v", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteOrderDB{eveSDK: eveSDK, db: db}, nil
+}
+
+// migrateSQLite adds the columns that tables created by earlier versions are missing.
+func migrateSQLite(db *sql.DB) error {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('market_orders') WHERE name = 'is_structure_order'").Scan(&n)
+	if err != nil {
+		return fmt.Errorf("error reading market_orders columns: %v", err)
+	}
+	if n == 0 {
+		if _, err := db.Exec("ALTER TABLE market_orders ADD COLUMN is_structure_order INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return fmt.Errorf("error adding is_structure_order column: %v", err)
+		}
+	}
+	return nil
+}
+
+// RemoveSQLiteDB removes the sqlite order database directory under dbpath.
+func RemoveSQLiteDB(dbpath string) error {
+	dbdir, err := sqlite_db_location(dbpath)
+	if err != nil {
+		return fmt.Errorf("error getting/creating sqlite database directory: %v", err)
+	}
+	if err := os.RemoveAll(dbdir); err != nil {
+		return fmt.Errorf("error removing sqlite database directory: %v", err)
+	}
+	return nil
+}
+
+// Load lists every market order for the region and writes them to the table.
+func (s *SQLiteOrderDB) Load(ctx context.Context, region *evesdk.Region) (int, error) {
+	if s == nil {
+		return 0, fmt.Errorf("SQLiteOrderDB is nil")
+	}
+	if s.eveSDK == nil {
+		return 0, fmt.Errorf("eveSDK is nil")
+	}
+	return loadRegion(ctx, s.eveSDK, region, s.Upsert)
+}
+
+// LoadStructure lists every market order in the structure and writes them to the table.
+func (s *SQLiteOrderDB) LoadStructure(ctx context.Context, structureID int64) (int, error) {
+	if s == nil {
+		return 0, fmt.Errorf("SQLiteOrderDB is nil")
+	}
+	if s.eveSDK == nil {
+		return 0, fmt.Errorf("eveSDK is nil")
+	}
+	return loadStructure(ctx, s.eveSDK, structureID, s.Upsert)
+}
+
+// Upsert writes the orders in a single transaction, replacing rows with the same order ID.
+func (s *SQLiteOrderDB) Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error {
+	if s == nil {
+		return fmt.Errorf("SQLiteOrderDB is nil")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT OR REPLACE INTO market_orders ("+sqliteOrderColumns+
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("error preparing upsert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, o := range orders {
+		_, err := stmt.ExecContext(ctx, o.OrderID, o.TypeID, o.LocationID, o.SystemID, o.VolumeTotal, o.VolumeRemain,
+			o.MinVolume, o.Price, o.IsBuyOrder, o.Issued.UnixNano(), o.Duration, o.Range_, o.IsStructureOrder)
+		if err != nil {
+			return fmt.Errorf("error upserting order %d: %v", o.OrderID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing orders: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the orders with the given IDs.
+func (s *SQLiteOrderDB) Delete(ctx context.Context, orderIDs []int64) error {
+	if s == nil {
+		return fmt.Errorf("SQLiteOrderDB is nil")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range orderIDs {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM market_orders WHERE order_id = ?", id); err != nil {
+			return fmt.Errorf("error deleting order %d: %v", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing deletes: %v", err)
+	}
+	return nil
+}
+
+// Query returns the orders matching q.
+func (s *SQLiteOrderDB) Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error) {
+	return collectQuery(ctx, q, s.StreamQuery)
+}
+
+// StreamQuery calls fn with each order matching q as it is read from the database.
+func (s *SQLiteOrderDB) StreamQuery(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) error {
+	if s == nil {
+		return fmt.Errorf("SQLiteOrderDB is nil")
+	}
+
+	where := []string{}
+	args := []interface{}{}
+	if len(q.SystemIDs) > 0 {
+		where = append(where, "system_id IN ("+placeholders(len(q.SystemIDs))+")")
+		for _, id := range q.SystemIDs {
+			args = append(args, id)
+		}
+	}
+	if len(q.TypeIDs) > 0 {
+		where = append(where, "type_id IN ("+placeholders(len(q.TypeIDs))+")")
+		for _, id := range q.TypeIDs {
+			args = append(args, id)
+		}
+	}
+	switch q.OrderType {
+	case BuyOrders:
+		where = append(where, "is_buy_order = 1")
+	case SellOrders:
+		where = append(where, "is_buy_order = 0")
+	}
+
+	query := "SELECT " + sqliteOrderColumns + " FROM market_orders"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying market orders: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		o := &evesdk.MarketOrder{}
+		var issued int64
+		err := rows.Scan(&o.OrderID, &o.TypeID, &o.LocationID, &o.SystemID, &o.VolumeTotal, &o.VolumeRemain,
+			&o.MinVolume, &o.Price, &o.IsBuyOrder, &issued, &o.Duration, &o.Range_, &o.IsStructureOrder)
+		if err != nil {
+			return fmt.Errorf("error scanning market order: %v", err)
+		}
+		o.Issued = time.Unix(0, issued).UTC()
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over market orders: %v", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLiteOrderDB) Close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.db.Close()
+	if rerr := s.pin.release(); err == nil && rerr != nil {
+		err = fmt.Errorf("error releasing generation %d: %v", s.pin.gen, rerr)
+	}
+	return err
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func sqlite_db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "orders_sqlite_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
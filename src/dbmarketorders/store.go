@@ -0,0 +1,239 @@
+package dbmarketorders
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// MarketOrderStore is the storage interface for market orders. The cmd package only talks to this interface,
+// the concrete backend is picked by Open.
+type MarketOrderStore interface {
+	// Load fetches every market order for the region from ESI and stores them.
+	Load(ctx context.Context, region *evesdk.Region) (int, error)
+	// LoadStructure fetches every market order in a player structure from ESI and stores them flagged as
+	// structure orders. ctx must be authenticated as a character with access to the structure's market.
+	LoadStructure(ctx context.Context, structureID int64) (int, error)
+	// Upsert inserts the orders, replacing any stored order with the same order ID.
+	Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error
+	// Delete removes the orders with the given order IDs.
+	Delete(ctx context.Context, orderIDs []int64) error
+	// Query returns the stored orders matching q.
+	Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error)
+	// StreamQuery calls fn with each stored order matching q instead of collecting them, so exporting a whole
+	// region doesn't hold it in memory. fn must not modify the store, an error from fn stops the query and is
+	// returned as is.
+	StreamQuery(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) error
+	// Close flushes and closes the store.
+	Close() error
+	// Generation returns the generation of the store being read, or being built for a Rebuild.
+	Generation() uint64
+}
+
+// backendStore is what each storage backend implements, generations are layered on top of it.
+type backendStore interface {
+	Load(ctx context.Context, region *evesdk.Region) (int, error)
+	LoadStructure(ctx context.Context, structureID int64) (int, error)
+	Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error
+	Delete(ctx context.Context, orderIDs []int64) error
+	Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error)
+	StreamQuery(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) error
+	Close() error
+}
+
+// collectQuery implements Query on top of a backend's StreamQuery.
+func collectQuery(ctx context.Context, q Query, stream func(ctx context.Context, q Query, fn func(order *evesdk.MarketOrder) error) error) ([]*evesdk.MarketOrder, error) {
+	orders := []*evesdk.MarketOrder{}
+	err := stream(ctx, q, func(order *evesdk.MarketOrder) error {
+		orders = append(orders, order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// OrderType filters orders by side.
+type OrderType int
+
+const (
+	AllOrders OrderType = iota
+	BuyOrders
+	SellOrders
+)
+
+// Query describes which orders to return from MarketOrderStore.Query. Empty ID lists match everything.
+type Query struct {
+	SystemIDs []int32
+	TypeIDs   []int32
+	OrderType OrderType
+}
+
+// Matches reports whether the order satisfies the query.
+func (q Query) Matches(order *evesdk.MarketOrder) bool {
+	switch q.OrderType {
+	case BuyOrders:
+		if !order.IsBuyOrder {
+			return false
+		}
+	case SellOrders:
+		if order.IsBuyOrder {
+			return false
+		}
+	}
+	return containsID(q.SystemIDs, order.SystemID) && containsID(q.TypeIDs, order.TypeID)
+}
+
+func containsID(ids []int32, id int32) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Backend names a market order storage backend.
+type Backend string
+
+const (
+	// BackendBluge stores orders as documents in a bluge index.
+	BackendBluge Backend = "bluge"
+	// BackendColumnar stores orders in a memory mapped columnar snapshot.
+	BackendColumnar Backend = "columnar"
+	// BackendSQLite stores orders in a sqlite table.
+	BackendSQLite Backend = "sqlite"
+)
+
+// Options controls how a store is opened.
+type Options struct {
+	// BulkLoad opens the store for a one-shot bulk load. The bluge backend uses its offline writer in this mode,
+	// which is much faster but can only insert and cannot be queried until it is closed.
+	BulkLoad bool
+}
+
+// Open opens the current generation of the market order store for the given backend. The generation stays
+// pinned, and won't be removed by a concurrent rebuild, until the store is closed.
+func Open(backend Backend, eveSDK EveLand, dbpath string, opts Options) (MarketOrderStore, error) {
+	root, err := backendRoot(backend, dbpath)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := acquireCurrent(root)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openBackendAt(backend, eveSDK, gen.dir, opts)
+	if err != nil {
+		gen.release()
+		return nil, err
+	}
+	return &generationalStore{backendStore: store, generation: gen}, nil
+}
+
+// Remove removes the on disk data for the given backend.
+func Remove(backend Backend, dbpath string) error {
+	switch backend {
+	case BackendBluge, "":
+		return RemoveDB(dbpath)
+	case BackendColumnar:
+		return RemoveColumnarDB(dbpath)
+	case BackendSQLite:
+		return RemoveSQLiteDB(dbpath)
+	default:
+		return fmt.Errorf("unknown market order backend: %q", backend)
+	}
+}
+
+// loadRegion streams the region's market orders from ESI into upsert a page at a time, so a large region is
+// never held in memory all at once. It fails if any page couldn't be fetched, rather than store a region with
+// orders missing.
+func loadRegion(ctx context.Context, eveSDK EveLand, region *evesdk.Region, upsert func(ctx context.Context, orders []*evesdk.MarketOrder) error) (int, error) {
+	return loadOrders(ctx, "region "+region.Name, upsert, func(fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error) {
+		return eveSDK.StreamMarketOrdersForRegion(ctx, region, fn)
+	})
+}
+
+// loadStructure is loadRegion for a player structure's market, looking the structure up first for its system.
+func loadStructure(ctx context.Context, eveSDK EveLand, structureID int64, upsert func(ctx context.Context, orders []*evesdk.MarketOrder) error) (int, error) {
+	structure, err := eveSDK.GetStructure(ctx, structureID)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up structure %d: %v", structureID, err)
+	}
+	return loadOrders(ctx, "structure "+structure.Name, upsert, func(fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error) {
+		return eveSDK.StreamMarketOrdersForStructure(ctx, structure, fn)
+	})
+}
+
+func loadOrders(ctx context.Context, market string, upsert func(ctx context.Context, orders []*evesdk.MarketOrder) error,
+	stream func(fn func(orders []*evesdk.MarketOrder) error) (*evesdk.PageReport, error)) (int, error) {
+
+	found := 0
+	report, err := stream(func(orders []*evesdk.MarketOrder) error {
+		if err := upsert(ctx, orders); err != nil {
+			return err
+		}
+		found += len(orders)
+		return nil
+	})
+	if err != nil {
+		return found, fmt.Errorf("error while trying to list all market orders: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		return found, fmt.Errorf("incomplete market orders for %s: %v", market, err)
+	}
+	if report.Stale {
+		fmt.Printf("warning: market orders for %s are stale, served from cache %v old\n", market, report.Age.Round(time.Second))
+	}
+	return found, nil
+}
+
+// Querier is the read side of a MarketOrderStore.
+type Querier interface {
+	Query(ctx context.Context, q Query) ([]*evesdk.MarketOrder, error)
+}
+
+// OrdersBySystemID returns a map of buy orders and a map of sell orders for a given system ID, keyed by type ID.
+//
+// The SellOrders/MinHeap is sorted in ascending order, so the lowest price is at the top.
+// The BuyOrders/MaxHeap is sorted in descending order, so the highest price is at the top.
+func OrdersBySystemID(ctx context.Context, store Querier, systemID int32) (
+	buyOrders map[int32]*MaxHeap, sellOrders map[int32]*MinHeap, err error) {
+
+	orders, err := store.Query(ctx, Query{SystemIDs: []int32{systemID}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buyOrders = map[int32]*MaxHeap{}
+	sellOrders = map[int32]*MinHeap{}
+	for _, order := range orders {
+		addToHeaps(buyOrders, sellOrders, order)
+	}
+	return buyOrders, sellOrders, nil
+}
+
+func addToHeaps(buyOrders map[int32]*MaxHeap, sellOrders map[int32]*MinHeap, order *evesdk.MarketOrder) {
+	if order.IsBuyOrder {
+		bos, ok := buyOrders[order.TypeID]
+		if !ok {
+			bos = NewMaxHeap()
+			buyOrders[order.TypeID] = bos
+		}
+		heap.Push(bos, order)
+	} else {
+		sos, ok := sellOrders[order.TypeID]
+		if !ok {
+			sos = NewMinHeap()
+			sellOrders[order.TypeID] = sos
+		}
+		heap.Push(sos, order)
+	}
+}
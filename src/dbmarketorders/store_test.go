@@ -0,0 +1,143 @@
+package dbmarketorders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarketOrderStoreBackends(t *testing.T) {
+	issued := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	orders := []*evesdk.MarketOrder{
+		{OrderID: 1, Price: 2.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: true, Range_: "region"},
+		{OrderID: 2, Price: 66.0, SystemID: 30000142, TypeID: 24, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: true, Range_: "station"},
+		{OrderID: 3, Price: 22.0, SystemID: 30000142, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: false, Range_: "region"},
+		{OrderID: 4, Price: 10.0, SystemID: 30000123, TypeID: 42, VolumeRemain: 50, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: false, Range_: "region"},
+	}
+
+	structureOrders := []*evesdk.MarketOrder{
+		{OrderID: 5, Price: 9.0, SystemID: 30000144, LocationID: 1028858195912, TypeID: 42, VolumeRemain: 10, VolumeTotal: 10, Issued: issued, Duration: 90, Range_: "station", IsStructureOrder: true},
+	}
+
+	for _, backend := range []Backend{BackendBluge, BackendColumnar, BackendSQLite} {
+		t.Run(string(backend), func(t *testing.T) {
+			n, err := createRandomTempSubdir()
+			if err != nil {
+				t.Fatal("error creating random temp dir: ", err)
+			}
+			eveSDK := NewMockEveLand(orders)
+			eveSDK.structureOrders = structureOrders
+			store, err := Open(backend, eveSDK, n, Options{})
+			if err != nil {
+				t.Fatal("error opening store: ", err)
+			}
+			defer func() { store.Close() }()
+			ctx := context.Background()
+
+			cnt, err := store.Load(ctx, &evesdk.Region{RegionID: 10000002, Name: "The Forge"})
+			assert.NoError(t, err)
+			assert.Equal(t, 4, cnt)
+
+			res, err := store.Query(ctx, Query{TypeIDs: []int32{42}, OrderType: SellOrders})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(res))
+
+			updated := *orders[2]
+			updated.Price = 21.5
+			assert.NoError(t, store.Upsert(ctx, []*evesdk.MarketOrder{&updated}))
+			assert.NoError(t, store.Delete(ctx, []int64{4}))
+
+			res, err = store.Query(ctx, Query{TypeIDs: []int32{42}, OrderType: SellOrders})
+			assert.NoError(t, err)
+			if assert.Equal(t, 1, len(res)) {
+				assert.Equal(t, 21.5, res[0].Price)
+			}
+
+			bos, sos, err := OrdersBySystemID(ctx, store, 30000142)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(bos))
+			assert.Equal(t, 1, len(sos))
+
+			// Structure orders share the index and keep their flag, across a reopen too.
+			cnt, err = store.LoadStructure(ctx, 1028858195912)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, cnt)
+			assert.NoError(t, store.Close())
+			store, err = Open(backend, eveSDK, n, Options{})
+			if err != nil {
+				t.Fatal("error reopening store: ", err)
+			}
+			res, err = store.Query(ctx, Query{TypeIDs: []int32{42}, OrderType: SellOrders})
+			assert.NoError(t, err)
+			structure := map[int64]bool{}
+			for _, o := range res {
+				structure[o.OrderID] = o.IsStructureOrder
+			}
+			assert.Equal(t, map[int64]bool{3: false, 5: true}, structure)
+
+			// StreamQuery hands over the same orders one at a time and stops at fn's first error.
+			streamed := 0
+			err = store.StreamQuery(ctx, Query{SystemIDs: []int32{30000142}}, func(order *evesdk.MarketOrder) error {
+				streamed++
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, streamed)
+			stop := errors.New("stop")
+			streamed = 0
+			err = store.StreamQuery(ctx, Query{}, func(order *evesdk.MarketOrder) error {
+				streamed++
+				return stop
+			})
+			assert.Equal(t, stop, err)
+			assert.Equal(t, 1, streamed)
+		})
+	}
+}
+
+func TestBulkLoadSkipsRepeatedOrders(t *testing.T) {
+	issued := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	// A public structure's orders are listed by its region as well as by the structure.
+	public := &evesdk.MarketOrder{OrderID: 5, Price: 9.0, SystemID: 30000144, LocationID: 1028858195912, TypeID: 42, VolumeRemain: 10, VolumeTotal: 10, Issued: issued, Duration: 90, Range_: "station", IsStructureOrder: true}
+	orders := []*evesdk.MarketOrder{
+		{OrderID: 1, Price: 2.0, SystemID: 30000142, LocationID: 60003760, TypeID: 42, VolumeRemain: 100, VolumeTotal: 100, Issued: issued, Duration: 90, IsBuyOrder: true, Range_: "region"},
+		public,
+	}
+
+	for _, backend := range []Backend{BackendBluge, BackendColumnar, BackendSQLite} {
+		t.Run(string(backend), func(t *testing.T) {
+			n, err := createRandomTempSubdir()
+			if err != nil {
+				t.Fatal("error creating random temp dir: ", err)
+			}
+			eveSDK := NewMockEveLand(orders)
+			eveSDK.structureOrders = []*evesdk.MarketOrder{public}
+			ctx := context.Background()
+
+			build, err := Rebuild(backend, eveSDK, n, Options{BulkLoad: true})
+			if err != nil {
+				t.Fatal("error starting rebuild: ", err)
+			}
+			_, err = build.Load(ctx, &evesdk.Region{RegionID: 10000002, Name: "The Forge"})
+			assert.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				_, err = build.LoadStructure(ctx, public.LocationID)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, build.Promote())
+
+			store, err := Open(backend, nil, n, Options{})
+			if err != nil {
+				t.Fatal("error opening store: ", err)
+			}
+			defer store.Close()
+			res, err := store.Query(ctx, Query{})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(res))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package dbprices
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// ErrNoPrice is returned by GetPrice for types ESI gave no price for, or when prices were never loaded.
+var ErrNoPrice = errors.New("no market price")
+
+type EveLand interface {
+	ListMarketPrices(ctx context.Context) ([]*evesdk.MarketPrice, error)
+}
+
+// loadedAtKey holds when the prices were last loaded, it can't clash with the type ID keys.
+var loadedAtKey = []byte("loaded_at")
+
+// PriceDataDB stores ESI's /markets/prices/ average and adjusted prices in pebble, keyed by type ID.
+type PriceDataDB struct {
+	eveSDK EveLand
+
+	pdb *pebble.DB
+}
+
+func New(eveSDK EveLand, dbpath string) (*PriceDataDB, error) {
+	pebDbPath, err := db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error prepping db location: %v", err)
+	}
+	fmt.Println("Storing market prices on disk in pebbledb at: ", pebDbPath)
+
+	pdb, err := pebble.Open(pebDbPath, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening: %v", err)
+	}
+
+	return &PriceDataDB{eveSDK: eveSDK, pdb: pdb}, nil
+}
+
+func (p *PriceDataDB) Close() error {
+	err := p.pdb.Close()
+	if err != nil {
+		return fmt.Errorf("error closing: %v", err)
+	}
+	return nil
+}
+
+// LoadPrices replaces the stored prices with ESI's current ones, returning how many there were. Types that
+// dropped out of ESI's list lose their price, rather than keep one that is no longer current.
+func (p *PriceDataDB) LoadPrices(ctx context.Context) (int, error) {
+	prices, err := p.eveSDK.ListMarketPrices(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing market prices: %v", err)
+	}
+
+	batch := p.pdb.NewBatch()
+	defer batch.Close()
+	listed := make(map[string]bool, len(prices))
+	for _, price := range prices {
+		listed[string(TypeIDKey(price.TypeID))] = true
+	}
+	iter := p.pdb.NewIter(nil)
+	for iter.First(); iter.Valid(); iter.Next() {
+		if bytes.Equal(iter.Key(), loadedAtKey) || listed[string(iter.Key())] {
+			continue
+		}
+		if err := batch.Delete(iter.Key(), nil); err != nil {
+			iter.Close()
+			return 0, fmt.Errorf("error writing to batch: %v", err)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, fmt.Errorf("error reading from db: %v", err)
+	}
+	for _, price := range prices {
+		data, err := json.Marshal(price)
+		if err != nil {
+			return 0, fmt.Errorf("error marshalling market price: %v", err)
+		}
+		if err := batch.Set(TypeIDKey(price.TypeID), data, nil); err != nil {
+			return 0, fmt.Errorf("error writing to batch: %v", err)
+		}
+	}
+	loadedAt, err := time.Now().UTC().MarshalText()
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling load time: %v", err)
+	}
+	if err := batch.Set(loadedAtKey, loadedAt, nil); err != nil {
+		return 0, fmt.Errorf("error writing to batch: %v", err)
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return 0, fmt.Errorf("error writing to db: %v", err)
+	}
+	return len(prices), nil
+}
+
+// GetPrice returns a type's stored price, ErrNoPrice if there is none.
+func (p *PriceDataDB) GetPrice(ctx context.Context, typeID int32) (*evesdk.MarketPrice, error) {
+	data, closer, err := p.pdb.Get(TypeIDKey(typeID))
+	if err == pebble.ErrNotFound {
+		return nil, fmt.Errorf("type %d: %w", typeID, ErrNoPrice)
+	} else if err != nil {
+		return nil, fmt.Errorf("error while trying to read from db: err: %v", err)
+	}
+	defer closer.Close()
+
+	var price evesdk.MarketPrice
+	if err := json.Unmarshal(data, &price); err != nil {
+		return nil, fmt.Errorf("error while trying to unmarshal data: err: %v", err)
+	}
+	return &price, nil
+}
+
+// GetPrices returns the stored prices of the types, leaving out the ones without a price.
+func (p *PriceDataDB) GetPrices(ctx context.Context, typeIDs []int32) (map[int32]*evesdk.MarketPrice, error) {
+	prices := make(map[int32]*evesdk.MarketPrice, len(typeIDs))
+	for _, typeID := range typeIDs {
+		price, err := p.GetPrice(ctx, typeID)
+		if errors.Is(err, ErrNoPrice) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		prices[typeID] = price
+	}
+	return prices, nil
+}
+
+// LoadedAt returns when the prices were last loaded, the zero time if they never were.
+func (p *PriceDataDB) LoadedAt() (time.Time, error) {
+	var loadedAt time.Time
+	data, closer, err := p.pdb.Get(loadedAtKey)
+	if err == pebble.ErrNotFound {
+		return loadedAt, nil
+	} else if err != nil {
+		return loadedAt, fmt.Errorf("error while trying to read from db: err: %v", err)
+	}
+	defer closer.Close()
+	if err := loadedAt.UnmarshalText(data); err != nil {
+		return loadedAt, fmt.Errorf("error unmarshalling load time: %v", err)
+	}
+	return loadedAt, nil
+}
+
+func TypeIDKey(typeID int32) []byte {
+	return []byte(strconv.Itoa(int(typeID)))
+}
+
+func db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "eveprices_peb_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
@@ -0,0 +1,72 @@
+package dbprices
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPrices(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddPrices(
+		&evesdk.MarketPrice{TypeID: 34, AveragePrice: 5.1, AdjustedPrice: 4.9},
+		&evesdk.MarketPrice{TypeID: 35, AdjustedPrice: 10},
+	)
+	ctx := context.Background()
+	dbpath := t.TempDir()
+
+	dbp, err := New(esi.EveLand(), dbpath)
+	require.NoError(t, err)
+	loadedAt, err := dbp.LoadedAt()
+	require.NoError(t, err)
+	assert.True(t, loadedAt.IsZero())
+	_, err = dbp.GetPrice(ctx, 34)
+	assert.True(t, errors.Is(err, ErrNoPrice))
+
+	n, err := dbp.LoadPrices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, dbp.Close())
+
+	// The prices survive a reopen.
+	dbp, err = New(nil, dbpath)
+	require.NoError(t, err)
+	price, err := dbp.GetPrice(ctx, 34)
+	require.NoError(t, err)
+	assert.Equal(t, 5.1, price.AveragePrice)
+	assert.Equal(t, 4.9, price.AdjustedPrice)
+
+	prices, err := dbp.GetPrices(ctx, []int32{34, 35, 36})
+	require.NoError(t, err)
+	assert.Len(t, prices, 2)
+	assert.Zero(t, prices[35].AveragePrice)
+	loadedAt, err = dbp.LoadedAt()
+	require.NoError(t, err)
+	assert.False(t, loadedAt.IsZero())
+	require.NoError(t, dbp.Close())
+
+	// A type ESI stops listing loses its price instead of keeping an outdated one.
+	later := esitest.New()
+	defer later.Close()
+	later.AddPrices(&evesdk.MarketPrice{TypeID: 34, AveragePrice: 5.3, AdjustedPrice: 5})
+	dbp, err = New(later.EveLand(), dbpath)
+	require.NoError(t, err)
+	defer dbp.Close()
+	n, err = dbp.LoadPrices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = dbp.GetPrice(ctx, 35)
+	assert.True(t, errors.Is(err, ErrNoPrice))
+	price, err = dbp.GetPrice(ctx, 34)
+	require.NoError(t, err)
+	assert.Equal(t, 5.3, price.AveragePrice)
+	loadedAt, err = dbp.LoadedAt()
+	require.NoError(t, err)
+	assert.False(t, loadedAt.IsZero())
+}
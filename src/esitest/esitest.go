@@ -0,0 +1,656 @@
+// Package esitest runs a fake ESI on an httptest server so evesdk, evecache and the commands can be tested
+// without the network. It serves the endpoints eveland uses with the same paging, cache and error-limit
+// headers as the real ESI, and lets tests inject failures.
+package esitest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antihax/goesi"
+	"github.com/antihax/goesi/esi"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// ErrorLimit is the error budget the fake hands out per window, the same as ESI's.
+const ErrorLimit = 100
+
+// Failure makes matching requests fail. Page 0 matches every page of the path.
+type Failure struct {
+	Path   string // request path, e.g. /v1/markets/10000002/orders/
+	Page   int32
+	Status int
+	Times  int // how many matching requests fail, 0 means forever
+
+	hits int
+}
+
+// Server is a fake ESI. Populate it with the Add methods, then point a goesi client at it with Client.
+type Server struct {
+	*httptest.Server
+
+	// PageSize is how many items each page of a paged endpoint holds.
+	PageSize int
+	// CacheFor sets the Expires header, zero makes every response immediately stale.
+	CacheFor time.Duration
+
+	mu       sync.Mutex
+	regions  map[int32]esi.GetUniverseRegionsRegionIdOk
+	types    map[int32]esi.GetUniverseTypesTypeIdOk
+	orders   map[int32][]esi.GetMarketsRegionIdOrders200Ok
+	prices   []esi.GetMarketsPrices200Ok
+	failures []*Failure
+	sso      *SSO
+
+	marketGroups map[int32]esi.GetMarketsGroupsMarketGroupIdOk
+	groups       map[int32]esi.GetUniverseGroupsGroupIdOk
+	categories   map[int32]esi.GetUniverseCategoriesCategoryIdOk
+
+	structures      map[int64]esi.GetUniverseStructuresStructureIdOk
+	structureOrders map[int64][]esi.GetMarketsStructuresStructureId200Ok
+	characterOrders map[int32][]esi.GetCharactersCharacterIdOrders200Ok
+	transactions    map[int32][]esi.GetCharactersCharacterIdWalletTransactions200Ok
+	assets          map[int32][]esi.GetCharactersCharacterIdAssets200Ok
+	requests        map[string]int
+	notMod          int
+	errors          int
+	window          time.Time
+}
+
+// New starts a fake ESI. Call Close when done.
+func New() *Server {
+	s := &Server{
+		PageSize: 1000,
+		CacheFor: 5 * time.Minute,
+		regions:  map[int32]esi.GetUniverseRegionsRegionIdOk{},
+		types:    map[int32]esi.GetUniverseTypesTypeIdOk{},
+		orders:   map[int32][]esi.GetMarketsRegionIdOrders200Ok{},
+		requests: map[string]int{},
+
+		marketGroups: map[int32]esi.GetMarketsGroupsMarketGroupIdOk{},
+		groups:       map[int32]esi.GetUniverseGroupsGroupIdOk{},
+		categories:   map[int32]esi.GetUniverseCategoriesCategoryIdOk{},
+
+		structures:      map[int64]esi.GetUniverseStructuresStructureIdOk{},
+		structureOrders: map[int64][]esi.GetMarketsStructuresStructureId200Ok{},
+		characterOrders: map[int32][]esi.GetCharactersCharacterIdOrders200Ok{},
+		transactions:    map[int32][]esi.GetCharactersCharacterIdWalletTransactions200Ok{},
+		assets:          map[int32][]esi.GetCharactersCharacterIdAssets200Ok{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a goesi client using the given http client, http.DefaultClient if nil, that talks to the fake.
+func (s *Server) Client(client *http.Client) *goesi.APIClient {
+	if client == nil {
+		client = &http.Client{}
+	}
+	eve := goesi.NewAPIClient(client, "eveland esitest")
+	eve.ChangeBasePath(s.URL)
+	return eve
+}
+
+// EveLand returns an evesdk client that talks to the fake without a cache in between.
+func (s *Server) EveLand() *evesdk.EveLand {
+	return evesdk.New(s.Client(nil), nil)
+}
+
+// AddRegion adds a region.
+func (s *Server) AddRegion(region *evesdk.Region) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regions[region.RegionID] = esi.GetUniverseRegionsRegionIdOk{
+		RegionId:    region.RegionID,
+		Name:        region.Name,
+		Description: region.Description,
+	}
+}
+
+// AddType adds an item type.
+func (s *Server) AddType(t *evesdk.TypeData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[t.TypeId] = esi.GetUniverseTypesTypeIdOk{
+		Capacity:       t.Capacity,
+		Description:    t.Description,
+		GraphicId:      t.GraphicId,
+		GroupId:        t.GroupId,
+		IconId:         t.IconId,
+		MarketGroupId:  t.MarketGroupId,
+		Mass:           t.Mass,
+		Name:           t.Name,
+		PackagedVolume: t.PackagedVolume,
+		PortionSize:    t.PortionSize,
+		Published:      t.Published,
+		Radius:         t.Radius,
+		TypeId:         t.TypeId,
+		Volume:         t.Volume,
+	}
+}
+
+// AddMarketGroup adds a market group.
+func (s *Server) AddMarketGroup(g *evesdk.MarketGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marketGroups[g.MarketGroupID] = esi.GetMarketsGroupsMarketGroupIdOk{
+		MarketGroupId: g.MarketGroupID,
+		ParentGroupId: g.ParentGroupID,
+		Name:          g.Name,
+		Description:   g.Description,
+		Types:         g.TypeIDs,
+	}
+}
+
+// AddGroup adds an item group.
+func (s *Server) AddGroup(g *evesdk.Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[g.GroupID] = esi.GetUniverseGroupsGroupIdOk{
+		GroupId:    g.GroupID,
+		CategoryId: g.CategoryID,
+		Name:       g.Name,
+		Published:  g.Published,
+		Types:      g.TypeIDs,
+	}
+}
+
+// AddCategory adds an item category.
+func (s *Server) AddCategory(c *evesdk.Category) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories[c.CategoryID] = esi.GetUniverseCategoriesCategoryIdOk{
+		CategoryId: c.CategoryID,
+		Name:       c.Name,
+		Published:  c.Published,
+		Groups:     c.GroupIDs,
+	}
+}
+
+// AddOrders adds market orders to a region.
+func (s *Server) AddOrders(regionID int32, orders ...*evesdk.MarketOrder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range orders {
+		s.orders[regionID] = append(s.orders[regionID], esi.GetMarketsRegionIdOrders200Ok{
+			OrderId:      o.OrderID,
+			TypeId:       o.TypeID,
+			LocationId:   o.LocationID,
+			SystemId:     o.SystemID,
+			VolumeTotal:  o.VolumeTotal,
+			VolumeRemain: o.VolumeRemain,
+			MinVolume:    o.MinVolume,
+			Price:        o.Price,
+			IsBuyOrder:   o.IsBuyOrder,
+			Issued:       o.Issued,
+			Duration:     o.Duration,
+			Range_:       o.Range_,
+		})
+	}
+}
+
+// AddPrices adds market prices, served in the order they were added.
+func (s *Server) AddPrices(prices ...*evesdk.MarketPrice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range prices {
+		s.prices = append(s.prices, esi.GetMarketsPrices200Ok{
+			TypeId:        p.TypeID,
+			AveragePrice:  p.AveragePrice,
+			AdjustedPrice: p.AdjustedPrice,
+		})
+	}
+}
+
+// UseSSO makes the authenticated endpoints accept only access tokens issued by sso. Without it any bearer
+// token is accepted.
+func (s *Server) UseSSO(sso *SSO) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sso = sso
+}
+
+// AddStructure adds a player structure, visible to authenticated characters.
+func (s *Server) AddStructure(structure *evesdk.Structure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.structures[structure.StructureID] = esi.GetUniverseStructuresStructureIdOk{
+		Name:          structure.Name,
+		OwnerId:       structure.OwnerID,
+		SolarSystemId: structure.SolarSystemID,
+		TypeId:        structure.TypeID,
+	}
+}
+
+// AddStructureOrders adds market orders to a structure. Like ESI, their system isn't served.
+func (s *Server) AddStructureOrders(structureID int64, orders ...*evesdk.MarketOrder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range orders {
+		s.structureOrders[structureID] = append(s.structureOrders[structureID], esi.GetMarketsStructuresStructureId200Ok{
+			OrderId:      o.OrderID,
+			TypeId:       o.TypeID,
+			LocationId:   structureID,
+			VolumeTotal:  o.VolumeTotal,
+			VolumeRemain: o.VolumeRemain,
+			MinVolume:    o.MinVolume,
+			Price:        o.Price,
+			IsBuyOrder:   o.IsBuyOrder,
+			Issued:       o.Issued,
+			Duration:     o.Duration,
+			Range_:       o.Range_,
+		})
+	}
+}
+
+// AddCharacterOrders adds open orders to a character, only served to that character.
+func (s *Server) AddCharacterOrders(characterID int32, orders ...*evesdk.CharacterOrder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range orders {
+		s.characterOrders[characterID] = append(s.characterOrders[characterID], esi.GetCharactersCharacterIdOrders200Ok{
+			OrderId:       o.OrderID,
+			TypeId:        o.TypeID,
+			RegionId:      o.RegionID,
+			LocationId:    o.LocationID,
+			VolumeTotal:   o.VolumeTotal,
+			VolumeRemain:  o.VolumeRemain,
+			MinVolume:     o.MinVolume,
+			Price:         o.Price,
+			IsBuyOrder:    o.IsBuyOrder,
+			Issued:        o.Issued,
+			Duration:      o.Duration,
+			Range_:        o.Range_,
+			Escrow:        o.Escrow,
+			IsCorporation: o.IsCorporation,
+		})
+	}
+}
+
+// AddWalletTransactions adds wallet transactions to a character, only served to that character. Like ESI,
+// they are served newest first, PageSize at a time walking back with from_id.
+func (s *Server) AddWalletTransactions(characterID int32, txs ...*evesdk.WalletTransaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range txs {
+		s.transactions[characterID] = append(s.transactions[characterID], esi.GetCharactersCharacterIdWalletTransactions200Ok{
+			TransactionId: t.TransactionID,
+			Date:          t.Date,
+			TypeId:        t.TypeID,
+			LocationId:    t.LocationID,
+			Quantity:      t.Quantity,
+			UnitPrice:     t.UnitPrice,
+			IsBuy:         t.IsBuy,
+			IsPersonal:    t.IsPersonal,
+			ClientId:      t.ClientID,
+			JournalRefId:  t.JournalRefID,
+		})
+	}
+	sort.Slice(s.transactions[characterID], func(i, j int) bool {
+		return s.transactions[characterID][i].TransactionId > s.transactions[characterID][j].TransactionId
+	})
+}
+
+// AddAssets adds assets to a character, only served to that character.
+func (s *Server) AddAssets(characterID int32, assets ...*evesdk.Asset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range assets {
+		s.assets[characterID] = append(s.assets[characterID], esi.GetCharactersCharacterIdAssets200Ok{
+			ItemId:          a.ItemID,
+			TypeId:          a.TypeID,
+			LocationId:      a.LocationID,
+			LocationType:    a.LocationType,
+			LocationFlag:    a.LocationFlag,
+			Quantity:        a.Quantity,
+			IsSingleton:     a.IsSingleton,
+			IsBlueprintCopy: a.IsBlueprintCopy,
+		})
+	}
+}
+
+// Fail injects a failure, see Failure.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// Requests returns how many requests were made for path, including failed and not modified ones.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// NotModified returns how many requests were answered with 304 Not Modified.
+func (s *Server) NotModified() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notMod
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	s.requests[path]++
+
+	page := int32(1)
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			s.writeError(w, http.StatusBadRequest, "invalid page")
+			return
+		}
+		page = int32(n)
+	}
+
+	// Like ESI, once the error budget is spent every request is refused until the window resets.
+	s.rollWindow()
+	if s.errors >= ErrorLimit {
+		s.writeError(w, 420, "This software has exceeded the error limit for ESI.")
+		return
+	}
+
+	for _, f := range s.failures {
+		if f.Path != path || (f.Page != 0 && f.Page != page) || (f.Times > 0 && f.hits >= f.Times) {
+			continue
+		}
+		f.hits++
+		s.writeError(w, f.Status, http.StatusText(f.Status))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case path == "/v1/universe/regions/":
+		ids := make([]int32, 0, len(s.regions))
+		for id := range s.regions {
+			ids = append(ids, id)
+		}
+		s.writeJSON(w, r, sortedIDs(ids), 1)
+	case len(parts) == 4 && parts[1] == "universe" && parts[2] == "regions":
+		id, _ := strconv.Atoi(parts[3])
+		region, ok := s.regions[int32(id)]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Region not found")
+			return
+		}
+		s.writeJSON(w, r, region, 1)
+	case path == "/v1/universe/types/":
+		ids := make([]int32, 0, len(s.types))
+		for id := range s.types {
+			ids = append(ids, id)
+		}
+		items, pages := paginate(sortedIDs(ids), page, s.PageSize)
+		s.writePage(w, r, items, page, pages)
+	case len(parts) == 4 && parts[1] == "universe" && parts[2] == "types":
+		id, _ := strconv.Atoi(parts[3])
+		t, ok := s.types[int32(id)]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Type not found")
+			return
+		}
+		s.writeJSON(w, r, t, 1)
+	case path == "/v1/markets/groups/":
+		ids := make([]int32, 0, len(s.marketGroups))
+		for id := range s.marketGroups {
+			ids = append(ids, id)
+		}
+		s.writeJSON(w, r, sortedIDs(ids), 1)
+	case len(parts) == 4 && parts[1] == "markets" && parts[2] == "groups":
+		id, _ := strconv.Atoi(parts[3])
+		g, ok := s.marketGroups[int32(id)]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Market group not found")
+			return
+		}
+		s.writeJSON(w, r, g, 1)
+	case path == "/v1/universe/groups/":
+		ids := make([]int32, 0, len(s.groups))
+		for id := range s.groups {
+			ids = append(ids, id)
+		}
+		items, pages := paginate(sortedIDs(ids), page, s.PageSize)
+		s.writePage(w, r, items, page, pages)
+	case len(parts) == 4 && parts[1] == "universe" && parts[2] == "groups":
+		id, _ := strconv.Atoi(parts[3])
+		g, ok := s.groups[int32(id)]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Group not found")
+			return
+		}
+		s.writeJSON(w, r, g, 1)
+	case path == "/v1/universe/categories/":
+		ids := make([]int32, 0, len(s.categories))
+		for id := range s.categories {
+			ids = append(ids, id)
+		}
+		s.writeJSON(w, r, sortedIDs(ids), 1)
+	case len(parts) == 4 && parts[1] == "universe" && parts[2] == "categories":
+		id, _ := strconv.Atoi(parts[3])
+		c, ok := s.categories[int32(id)]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		s.writeJSON(w, r, c, 1)
+	case path == "/v1/markets/prices/":
+		prices := s.prices
+		if prices == nil {
+			prices = []esi.GetMarketsPrices200Ok{}
+		}
+		s.writeJSON(w, r, prices, 1)
+	case len(parts) == 4 && parts[1] == "markets" && parts[3] == "orders":
+		id, _ := strconv.Atoi(parts[2])
+		if _, ok := s.regions[int32(id)]; !ok {
+			s.writeError(w, http.StatusNotFound, "Region not found")
+			return
+		}
+		orders := s.orders[int32(id)]
+		switch r.URL.Query().Get("order_type") {
+		case "buy":
+			orders = filterOrders(orders, true)
+		case "sell":
+			orders = filterOrders(orders, false)
+		}
+		items, pages := paginate(orders, page, s.PageSize)
+		s.writePage(w, r, items, page, pages)
+	case len(parts) == 4 && parts[1] == "characters" && parts[3] == "orders":
+		id, _ := strconv.Atoi(parts[2])
+		if !s.authorizedAs(w, r, int32(id)) {
+			return
+		}
+		orders := s.characterOrders[int32(id)]
+		if orders == nil {
+			orders = []esi.GetCharactersCharacterIdOrders200Ok{}
+		}
+		s.writeJSON(w, r, orders, 1)
+	case len(parts) == 4 && parts[1] == "characters" && parts[3] == "assets":
+		id, _ := strconv.Atoi(parts[2])
+		if !s.authorizedAs(w, r, int32(id)) {
+			return
+		}
+		items, pages := paginate(s.assets[int32(id)], page, s.PageSize)
+		s.writePage(w, r, items, page, pages)
+	case len(parts) == 5 && parts[1] == "characters" && parts[3] == "wallet" && parts[4] == "transactions":
+		id, _ := strconv.Atoi(parts[2])
+		if !s.authorizedAs(w, r, int32(id)) {
+			return
+		}
+		var fromID int64
+		if f := r.URL.Query().Get("from_id"); f != "" {
+			fromID, _ = strconv.ParseInt(f, 10, 64)
+		}
+		txs := []esi.GetCharactersCharacterIdWalletTransactions200Ok{}
+		for _, t := range s.transactions[int32(id)] {
+			if (fromID == 0 || t.TransactionId <= fromID) && (s.PageSize < 1 || len(txs) < s.PageSize) {
+				txs = append(txs, t)
+			}
+		}
+		s.writeJSON(w, r, txs, 1)
+	case len(parts) == 4 && parts[1] == "universe" && parts[2] == "structures":
+		if !s.authorized(w, r) {
+			return
+		}
+		id, _ := strconv.ParseInt(parts[3], 10, 64)
+		structure, ok := s.structures[id]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "Structure not found")
+			return
+		}
+		s.writeJSON(w, r, structure, 1)
+	case len(parts) == 4 && parts[1] == "markets" && parts[2] == "structures":
+		if !s.authorized(w, r) {
+			return
+		}
+		id, _ := strconv.ParseInt(parts[3], 10, 64)
+		if _, ok := s.structures[id]; !ok {
+			s.writeError(w, http.StatusNotFound, "Structure not found")
+			return
+		}
+		items, pages := paginate(s.structureOrders[id], page, s.PageSize)
+		s.writePage(w, r, items, page, pages)
+	default:
+		s.writeError(w, http.StatusNotFound, "Unhandled fake ESI path "+path)
+	}
+}
+
+// authorized checks the request's bearer token, answering 401 like ESI when it isn't good.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	_, ok := s.bearer(w, r)
+	return ok
+}
+
+// authorizedAs is authorized for a character's own endpoints, answering 403 when the token belongs to another
+// character. Without an SSO the token's character isn't known and any token is accepted.
+func (s *Server) authorizedAs(w http.ResponseWriter, r *http.Request, characterID int32) bool {
+	id, ok := s.bearer(w, r)
+	if ok && s.sso != nil && id != characterID {
+		s.writeError(w, http.StatusForbidden, "token is not valid for this character")
+		return false
+	}
+	return ok
+}
+
+func (s *Server) bearer(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	var id int32
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	ok := token != "" && token != r.Header.Get("Authorization")
+	if ok && s.sso != nil {
+		id, ok = s.sso.Character(token)
+	}
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "authentication failure")
+	}
+	return id, ok
+}
+
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items any, page, pages int32) {
+	if page > pages {
+		s.writeError(w, http.StatusNotFound, "Requested page does not exist!")
+		return
+	}
+	s.writeJSON(w, r, items, pages)
+}
+
+// writeJSON writes v with ESI's cache headers, answering 304 if the client already has this ETag.
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, v any, pages int32) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+	h.Set("ETag", etag)
+	h.Set("Expires", time.Now().Add(s.CacheFor).UTC().Format(http.TimeFormat))
+	h.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	h.Set("X-Pages", strconv.Itoa(int(pages)))
+	s.errorLimitHeaders(h)
+
+	if r.Header.Get("If-None-Match") == etag {
+		s.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(body)
+}
+
+// writeError writes an ESI style error, spending one error from the budget.
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.rollWindow()
+	s.errors++
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	s.errorLimitHeaders(w.Header())
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":%q}`, msg)
+}
+
+// rollWindow starts a new error limit window once the current one has run out.
+func (s *Server) rollWindow() {
+	if time.Now().After(s.window) {
+		s.window = time.Now().Add(time.Minute)
+		s.errors = 0
+	}
+}
+
+func (s *Server) errorLimitHeaders(h http.Header) {
+	s.rollWindow()
+	remain := ErrorLimit - s.errors
+	if remain < 0 {
+		remain = 0
+	}
+	h.Set("X-Esi-Error-Limit-Remain", strconv.Itoa(remain))
+	h.Set("X-Esi-Error-Limit-Reset", strconv.Itoa(int(time.Until(s.window).Seconds())+1))
+}
+
+func sortedIDs(ids []int32) []int32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func filterOrders(orders []esi.GetMarketsRegionIdOrders200Ok, buy bool) []esi.GetMarketsRegionIdOrders200Ok {
+	var out []esi.GetMarketsRegionIdOrders200Ok
+	for _, o := range orders {
+		if o.IsBuyOrder == buy {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// paginate returns one page of items and the page count. An empty list still has one, empty, page.
+func paginate[T any](items []T, page int32, size int) ([]T, int32) {
+	if size < 1 {
+		size = len(items)
+	}
+	pages := int32(1)
+	if len(items) > 0 && size > 0 {
+		pages = int32((len(items) + size - 1) / size)
+	}
+	start := int(page-1) * size
+	if start >= len(items) {
+		return []T{}, pages
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end], pages
+}
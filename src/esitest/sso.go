@@ -0,0 +1,242 @@
+package esitest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesso"
+)
+
+// SSOClientID is the only client the fake SSO accepts.
+const SSOClientID = "eveland-test"
+
+// SSO is a fake EVE SSO v2. Its authorize endpoint stands in for the user: it approves the login as the
+// character set with LoginAs and redirects straight back to the callback. Codes need a matching PKCE
+// verifier and refresh tokens rotate on use, like the real one.
+type SSO struct {
+	*httptest.Server
+
+	// TokenTTL is how long access tokens last.
+	TokenTTL time.Duration
+
+	mu        sync.Mutex
+	character ssoCharacter
+	codes     map[string]ssoCode
+	refresh   map[string]ssoCharacter
+	access    map[string]int32
+	refreshes int
+	n         int
+}
+
+type ssoCharacter struct {
+	id     int32
+	name   string
+	scopes []string
+}
+
+type ssoCode struct {
+	character   ssoCharacter
+	challenge   string
+	redirectURI string
+}
+
+// NewSSO starts a fake SSO. Call Close when done.
+func NewSSO() *SSO {
+	s := &SSO{
+		TokenTTL: 20 * time.Minute,
+		codes:    map[string]ssoCode{},
+		refresh:  map[string]ssoCharacter{},
+		access:   map[string]int32{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth/authorize", s.authorize)
+	mux.HandleFunc("/v2/oauth/token", s.token)
+	mux.HandleFunc("/v2/oauth/revoke", s.revoke)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Config returns an evesso config for the fake, with a callback on a free local port.
+func (s *SSO) Config(scopes ...string) evesso.Config {
+	return evesso.Config{
+		ClientID:    SSOClientID,
+		CallbackURL: "http://127.0.0.1:0/callback",
+		Scopes:      scopes,
+		AuthURL:     s.URL + "/v2/oauth/authorize",
+		TokenURL:    s.URL + "/v2/oauth/token",
+		RevokeURL:   s.URL + "/v2/oauth/revoke",
+	}
+}
+
+// LoginAs sets the character the next logins approve as.
+func (s *SSO) LoginAs(characterID int32, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.character = ssoCharacter{id: characterID, name: name}
+}
+
+// Character returns the character an access token was issued to.
+func (s *SSO) Character(accessToken string) (int32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.access[accessToken]
+	return id, ok
+}
+
+// Refreshes is how many refresh token grants have been served.
+func (s *SSO) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// RefreshTokens is how many refresh tokens are live.
+func (s *SSO) RefreshTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.refresh)
+}
+
+func (s *SSO) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != SSOClientID || q.Get("response_type") != "code" {
+		http.Error(w, "bad client or response type", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "pkce is required", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	if s.character.id == 0 {
+		s.mu.Unlock()
+		http.Error(w, "no character to log in as, call LoginAs", http.StatusInternalServerError)
+		return
+	}
+	char := s.character
+	char.scopes = strings.Fields(q.Get("scope"))
+	code := s.nextToken("code")
+	s.codes[code] = ssoCode{character: char, challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri")}
+	s.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *SSO) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		ssoError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("client_id") != SSOClientID {
+		ssoError(w, "invalid_client", "unknown client")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var char ssoCharacter
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, ok := s.codes[r.PostForm.Get("code")]
+		if !ok {
+			ssoError(w, "invalid_grant", "unknown code")
+			return
+		}
+		// Codes are single use, even when the exchange fails.
+		delete(s.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+			ssoError(w, "invalid_grant", "code_verifier doesn't match the challenge")
+			return
+		}
+		if r.PostForm.Get("redirect_uri") != code.redirectURI {
+			ssoError(w, "invalid_grant", "redirect_uri doesn't match")
+			return
+		}
+		char = code.character
+	case "refresh_token":
+		var ok bool
+		char, ok = s.refresh[r.PostForm.Get("refresh_token")]
+		if !ok {
+			ssoError(w, "invalid_grant", "unknown refresh token")
+			return
+		}
+		delete(s.refresh, r.PostForm.Get("refresh_token"))
+		s.refreshes++
+	default:
+		ssoError(w, "unsupported_grant_type", r.PostForm.Get("grant_type"))
+		return
+	}
+
+	refresh := s.nextToken("refresh")
+	s.refresh[refresh] = char
+	access := s.accessToken(char)
+	s.access[access] = char.id
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    int(s.TokenTTL / time.Second),
+		"refresh_token": refresh,
+	})
+}
+
+func (s *SSO) revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		ssoError(w, "invalid_request", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refresh, r.PostForm.Get("token"))
+}
+
+// accessToken makes an unsigned JWT with the claims EVE SSO puts in its access tokens, including scp being a
+// string when there is only one scope. Must be called with s.mu held.
+func (s *SSO) accessToken(char ssoCharacter) string {
+	var scp any = char.scopes
+	if len(char.scopes) == 1 {
+		scp = char.scopes[0]
+	}
+	claims, _ := json.Marshal(map[string]any{
+		"sub":  fmt.Sprintf("CHARACTER:EVE:%d", char.id),
+		"name": char.name,
+		"scp":  scp,
+		"azp":  SSOClientID,
+		"iss":  s.URL,
+		"exp":  time.Now().Add(s.TokenTTL).Unix(),
+		"jti":  s.nextToken("jti"),
+	})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + enc.EncodeToString(claims) + ".fake"
+}
+
+// nextToken returns a unique opaque token. Must be called with s.mu held.
+func (s *SSO) nextToken(kind string) string {
+	s.n++
+	return fmt.Sprintf("%s-%d", kind, s.n)
+}
+
+func ssoError(w http.ResponseWriter, code, desc string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": desc})
+}
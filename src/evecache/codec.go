@@ -0,0 +1,43 @@
+package evecache
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Values on disk are either the raw HTTP response httpcache hands us, which always starts with "HTTP/", or
+// zstdMagic followed by a zstd frame of it. Entries written before compression stay readable as they are.
+
+var zstdMagic = []byte("EVZ1")
+
+var (
+	// EncodeAll and DecodeAll are safe for concurrent use, so one of each serves the whole process.
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// encodeValue compresses a response for storage, keeping it raw when compression doesn't make it smaller.
+func encodeValue(raw []byte) []byte {
+	dst := make([]byte, len(zstdMagic), len(zstdMagic)+len(raw)/4)
+	copy(dst, zstdMagic)
+	dst = zstdEncoder.EncodeAll(raw, dst)
+	if len(dst) >= len(raw) {
+		return raw
+	}
+	return dst
+}
+
+// decodeValue returns the raw response for a stored value in either format. The result never aliases stored,
+// so it outlives pebble's buffer.
+func decodeValue(stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, zstdMagic) {
+		return append([]byte(nil), stored...), nil
+	}
+	raw, err := zstdDecoder.DecodeAll(stored[len(zstdMagic):], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing cache entry: %v", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,49 @@
+package evecache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressedStorage(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, Retain: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	body := "[" + strings.Repeat(`{"order_id":6543210987,"type_id":34,"price":5.25,"range":"region"},`, 500) + "{}]"
+	big := rawResponse(time.Now().Add(time.Hour), body)
+	c.Set("big", big)
+
+	// An entry written before compression existed.
+	legacy := rawResponse(time.Now().Add(time.Hour), "[]")
+	assert.NoError(t, c.pebbledb.Set([]byte("legacy"), legacy, pebble.Sync))
+
+	stored, closer, err := c.pebbledb.Get([]byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bytes.HasPrefix(stored, zstdMagic))
+	assert.Less(t, len(stored), len(big)/10)
+	closer.Close()
+
+	// Read from disk, not the memory tier.
+	c.items = newMemoryTier(1 << 20)
+	resp, ok := c.Get("big")
+	assert.True(t, ok)
+	assert.Equal(t, big, resp)
+	resp, ok = c.Get("legacy")
+	assert.True(t, ok)
+	assert.Equal(t, legacy, resp)
+
+	stats, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(big)+len(legacy)), stats.Bytes)
+	assert.Greater(t, stats.CompressionRatio(), 5.0)
+}
@@ -0,0 +1,133 @@
+package evecache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// CompactStats reports what a compaction did.
+type CompactStats struct {
+	Scanned int
+	Purged  int
+}
+
+// responseHeader parses the headers of a response as httpcache stores it, the raw HTTP/1.1 response.
+func responseHeader(raw []byte) (int, http.Header, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header, nil
+}
+
+// storedExpires is responseExpires for a value as it is stored on disk.
+func storedExpires(stored []byte) time.Time {
+	raw, err := decodeValue(stored)
+	if err != nil {
+		return time.Time{}
+	}
+	return responseExpires(raw)
+}
+
+// responseExpires reads the Expires header out of a cached response. A response without one has already expired.
+func responseExpires(raw []byte) time.Time {
+	_, h, err := responseHeader(raw)
+	if err != nil {
+		return time.Time{}
+	}
+	expires, err := http.ParseTime(h.Get("Expires"))
+	if err != nil {
+		return time.Time{}
+	}
+	return expires
+}
+
+func (c *EveCache) compactLoop() {
+	defer close(c.done)
+	if c.opts.CompactEvery <= 0 {
+		return
+	}
+	t := time.NewTicker(c.opts.CompactEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+			if c.Health() != Healthy {
+				continue
+			}
+			if _, err := c.Compact(); err != nil {
+				fmt.Println("Error while compacting evecache:", err)
+			}
+		}
+	}
+}
+
+// Compact removes the responses that expired more than Options.Retain ago from disk.
+func (c *EveCache) Compact() (CompactStats, error) {
+	var stats CompactStats
+	if c.pebbledb == nil {
+		return stats, errNoDisk
+	}
+	cutoff := c.now().Add(-c.opts.Retain)
+
+	// Find candidates without holding the lock, pebble iterators see a consistent snapshot.
+	var purge [][]byte
+	iter := c.pebbledb.NewIter(nil)
+	for iter.First(); iter.Valid(); iter.Next() {
+		stats.Scanned++
+		if storedExpires(iter.Value()).Before(cutoff) {
+			purge = append(purge, append([]byte(nil), iter.Key()...))
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return stats, fmt.Errorf("error scanning cache: %v", err)
+	}
+	if len(purge) == 0 {
+		return stats, nil
+	}
+
+	c.diskMu.Lock()
+	defer c.diskMu.Unlock()
+
+	// A key may have been refreshed since we looked at it, check again before deleting.
+	b := c.pebbledb.NewBatch()
+	for _, key := range purge {
+		value, closer, err := c.pebbledb.Get(key)
+		if err == pebble.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			b.Close()
+			return stats, fmt.Errorf("error reading %s: %v", key, err)
+		}
+		expired := storedExpires(value).Before(cutoff)
+		closer.Close()
+		if !expired {
+			continue
+		}
+		if err := b.Delete(key, nil); err != nil {
+			b.Close()
+			return stats, fmt.Errorf("error deleting %s: %v", key, err)
+		}
+		c.forget(string(key))
+		stats.Purged++
+	}
+	if err := b.Commit(pebble.Sync); err != nil {
+		return stats, fmt.Errorf("error committing purge: %v", err)
+	}
+
+	// Reclaim the disk space now rather than whenever pebble gets round to it.
+	end := append(append([]byte(nil), purge[len(purge)-1]...), 0)
+	if err := c.pebbledb.Compact(purge[0], end, false); err != nil {
+		return stats, fmt.Errorf("error compacting cache: %v", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,65 @@
+package evecache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rawResponse(expires time.Time, body string) []byte {
+	return []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nExpires: %s\r\nContent-Length: %d\r\n\r\n%s",
+		expires.UTC().Format(http.TimeFormat), len(body), body))
+}
+
+func TestMemoryTierEviction(t *testing.T) {
+	now := time.Now()
+	m := newMemoryTier(100)
+	m.add("a", make([]byte, 40), now.Add(time.Minute), now)
+	m.add("b", make([]byte, 40), now.Add(time.Minute), now)
+	_, ok := m.get("a", now) // a is now the most recently used
+	assert.True(t, ok)
+	m.add("c", make([]byte, 40), now.Add(time.Minute), now)
+
+	_, ok = m.get("b", now)
+	assert.False(t, ok, "least recently used entry is evicted")
+	assert.Equal(t, 2, m.len())
+	assert.Equal(t, int64(80), m.size)
+
+	_, ok = m.get("a", now.Add(2*time.Minute))
+	assert.False(t, ok, "expired entries leave the memory tier")
+	m.add("big", make([]byte, 200), now.Add(time.Minute), now)
+	_, ok = m.get("big", now)
+	assert.False(t, ok)
+}
+
+func TestCompact(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, Retain: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Set("fresh", rawResponse(now.Add(time.Minute), "fresh"))
+	c.Set("stale", rawResponse(now.Add(-30*time.Minute), "stale"))
+	c.Set("old", rawResponse(now.Add(-2*time.Hour), "old"))
+	c.Set("junk", []byte("not a response"))
+
+	stats, err := c.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, CompactStats{Scanned: 4, Purged: 2}, stats)
+
+	_, ok := c.Get("fresh")
+	assert.True(t, ok)
+	resp, ok := c.Get("stale")
+	assert.True(t, ok, "expired responses are kept for the retention period")
+	assert.Equal(t, rawResponse(now.Add(-30*time.Minute), "stale"), resp)
+	_, ok = c.Get("old")
+	assert.False(t, ok)
+	_, ok = c.Get("junk")
+	assert.False(t, ok)
+}
@@ -2,15 +2,62 @@ package evecache
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/cockroachdb/pebble"
 )
 
-// New returns a new Cache that will store items in an in-memory map and on disk in pebbledb.
+// Options bounds the memory tier and controls how long responses are kept on disk.
+type Options struct {
+	// MemoryBytes bounds the in-memory LRU of fresh responses.
+	MemoryBytes int64
+	// Retain is how long a response is kept on disk after it expires, so it can still be revalidated with
+	// its ETag or served in offline mode.
+	Retain time.Duration
+	// CompactEvery is how often expired responses are purged from disk in the background, 0 disables it.
+	CompactEvery time.Duration
+	// MaxStorageErrors is how many disk errors are tolerated before the cache stops using the disk.
+	MaxStorageErrors int
+}
+
+// DefaultOptions are used by New.
+var DefaultOptions = Options{MemoryBytes: 64 << 20, Retain: 7 * 24 * time.Hour, CompactEvery: time.Hour, MaxStorageErrors: 3}
+
+// Health is how much of the cache is working.
+type Health int32
+
+const (
+	// Healthy caches in memory and on disk.
+	Healthy Health = iota
+	// MemoryOnly stopped using the disk after storage errors, responses are only cached until the process exits.
+	MemoryOnly
+	// PassThrough caches nothing, every request goes to ESI.
+	PassThrough
+)
+
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "healthy"
+	case MemoryOnly:
+		return "memory-only"
+	case PassThrough:
+		return "pass-through"
+	}
+	return fmt.Sprintf("Health(%d)", int32(h))
+}
+
+// New returns a new Cache that will store items in an in-memory LRU and on disk in pebbledb.
 func New(cachDir string) (*EveCache, error) {
+	return NewWithOptions(cachDir, DefaultOptions)
+}
+
+// NewWithOptions is New with the memory bound and disk retention set by opts.
+func NewWithOptions(cachDir string, opts Options) (*EveCache, error) {
 	pebDbPath, err := db_location(cachDir)
 	if err != nil {
 		return nil, fmt.Errorf("error preping db location: %v", err)
@@ -23,75 +70,256 @@ func New(cachDir string) (*EveCache, error) {
 		return nil, fmt.Errorf("error opening: %v", err)
 	}
 
-	c := &EveCache{
-		pebbledb: pdb,
-		items:    map[string][]byte{},
-	}
+	c := newEveCache(opts)
+	c.pebbledb = pdb
+	c.disk = pdb
+	go c.compactLoop()
 	return c, nil
 }
 
-// EveCache is an implementation of Cache that stores responses in an in-memory map.
+// NewMemoryOnly returns a cache that never touches the disk, for when the disk cache can't be opened.
+func NewMemoryOnly(opts Options) *EveCache {
+	c := newEveCache(opts)
+	c.degrade()
+	close(c.done)
+	return c
+}
+
+func newEveCache(opts Options) *EveCache {
+	return &EveCache{
+		opts:    opts,
+		now:     time.Now,
+		items:   newMemoryTier(opts.MemoryBytes),
+		reading: map[string]int{},
+		written: map[string]bool{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// diskStore is the part of pebble the request path uses, tests swap it for one that fails.
+type diskStore interface {
+	Get(key []byte) ([]byte, io.Closer, error)
+	Set(key, value []byte, opts *pebble.WriteOptions) error
+	Delete(key []byte, opts *pebble.WriteOptions) error
+}
+
+// EveCache is an implementation of Cache that keeps fresh responses in a bounded in-memory LRU and every
+// response on disk in pebble until it has been expired for longer than Options.Retain.
+//
+// Storage errors never fail a request. They are logged and counted, and once Options.MaxStorageErrors is
+// reached the cache stops using the disk, see Health.
 type EveCache struct {
 	pebbledb *pebble.DB
+	disk     diskStore
+	opts     Options
+	now      func() time.Time
 
-	mu    sync.RWMutex
-	items map[string][]byte
+	// diskMu lets requests use pebble concurrently, Compact, Purge and Close take it exclusively. It is taken
+	// before mu, never while holding it.
+	diskMu sync.RWMutex
+
+	// mu guards the memory tier, the counters and the health, never disk or codec work.
+	mu    sync.Mutex
+	items *memoryTier
+	// reading counts the Gets reading each key from disk outside mu, written marks the keys set or deleted
+	// meanwhile, so those Gets don't put what they read over the newer value.
+	reading map[string]int
+	written map[string]bool
+	// Lookups since the cache was opened.
+	memoryHits, diskHits, misses int64
+	health                       Health
+	storageErrors                int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Health returns the cache's current health. A nil cache passes every request through.
+func (c *EveCache) Health() Health {
+	if c == nil {
+		return PassThrough
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.health
+}
+
+// storageError logs and counts a disk error, degrading the cache once there have been too many.
+// Must be called with c.mu held.
+func (c *EveCache) storageError(op, key string, err error) {
+	c.storageErrors++
+	fmt.Printf("evecache: error during %s of %s: %v\n", op, key, err)
+	if c.health == Healthy && c.storageErrors >= int64(c.opts.MaxStorageErrors) {
+		c.degrade()
+		fmt.Printf("evecache: %d storage errors, continuing %s\n", c.storageErrors, c.health)
+	}
+}
+
+// degrade stops using the disk, and the memory tier too if it has no room. Must be called with c.mu held.
+func (c *EveCache) degrade() {
+	c.health = MemoryOnly
+	if c.opts.MemoryBytes <= 0 {
+		c.health = PassThrough
+	}
+}
+
+// onDisk runs a disk operation, turning a panic inside pebble into an error.
+func onDisk(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pebble panic: %v", r)
+		}
+	}()
+	return fn()
 }
 
 // Get returns the []byte representation of the response and true if present, false if not
 func (c *EveCache) Get(key string) (resp []byte, ok bool) {
 	if c == nil {
-		panic("EveCache is nil")
+		return nil, false
+	}
+	c.mu.Lock()
+	if c.health == PassThrough {
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	resp, ok = c.items.get(key, c.now())
+	if ok {
+		c.memoryHits++
+		c.mu.Unlock()
+		return resp, ok
 	}
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	if c.health != Healthy {
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.reading[key]++
+	c.mu.Unlock()
 
-	resp, ok = c.items[key]
+	var dst []byte
+	var decodeErr error
+	c.diskMu.RLock()
+	err := onDisk(func() error {
+		value, closer, err := c.disk.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		dst, decodeErr = decodeValue(value)
+		return closer.Close()
+	})
+	c.diskMu.RUnlock()
 
-	if ok {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written := c.written[key]
+	if c.reading[key]--; c.reading[key] == 0 {
+		delete(c.reading, key)
+		delete(c.written, key)
+	}
+	if written {
+		// A Set or Delete raced the read, what is in memory now is newer than what was read.
+		resp, ok = c.items.get(key, c.now())
+		if ok {
+			c.memoryHits++
+		} else {
+			c.misses++
+		}
 		return resp, ok
 	}
-	value, closer, err := c.pebbledb.Get([]byte(key))
 	if err == pebble.ErrNotFound {
+		c.misses++
 		return nil, false
 	}
 	if err != nil {
-		panic(fmt.Sprintf("Error while trying to get key %s from pebble: %s", key, err))
+		c.storageError("get", key, err)
+		c.misses++
+		return nil, false
 	}
-	dst := make([]byte, len(value))
-	copy(dst, value)
-	if err := closer.Close(); err != nil {
-		panic(fmt.Sprintf("Error while trying to close pebble: %s", err))
+	if decodeErr != nil {
+		// One bad entry isn't a failing disk, treat it as a miss and let httpcache overwrite it.
+		fmt.Printf("evecache: %s: %v\n", key, decodeErr)
+		c.misses++
+		return nil, false
 	}
+	c.items.add(key, dst, responseExpires(dst), c.now())
+	c.diskHits++
 
 	return dst, true
 }
 
 // Set saves response resp to the cache with key
 func (c *EveCache) Set(key string, resp []byte) {
+	if c == nil {
+		return
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.items[key] = resp
+	if c.health == PassThrough {
+		c.mu.Unlock()
+		return
+	}
+	c.items.add(key, resp, responseExpires(resp), c.now())
+	c.wrote(key)
+	healthy := c.health == Healthy
+	c.mu.Unlock()
+	if !healthy {
+		return
+	}
 
-	// Because this is a cache, we don't need to sync (pebble.Sync) the data to disk.
-	// Also calling *EveCache.Close() will sync the data to disk.
-	err := c.pebbledb.Set([]byte(key), resp, pebble.Sync)
+	value := encodeValue(resp)
+	c.diskMu.RLock()
+	err := onDisk(func() error {
+		return c.disk.Set([]byte(key), value, pebble.Sync)
+	})
+	c.diskMu.RUnlock()
 	if err != nil {
-		panic(fmt.Sprintf("Error while trying to set key %s to pebble: %s", key, err))
+		c.mu.Lock()
+		c.storageError("set", key, err)
+		c.mu.Unlock()
 	}
 }
 
 // Delete removes key from the cache
 func (c *EveCache) Delete(key string) {
+	if c == nil {
+		return
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	delete(c.items, key)
+	c.items.remove(key)
+	c.wrote(key)
+	healthy := c.health == Healthy
+	c.mu.Unlock()
+	if !healthy {
+		return
+	}
 
-	err := c.pebbledb.Delete([]byte(key), pebble.Sync)
+	c.diskMu.RLock()
+	err := onDisk(func() error {
+		return c.disk.Delete([]byte(key), pebble.Sync)
+	})
+	c.diskMu.RUnlock()
 	if err != nil {
-		panic(fmt.Sprintf("Error while trying to delete key %s from pebble: %s", key, err))
+		c.mu.Lock()
+		c.storageError("delete", key, err)
+		c.mu.Unlock()
+	}
+}
+
+// forget drops key from the memory tier.
+func (c *EveCache) forget(key string) {
+	c.mu.Lock()
+	c.items.remove(key)
+	c.wrote(key)
+	c.mu.Unlock()
+}
+
+// wrote tells the Gets reading key from disk that it changed. Must be called with c.mu held.
+func (c *EveCache) wrote(key string) {
+	if c.reading[key] > 0 {
+		c.written[key] = true
 	}
 }
 
@@ -101,9 +329,16 @@ func (c *EveCache) Close() error {
 		return nil
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// Wait for a running compaction before closing pebble under it.
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+
+	c.diskMu.Lock()
+	defer c.diskMu.Unlock()
 
+	if c.pebbledb == nil {
+		return nil
+	}
 	return c.pebbledb.Close()
 }
 
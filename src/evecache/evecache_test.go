@@ -0,0 +1,59 @@
+package evecache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveCacheWithESI(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium"})
+	esi.AddType(&evesdk.TypeData{TypeId: 35, Name: "Pyerite"})
+
+	dir := t.TempDir()
+	c, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve := evesdk.New(esi.Client(&http.Client{Transport: httpcache.NewTransport(c)}), nil)
+	ctx := context.Background()
+
+	getName := func(typeID int32) string {
+		td, err := eve.GetTypeData(ctx, typeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return td.Name
+	}
+
+	// Fresh responses are served from the cache without asking ESI.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "Tritanium", getName(34))
+	}
+	assert.Equal(t, 1, esi.Requests("/v3/universe/types/34/"))
+
+	// The cache survives a restart.
+	assert.NoError(t, c.Close())
+	c, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	eve = evesdk.New(esi.Client(&http.Client{Transport: httpcache.NewTransport(c)}), nil)
+	assert.Equal(t, "Tritanium", getName(34))
+	assert.Equal(t, 1, esi.Requests("/v3/universe/types/34/"))
+
+	// Stale responses are revalidated with their ETag.
+	esi.CacheFor = 0
+	assert.Equal(t, "Pyerite", getName(35))
+	assert.Equal(t, "Pyerite", getName(35))
+	assert.Equal(t, 2, esi.Requests("/v3/universe/types/35/"))
+	assert.Equal(t, 1, esi.NotModified())
+}
@@ -0,0 +1,178 @@
+package evecache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenDisk fails every write and panics on reads, like pebble does on some corruption.
+type brokenDisk struct{}
+
+func (brokenDisk) Get(key []byte) ([]byte, io.Closer, error) { panic("corrupt sstable") }
+func (brokenDisk) Set(key, value []byte, opts *pebble.WriteOptions) error {
+	return errors.New("no space left on device")
+}
+func (brokenDisk) Delete(key []byte, opts *pebble.WriteOptions) error {
+	return errors.New("no space left on device")
+}
+
+func TestStorageErrorsDegrade(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, MaxStorageErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.disk = brokenDisk{}
+	fresh := rawResponse(time.Now().Add(time.Hour), "[]")
+
+	c.Set("a", fresh)
+	assert.Equal(t, Healthy, c.Health())
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, MemoryOnly, c.Health(), "a panicking read counts as a storage error")
+
+	// Memory-only keeps caching in memory.
+	c.Set("b", fresh)
+	resp, ok := c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, fresh, resp)
+
+	stats, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.StorageErrors)
+	assert.Equal(t, MemoryOnly, stats.Health)
+}
+
+func TestPassThrough(t *testing.T) {
+	c := NewMemoryOnly(Options{})
+	assert.Equal(t, PassThrough, c.Health())
+	c.Set("a", rawResponse(time.Now().Add(time.Hour), "[]"))
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.NoError(t, c.Close())
+
+	var nilCache *EveCache
+	nilCache.Set("a", nil)
+	_, ok = nilCache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, PassThrough, nilCache.Health())
+}
+
+// slowDisk blocks writes until release is closed.
+type slowDisk struct {
+	diskStore
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (d slowDisk) Set(key, value []byte, opts *pebble.WriteOptions) error {
+	close(d.writing)
+	<-d.release
+	return d.diskStore.Set(key, value, opts)
+}
+
+func TestDiskWritesDontBlockMemoryHits(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, MaxStorageErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fresh := rawResponse(time.Now().Add(time.Hour), "[]")
+	c.Set("a", fresh)
+
+	disk := slowDisk{diskStore: c.disk, writing: make(chan struct{}), release: make(chan struct{})}
+	c.disk = disk
+	done := make(chan struct{})
+	go func() {
+		c.Set("b", fresh)
+		close(done)
+	}()
+	<-disk.writing
+
+	// The write to b is stuck on the disk, a's memory hit doesn't wait for it.
+	resp, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, fresh, resp)
+	close(disk.release)
+	<-done
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+}
+
+// slowReads blocks reads until release is closed.
+type slowReads struct {
+	diskStore
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (d slowReads) Get(key []byte) ([]byte, io.Closer, error) {
+	close(d.reading)
+	<-d.release
+	return d.diskStore.Get(key)
+}
+
+func TestGetDoesntUndoConcurrentSet(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, MaxStorageErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	old := rawResponse(time.Now().Add(time.Hour), `["old"]`)
+	newer := rawResponse(time.Now().Add(time.Hour), `["new"]`)
+	c.Set("a", old)
+	c.forget("a")
+
+	disk := slowReads{diskStore: c.disk, reading: make(chan struct{}), release: make(chan struct{})}
+	c.disk = disk
+	got := make(chan []byte)
+	go func() {
+		resp, _ := c.Get("a")
+		got <- resp
+	}()
+	<-disk.reading
+	c.disk = disk.diskStore
+	c.Set("a", newer)
+	close(disk.release)
+
+	assert.Equal(t, newer, <-got, "the Set landed while the old value was being read")
+	resp, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, newer, resp, "the old value didn't replace it in memory")
+}
+
+func TestConcurrentGetSet(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 10, MaxStorageErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c.Set(fmt.Sprint("k", j%5), rawResponse(time.Now().Add(time.Hour), fmt.Sprintf("[%d]", i*100+j)))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c.Get(fmt.Sprint("k", j%5))
+			}
+		}()
+	}
+	wg.Wait()
+	for j := 0; j < 5; j++ {
+		_, ok := c.Get(fmt.Sprint("k", j))
+		assert.True(t, ok)
+	}
+}
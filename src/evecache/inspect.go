@@ -0,0 +1,194 @@
+package evecache
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Keys are httpcache's cache keys, which for GET requests are the request URL, so prefixes filter by URL.
+
+var errNoDisk = fmt.Errorf("the disk cache isn't open")
+
+// Entry describes one cached response.
+type Entry struct {
+	Key     string
+	Size    int // bytes of the raw response
+	Stored  int // bytes on disk, smaller than Size when compressed
+	Status  int
+	Date    time.Time // when ESI produced the response
+	Expires time.Time
+}
+
+// Stats describes the cache contents and its lookups since it was opened.
+type Stats struct {
+	Entries       int
+	Bytes         int64 // raw response bytes
+	StoredBytes   int64 // bytes on disk after compression
+	MemoryEntries int
+	MemoryBytes   int64
+	MemoryHits    int64
+	DiskHits      int64
+	Misses        int64
+	Oldest        time.Time
+	Newest        time.Time
+	Health        Health
+	StorageErrors int64
+}
+
+// HitRatio is the share of lookups answered from memory or disk.
+func (s Stats) HitRatio() float64 {
+	total := s.MemoryHits + s.DiskHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.MemoryHits+s.DiskHits) / float64(total)
+}
+
+// CompressionRatio is how many raw bytes each stored byte holds.
+func (s Stats) CompressionRatio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+	return float64(s.Bytes) / float64(s.StoredBytes)
+}
+
+// Stats scans the disk cache and returns its totals along with the lookup counters.
+func (c *EveCache) Stats() (Stats, error) {
+	c.mu.Lock()
+	stats := Stats{
+		MemoryEntries: c.items.len(),
+		MemoryBytes:   c.items.size,
+		MemoryHits:    c.memoryHits,
+		DiskHits:      c.diskHits,
+		Misses:        c.misses,
+		Health:        c.health,
+		StorageErrors: c.storageErrors,
+	}
+	c.mu.Unlock()
+	if c.pebbledb == nil {
+		return stats, nil
+	}
+
+	err := c.Entries("", func(e Entry) error {
+		stats.Entries++
+		stats.Bytes += int64(e.Size)
+		stats.StoredBytes += int64(e.Stored)
+		if e.Date.IsZero() {
+			return nil
+		}
+		if stats.Oldest.IsZero() || e.Date.Before(stats.Oldest) {
+			stats.Oldest = e.Date
+		}
+		if e.Date.After(stats.Newest) {
+			stats.Newest = e.Date
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Entries calls fn for every cached response whose key starts with prefix, in key order.
+func (c *EveCache) Entries(prefix string, fn func(e Entry) error) error {
+	if c.pebbledb == nil {
+		return errNoDisk
+	}
+	iter := c.pebbledb.NewIter(prefixIterOptions(prefix))
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := fn(newEntry(string(iter.Key()), iter.Value())); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("error scanning cache: %v", err)
+	}
+	return nil
+}
+
+// Raw returns the response stored for key exactly as httpcache wrote it.
+func (c *EveCache) Raw(key string) ([]byte, error) {
+	if c.pebbledb == nil {
+		return nil, errNoDisk
+	}
+	value, closer, err := c.pebbledb.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return nil, fmt.Errorf("no cache entry for %s", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", key, err)
+	}
+	defer closer.Close()
+	return decodeValue(value)
+}
+
+// Purge removes the responses whose key starts with prefix and, when olderThan is set, that ESI produced more
+// than olderThan ago. It returns how many were removed.
+func (c *EveCache) Purge(prefix string, olderThan time.Duration) (int, error) {
+	if c.pebbledb == nil {
+		return 0, errNoDisk
+	}
+	cutoff := c.now().Add(-olderThan)
+
+	c.diskMu.Lock()
+	defer c.diskMu.Unlock()
+
+	b := c.pebbledb.NewBatch()
+	defer b.Close()
+	purged := 0
+	iter := c.pebbledb.NewIter(prefixIterOptions(prefix))
+	for iter.First(); iter.Valid(); iter.Next() {
+		if olderThan > 0 && !newEntry(string(iter.Key()), iter.Value()).Date.Before(cutoff) {
+			continue
+		}
+		if err := b.Delete(iter.Key(), nil); err != nil {
+			iter.Close()
+			return 0, fmt.Errorf("error deleting %s: %v", iter.Key(), err)
+		}
+		c.forget(string(iter.Key()))
+		purged++
+	}
+	if err := iter.Close(); err != nil {
+		return 0, fmt.Errorf("error scanning cache: %v", err)
+	}
+	if err := b.Commit(pebble.Sync); err != nil {
+		return 0, fmt.Errorf("error committing purge: %v", err)
+	}
+	return purged, nil
+}
+
+func newEntry(key string, stored []byte) Entry {
+	e := Entry{Key: key, Size: len(stored), Stored: len(stored)}
+	raw, err := decodeValue(stored)
+	if err != nil {
+		return e
+	}
+	e.Size = len(raw)
+	status, h, err := responseHeader(raw)
+	if err != nil {
+		return e
+	}
+	e.Status = status
+	e.Date, _ = http.ParseTime(h.Get("Date"))
+	e.Expires, _ = http.ParseTime(h.Get("Expires"))
+	return e
+}
+
+func prefixIterOptions(prefix string) *pebble.IterOptions {
+	if prefix == "" {
+		return nil
+	}
+	opts := &pebble.IterOptions{LowerBound: []byte(prefix)}
+	// The upper bound is the prefix with its last byte incremented, dropping trailing 0xff bytes.
+	upper := []byte(prefix)
+	for i := len(upper) - 1; i >= 0; i-- {
+		if upper[i] != 0xff {
+			upper[i]++
+			opts.UpperBound = upper[:i+1]
+			break
+		}
+	}
+	return opts
+}
@@ -0,0 +1,59 @@
+package evecache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectAndPurge(t *testing.T) {
+	c, err := NewWithOptions(t.TempDir(), Options{MemoryBytes: 1 << 20, Retain: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	now := time.Now().Truncate(time.Second)
+	set := func(key string, age time.Duration) {
+		date := now.Add(-age).UTC().Format(http.TimeFormat)
+		c.Set(key, []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nDate: %s\r\nExpires: %s\r\nContent-Length: 2\r\n\r\n[]", date, date)))
+	}
+	set("https://esi.evetech.net/v1/markets/10000002/orders/?page=1", time.Minute)
+	set("https://esi.evetech.net/v1/markets/10000002/orders/?page=2", 2*time.Hour)
+	set("https://esi.evetech.net/v1/universe/regions/", 3*time.Hour)
+
+	c.Get("https://esi.evetech.net/v1/universe/regions/")
+	c.Get("https://esi.evetech.net/v1/universe/types/")
+
+	stats, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, int64(1), stats.DiskHits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, 0.5, stats.HitRatio())
+	assert.True(t, stats.Oldest.Equal(now.Add(-3*time.Hour)))
+	assert.True(t, stats.Newest.Equal(now.Add(-time.Minute)))
+
+	var keys []string
+	assert.NoError(t, c.Entries("https://esi.evetech.net/v1/markets/", func(e Entry) error {
+		keys = append(keys, e.Key)
+		return nil
+	}))
+	assert.Equal(t, 2, len(keys))
+
+	n, err := c.Purge("https://esi.evetech.net/v1/markets/", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = c.Purge("", 150*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = c.Raw("https://esi.evetech.net/v1/universe/regions/")
+	assert.Error(t, err)
+	raw, err := c.Raw("https://esi.evetech.net/v1/markets/10000002/orders/?page=1")
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "200 OK")
+}
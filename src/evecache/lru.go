@@ -0,0 +1,69 @@
+package evecache
+
+import (
+	"container/list"
+	"time"
+)
+
+// memoryTier is a size bounded LRU of fresh responses in front of pebble. Entries leave it once their
+// Expires has passed, httpcache will revalidate them and the stale copy is still on disk for that.
+type memoryTier struct {
+	max   int64
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryTier(maxBytes int64) *memoryTier {
+	return &memoryTier{max: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (m *memoryTier) get(key string, now time.Time) ([]byte, bool) {
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memoryEntry)
+	if !now.Before(e.expires) {
+		m.removeElement(el)
+		return nil, false
+	}
+	m.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// add stores value, evicting the least recently used entries to stay under the size bound. Values that are
+// already expired or bigger than the whole tier aren't kept.
+func (m *memoryTier) add(key string, value []byte, expires time.Time, now time.Time) {
+	m.remove(key)
+	if !now.Before(expires) || int64(len(value)) > m.max {
+		return
+	}
+	m.items[key] = m.ll.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	m.size += int64(len(value))
+	for m.size > m.max {
+		m.removeElement(m.ll.Back())
+	}
+}
+
+func (m *memoryTier) remove(key string) {
+	if el, ok := m.items[key]; ok {
+		m.removeElement(el)
+	}
+}
+
+func (m *memoryTier) removeElement(el *list.Element) {
+	e := m.ll.Remove(el).(*memoryEntry)
+	delete(m.items, e.key)
+	m.size -= int64(len(e.value))
+}
+
+func (m *memoryTier) len() int {
+	return m.ll.Len()
+}
@@ -0,0 +1,98 @@
+package evecache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache"
+)
+
+// StaleHeader is set to "1" on responses the offline transport served after they had expired. Their Age header
+// says how old they are.
+const StaleHeader = "X-Eveland-Stale"
+
+// OfflineStats counts what the offline transport served.
+type OfflineStats struct {
+	Hits   int           // responses served from the cache
+	Stale  int           // hits that had already expired
+	Misses int           // requests the cache couldn't answer
+	Oldest time.Duration // age of the oldest response served
+}
+
+func (s OfflineStats) String() string {
+	return fmt.Sprintf("served %d responses from cache, %d stale, oldest %v old, %d not cached",
+		s.Hits, s.Stale, s.Oldest.Round(time.Second), s.Misses)
+}
+
+// Offline is an http.RoundTripper for working without the network. It sits on top of the httpcache transport
+// and asks it for cached responses only, whatever their freshness, so nothing is ever revalidated.
+type Offline struct {
+	cache *httpcache.Transport
+	now   func() time.Time
+
+	mu    sync.Mutex
+	stats OfflineStats
+}
+
+// NewOffline serves every request from the cache behind tp.
+func NewOffline(tp *httpcache.Transport) *Offline {
+	tp.MarkCachedResponses = true
+	return &Offline{cache: tp, now: time.Now}
+}
+
+// Stats returns what has been served so far.
+func (o *Offline) Stats() OfflineStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stats
+}
+
+func (o *Offline) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("offline: can't send %s %s", req.Method, req.URL)
+	}
+	if authenticated(req) {
+		o.mu.Lock()
+		o.stats.Misses++
+		o.mu.Unlock()
+		return nil, fmt.Errorf("offline: authenticated responses aren't cached, can't get %s", req.URL)
+	}
+
+	// only-if-cached makes httpcache treat any cached response as fresh, and answer a miss with a 504
+	// instead of going to the network.
+	req2 := req.Clone(req.Context())
+	req2.Header.Set("Cache-Control", "only-if-cached")
+	resp, err := o.cache.RoundTrip(req2)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if resp.Header.Get(httpcache.XFromCache) == "" {
+		resp.Body.Close()
+		o.stats.Misses++
+		return nil, fmt.Errorf("offline: no cached response for %s", req.URL)
+	}
+
+	o.stats.Hits++
+	now := o.now()
+	if date, err := httpcache.Date(resp.Header); err == nil {
+		age := now.Sub(date)
+		if age < 0 {
+			age = 0
+		}
+		resp.Header.Set("Age", strconv.Itoa(int(age.Seconds())))
+		if age > o.stats.Oldest {
+			o.stats.Oldest = age
+		}
+	}
+	if expires, err := http.ParseTime(resp.Header.Get("Expires")); err != nil || !now.Before(expires) {
+		resp.Header.Set(StaleHeader, "1")
+		o.stats.Stale++
+	}
+	return resp, nil
+}
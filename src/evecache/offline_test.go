@@ -0,0 +1,65 @@
+package evecache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffline(t *testing.T) {
+	esi := esitest.New()
+	esi.CacheFor = 0
+	esi.PageSize = 1
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	esi.AddOrders(forge.RegionID,
+		&evesdk.MarketOrder{OrderID: 1, TypeID: 34, Price: 5, Issued: time.Now().UTC()},
+		&evesdk.MarketOrder{OrderID: 2, TypeID: 34, Price: 6, Issued: time.Now().UTC()},
+	)
+
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	tp := httpcache.NewTransport(c)
+	ctx := context.Background()
+
+	// Fill the cache while online, every response is already expired.
+	orders, err := evesdk.New(esi.Client(&http.Client{Transport: tp}), nil).ListAllMarketOrdersForRegion(ctx, forge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(orders))
+	esi.Close()
+
+	offline := NewOffline(tp)
+	now := time.Now()
+	offline.now = func() time.Time { return now.Add(time.Hour) }
+	eve := evesdk.New(esi.Client(&http.Client{Transport: offline}), nil)
+
+	var report *evesdk.PageReport
+	report, err = eve.StreamMarketOrdersForRegion(ctx, forge, func(page []*evesdk.MarketOrder) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, report.Err())
+	assert.True(t, report.Stale)
+	assert.True(t, report.Age >= time.Hour-time.Minute, "age is %v", report.Age)
+
+	_, err = eve.GetTypeData(ctx, 34)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no cached response")
+	}
+
+	stats := offline.Stats()
+	assert.Equal(t, 2, stats.Hits)
+	assert.Equal(t, 2, stats.Stale)
+	assert.Equal(t, 1, stats.Misses)
+}
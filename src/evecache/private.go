@@ -0,0 +1,34 @@
+package evecache
+
+import (
+	"net/http"
+
+	"github.com/gregjones/httpcache"
+)
+
+// PublicOnly is an http.RoundTripper in front of the httpcache transport that sends authenticated requests,
+// the ones with an Authorization header, around the cache. Character wallets, assets and orders then never
+// end up on disk, where the cache keeps responses as they came back.
+type PublicOnly struct {
+	cache *httpcache.Transport
+}
+
+// NewPublicOnly caches only the unauthenticated requests made through tp.
+func NewPublicOnly(tp *httpcache.Transport) *PublicOnly {
+	return &PublicOnly{cache: tp}
+}
+
+func (p *PublicOnly) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !authenticated(req) {
+		return p.cache.RoundTrip(req)
+	}
+	next := p.cache.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+func authenticated(req *http.Request) bool {
+	return req.Header.Get("Authorization") != ""
+}
@@ -0,0 +1,71 @@
+package evecache
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antihax/goesi"
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/gregjones/httpcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthenticatedResponsesAreNotKept(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.AddType(&evesdk.TypeData{TypeId: 34, Name: "Tritanium"})
+	esi.AddCharacterOrders(90000001, &evesdk.CharacterOrder{OrderID: 100, TypeID: 34, RegionID: 10000002, LocationID: 60003760, Price: 5.2})
+	ordersPath := "/v2/characters/90000001/orders/"
+
+	c, err := New(t.TempDir())
+	require.NoError(t, err)
+	defer c.Close()
+	fixture := filepath.Join(t.TempDir(), "run.jsonl")
+	rec, err := NewRecorder(NewPublicOnly(httpcache.NewTransport(c)), fixture)
+	require.NoError(t, err)
+	eve := evesdk.New(esi.Client(&http.Client{Transport: rec}), nil)
+
+	// Without an SSO the fake takes any token.
+	ctx := context.Background()
+	authCtx := context.WithValue(ctx, goesi.ContextOAuth2, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	for i := 0; i < 2; i++ {
+		_, err = eve.GetTypeData(ctx, 34)
+		require.NoError(t, err)
+		orders, err := eve.ListCharacterOrders(authCtx, 90000001)
+		require.NoError(t, err)
+		assert.Len(t, orders, 1)
+	}
+	assert.NoError(t, rec.Close())
+	assert.Equal(t, 1, esi.Requests("/v3/universe/types/34/"), "public responses are cached")
+	assert.Equal(t, 2, esi.Requests(ordersPath), "authenticated ones aren't")
+
+	keys := []string{}
+	assert.NoError(t, c.Entries("", func(e Entry) error {
+		keys = append(keys, e.Key)
+		return nil
+	}))
+	assert.Len(t, keys, 1)
+	for _, key := range keys {
+		assert.False(t, strings.Contains(key, ordersPath), "cached %s", key)
+	}
+
+	rep, err := NewReplayer(fixture)
+	require.NoError(t, err)
+	eve = evesdk.New(esi.Client(&http.Client{Transport: rep}), nil)
+	_, err = eve.GetTypeData(ctx, 34)
+	assert.NoError(t, err)
+	_, err = eve.ListCharacterOrders(authCtx, 90000001)
+	assert.Error(t, err, "the authenticated exchange wasn't recorded")
+
+	_, err = evesdk.New(esi.Client(&http.Client{Transport: NewOffline(httpcache.NewTransport(c))}), nil).
+		ListCharacterOrders(authCtx, 90000001)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "authenticated responses aren't cached")
+	}
+}
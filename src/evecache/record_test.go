@@ -0,0 +1,61 @@
+package evecache
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	esi := esitest.New()
+	esi.PageSize = 2
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	for i := 1; i <= 5; i++ {
+		esi.AddOrders(forge.RegionID, &evesdk.MarketOrder{OrderID: int64(i), TypeID: 34, Price: float64(i), Issued: time.Now().UTC()})
+	}
+	fixture := filepath.Join(t.TempDir(), "forge.jsonl")
+	ctx := context.Background()
+
+	orderIDs := func(eve *evesdk.EveLand) []int64 {
+		orders, err := eve.ListAllMarketOrdersForRegion(ctx, forge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, o := range orders {
+			ids = append(ids, o.OrderID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	rec, err := NewRecorder(nil, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := orderIDs(evesdk.New(esi.Client(&http.Client{Transport: rec}), nil))
+	assert.NoError(t, rec.Close())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, recorded)
+
+	// The fake is gone, everything has to come from the fixture.
+	esi.Close()
+	rep, err := NewReplayer(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve := evesdk.New(esi.Client(&http.Client{Transport: rep}), nil)
+	assert.Equal(t, recorded, orderIDs(eve))
+	assert.Empty(t, rep.Unmatched())
+
+	_, err = eve.GetTypeData(ctx, 34)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"GET " + esi.URL + "/v3/universe/types/34/"}, rep.Unmatched())
+}
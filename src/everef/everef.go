@@ -0,0 +1,337 @@
+// Package everef imports the market order and market history dumps published at https://data.everef.net/
+// from local files, so the order index can be backfilled without calling ESI.
+package everef
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbmarkethistory"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// BatchSize is how many rows are handed to the sink at a time.
+const BatchSize = 10_000
+
+// OrderSink receives imported market orders, dbmarketorders.MarketOrderStore satisfies it.
+type OrderSink interface {
+	Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error
+}
+
+// HistorySink receives imported market history, dbmarkethistory.HistoryDataDB satisfies it.
+type HistorySink interface {
+	Upsert(ctx context.Context, days []*dbmarkethistory.HistoryDay) error
+}
+
+// Filter restricts what is imported. Empty lists import everything.
+type Filter struct {
+	RegionIDs []int32
+}
+
+func (f Filter) allowsRegion(regionID int32) bool {
+	if len(f.RegionIDs) == 0 {
+		return true
+	}
+	for _, id := range f.RegionIDs {
+		if id == regionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Dumps lists the market order and market history dump files in dir, oldest first.
+func Dumps(dir string) (orderFiles, historyFiles []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing dump directory: %v", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isCSV(e.Name()) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(e.Name(), "market-orders-"):
+			orderFiles = append(orderFiles, filepath.Join(dir, e.Name()))
+		case strings.HasPrefix(e.Name(), "market-history-"):
+			historyFiles = append(historyFiles, filepath.Join(dir, e.Name()))
+		}
+	}
+	// The dump file names embed the snapshot time, so a lexical sort is chronological.
+	sort.Strings(orderFiles)
+	sort.Strings(historyFiles)
+	return orderFiles, historyFiles, nil
+}
+
+func isCSV(name string) bool {
+	for _, ext := range []string{".csv", ".csv.bz2", ".csv.gz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportOrders reads a market order snapshot (e.g. market-orders-2023-03-01_00-00-00.v3.csv.bz2) and writes
+// its orders to sink in batches. It returns the number of orders imported.
+func ImportOrders(ctx context.Context, path string, filter Filter, sink OrderSink) (int, error) {
+	r, closer, err := openCSV(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	cols, err := readHeader(r, "order_id", "type_id", "location_id", "system_id", "region_id", "volume_total",
+		"volume_remain", "min_volume", "price", "is_buy_order", "issued", "duration", "range")
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	count, line := 0, 1
+	batch := make([]*evesdk.MarketOrder, 0, BatchSize)
+	for {
+		line++
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("error reading %s: %v", path, err)
+		}
+
+		p := rowParser{rec: rec, cols: cols}
+		regionID := p.int32("region_id")
+		order := &evesdk.MarketOrder{
+			OrderID:      p.int64("order_id"),
+			TypeID:       p.int32("type_id"),
+			LocationID:   p.int64("location_id"),
+			SystemID:     p.int32("system_id"),
+			VolumeTotal:  p.int32("volume_total"),
+			VolumeRemain: p.int32("volume_remain"),
+			MinVolume:    p.int32("min_volume"),
+			Price:        p.float64("price"),
+			IsBuyOrder:   p.bool("is_buy_order"),
+			Issued:       p.time("issued"),
+			Duration:     p.int32("duration"),
+			Range_:       p.string("range"),
+		}
+		if p.err != nil {
+			return count, fmt.Errorf("error parsing %s line %d: %v", path, line, p.err)
+		}
+		if !filter.allowsRegion(regionID) {
+			continue
+		}
+
+		batch = append(batch, order)
+		if len(batch) == BatchSize {
+			if err := sink.Upsert(ctx, batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := sink.Upsert(ctx, batch); err != nil {
+			return count, err
+		}
+		count += len(batch)
+	}
+	return count, nil
+}
+
+// ImportHistory reads a market history dump (e.g. market-history-2023-03-01.csv.bz2) into sink.
+func ImportHistory(ctx context.Context, path string, filter Filter, sink HistorySink) (int, error) {
+	r, closer, err := openCSV(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	cols, err := readHeader(r, "region_id", "type_id", "date", "average", "highest", "lowest", "order_count", "volume")
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	count, line := 0, 1
+	batch := make([]*dbmarkethistory.HistoryDay, 0, BatchSize)
+	for {
+		line++
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("error reading %s: %v", path, err)
+		}
+
+		p := rowParser{rec: rec, cols: cols}
+		day := &dbmarkethistory.HistoryDay{
+			RegionID:   p.int32("region_id"),
+			TypeID:     p.int32("type_id"),
+			Date:       p.time("date"),
+			Average:    p.float64("average"),
+			Highest:    p.float64("highest"),
+			Lowest:     p.float64("lowest"),
+			OrderCount: p.int64("order_count"),
+			Volume:     p.int64("volume"),
+		}
+		if p.err != nil {
+			return count, fmt.Errorf("error parsing %s line %d: %v", path, line, p.err)
+		}
+		if !filter.allowsRegion(day.RegionID) {
+			continue
+		}
+
+		batch = append(batch, day)
+		if len(batch) == BatchSize {
+			if err := sink.Upsert(ctx, batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := sink.Upsert(ctx, batch); err != nil {
+			return count, err
+		}
+		count += len(batch)
+	}
+	return count, nil
+}
+
+// openCSV opens a plain, bzip2 or gzip compressed CSV file.
+func openCSV(path string) (*csv.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(path, ".bz2"):
+		r = bzip2.NewReader(f)
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("error opening gzip stream %s: %v", path, err)
+		}
+		r = gz
+	}
+
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	return cr, f, nil
+}
+
+// readHeader maps column names to their index, the dumps have added columns over time so we never rely on order.
+func readHeader(r *csv.Reader, required ...string) (map[string]int, error) {
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+	for _, name := range required {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return cols, nil
+}
+
+// rowParser reads typed values out of a CSV record, keeping the first error.
+type rowParser struct {
+	rec  []string
+	cols map[string]int
+	err  error
+}
+
+func (p *rowParser) string(col string) string {
+	i := p.cols[col]
+	if i >= len(p.rec) {
+		if p.err == nil {
+			p.err = fmt.Errorf("short record, no column %q", col)
+		}
+		return ""
+	}
+	return p.rec[i]
+}
+
+func (p *rowParser) int64(col string) int64 {
+	s := p.string(col)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("column %q: %v", col, err)
+	}
+	return v
+}
+
+func (p *rowParser) int32(col string) int32 {
+	s := p.string(col)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("column %q: %v", col, err)
+	}
+	return int32(v)
+}
+
+func (p *rowParser) float64(col string) float64 {
+	s := p.string(col)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("column %q: %v", col, err)
+	}
+	return v
+}
+
+func (p *rowParser) bool(col string) bool {
+	s := p.string(col)
+	if s == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("column %q: %v", col, err)
+	}
+	return v
+}
+
+func (p *rowParser) time(col string) time.Time {
+	s := p.string(col)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	if p.err == nil {
+		p.err = fmt.Errorf("column %q: unrecognised time %q", col, s)
+	}
+	return time.Time{}
+}
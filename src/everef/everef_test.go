@@ -0,0 +1,86 @@
+package everef
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/epsniff/eveland/src/dbmarkethistory"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+type orderCollector struct {
+	orders []*evesdk.MarketOrder
+}
+
+func (c *orderCollector) Upsert(ctx context.Context, orders []*evesdk.MarketOrder) error {
+	c.orders = append(c.orders, orders...)
+	return nil
+}
+
+type historyCollector struct {
+	days []*dbmarkethistory.HistoryDay
+}
+
+func (c *historyCollector) Upsert(ctx context.Context, days []*dbmarkethistory.HistoryDay) error {
+	c.days = append(c.days, days...)
+	return nil
+}
+
+const testOrders = `duration,is_buy_order,issued,location_id,min_volume,order_id,price,range,system_id,type_id,volume_remain,volume_total,region_id,http_last_modified
+90,false,2023-02-27T10:04:48Z,60003760,1,6431452069,5.21,region,30000142,34,1000000,1500000,10000002,2023-03-01T00:00:00Z
+30,true,2023-02-28T11:00:00Z,60008494,1,6431452070,4.90,station,30002187,34,200,500,10000043,2023-03-01T00:00:00Z
+`
+
+const testHistory = `average,date,highest,lowest,order_count,volume,http_last_modified,region_id,type_id
+5.10,2023-02-28,5.30,4.95,1200,850000000,2023-03-01T00:00:00Z,10000002,34
+`
+
+func writeGzip(t *testing.T, path, content string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportDumps(t *testing.T) {
+	dir := t.TempDir()
+	writeGzip(t, filepath.Join(dir, "market-orders-2023-03-01_00-00-00.v3.csv.gz"), testOrders)
+	writeGzip(t, filepath.Join(dir, "market-history-2023-02-28.csv.gz"), testHistory)
+
+	orderFiles, historyFiles, err := Dumps(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(orderFiles))
+	assert.Equal(t, 1, len(historyFiles))
+
+	orders := &orderCollector{}
+	cnt, err := ImportOrders(context.Background(), orderFiles[0], Filter{RegionIDs: []int32{10000002}}, orders)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	if assert.Equal(t, 1, len(orders.orders)) {
+		o := orders.orders[0]
+		assert.Equal(t, int64(6431452069), o.OrderID)
+		assert.Equal(t, int32(30000142), o.SystemID)
+		assert.Equal(t, 5.21, o.Price)
+		assert.False(t, o.IsBuyOrder)
+		assert.Equal(t, "region", o.Range_)
+		assert.Equal(t, 2023, o.Issued.Year())
+	}
+
+	history := &historyCollector{}
+	cnt, err = ImportHistory(context.Background(), historyFiles[0], Filter{}, history)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, int64(850000000), history.days[0].Volume)
+}
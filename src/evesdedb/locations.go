@@ -0,0 +1,60 @@
+package evesdedb
+
+import "fmt"
+
+// StationIDToName returns the name of an NPC station. Player structures aren't in the SDE.
+func (e *EveSDEDB) StationIDToName(stationID int64) (string, error) {
+	stmt, err := e.evesde.Prepare("SELECT stationName FROM staStations WHERE stationID = ?")
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+
+	var stationName string
+	err = stmt.QueryRow(stationID).Scan(&stationName)
+	if err != nil {
+		return "", err
+	}
+
+	return stationName, nil
+}
+
+// GetRegionID returns the region ID for a region name.
+func (e *EveSDEDB) GetRegionID(regionName string) (int32, error) {
+	stmt, err := e.evesde.Prepare("SELECT regionID FROM mapRegions WHERE regionName = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var regionID int32
+	err = stmt.QueryRow(regionName).Scan(&regionID)
+	if err != nil {
+		return 0, err
+	}
+
+	return regionID, nil
+}
+
+// SystemIDsInRegion returns the IDs of every solar system in a region.
+func (e *EveSDEDB) SystemIDsInRegion(regionID int32) ([]int32, error) {
+	rows, err := e.evesde.Query("SELECT solarSystemID FROM mapSolarSystems WHERE regionID = ?", regionID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %s", err.Error())
+	}
+	defer rows.Close()
+
+	systemIDs := []int32{}
+	for rows.Next() {
+		var systemID int32
+		if err := rows.Scan(&systemID); err != nil {
+			return nil, fmt.Errorf("error scanning row: %s", err.Error())
+		}
+		systemIDs = append(systemIDs, systemID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %s", err.Error())
+	}
+
+	return systemIDs, nil
+}
@@ -0,0 +1,65 @@
+package evesdedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// ListTypes returns every type in invTypes as the TypeData ESI would give for it. PackagedVolume comes from
+// invVolumes, which only lists the types that shrink when packaged, e.g. ships, the rest pack to their volume.
+// SDE dumps without invVolumes are read as if it were empty.
+func (e *EveSDEDB) ListTypes(ctx context.Context) ([]*evesdk.TypeData, error) {
+	var hasVolumes int
+	err := e.evesde.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'invVolumes'").Scan(&hasVolumes)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %s", err.Error())
+	}
+	packaged := "t.volume"
+	join := ""
+	if hasVolumes > 0 {
+		packaged = "COALESCE(v.volume, t.volume)"
+		join = "LEFT JOIN invVolumes v ON v.typeID = t.typeID"
+	}
+
+	rows, err := e.evesde.QueryContext(ctx, `SELECT t.typeID, t.groupID, t.typeName, t.description, t.mass, t.volume,
+		`+packaged+`, t.capacity, t.portionSize, t.published, t.marketGroupID, t.iconID, t.graphicID
+		FROM invTypes t `+join)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %s", err.Error())
+	}
+	defer rows.Close()
+
+	types := []*evesdk.TypeData{}
+	for rows.Next() {
+		var td evesdk.TypeData
+		var description sql.NullString
+		var mass, volume, packagedVolume, capacity sql.NullFloat64
+		var groupID, portionSize, marketGroupID, iconID, graphicID sql.NullInt32
+		var published sql.NullBool
+		err := rows.Scan(&td.TypeId, &groupID, &td.Name, &description, &mass, &volume, &packagedVolume, &capacity,
+			&portionSize, &published, &marketGroupID, &iconID, &graphicID)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %s", err.Error())
+		}
+		td.GroupId = groupID.Int32
+		td.Description = description.String
+		td.Mass = float32(mass.Float64)
+		td.Volume = float32(volume.Float64)
+		td.PackagedVolume = float32(packagedVolume.Float64)
+		td.Capacity = float32(capacity.Float64)
+		td.PortionSize = portionSize.Int32
+		td.Published = published.Bool
+		td.MarketGroupId = marketGroupID.Int32
+		td.IconId = iconID.Int32
+		td.GraphicId = graphicID.Int32
+		types = append(types, &td)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %s", err.Error())
+	}
+
+	return types, nil
+}
@@ -0,0 +1,75 @@
+package evesdedb
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// invTypes is the fuzzwork dump's schema, trimmed to the columns ListTypes reads.
+const invTypes = `CREATE TABLE invTypes (typeID INTEGER PRIMARY KEY, groupID INTEGER, typeName VARCHAR(100),
+	description TEXT, mass FLOAT, volume FLOAT, capacity FLOAT, portionSize INTEGER, published BOOLEAN,
+	marketGroupID INTEGER, iconID INTEGER, graphicID INTEGER);
+INSERT INTO invTypes VALUES (34, 18, 'Tritanium', 'The main building block.', 0, 0.01, 0, 1, 1, 1857, 22, NULL);
+INSERT INTO invTypes VALUES (587, 25, 'Rifter', NULL, 1067000, 27289, 140, 1, 1, 64, NULL, 46);
+INSERT INTO invTypes VALUES (3467, 448, 'Secure Container', NULL, NULL, 1, 120, 1, 0, NULL, NULL, NULL);`
+
+func writeSDE(t *testing.T, schema string) *EveSDEDB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, DBNAME))
+	require.NoError(t, err)
+	_, err = db.Exec(schema)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	sde, err := New(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { sde.Close() })
+	return sde
+}
+
+func TestListTypes(t *testing.T) {
+	sde := writeSDE(t, invTypes+`
+CREATE TABLE invVolumes (typeID INTEGER PRIMARY KEY, volume INTEGER);
+INSERT INTO invVolumes VALUES (587, 2500);`)
+
+	types, err := sde.ListTypes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, types, 3)
+	byID := map[int32]int{}
+	for i, td := range types {
+		byID[td.TypeId] = i
+	}
+
+	trit := types[byID[34]]
+	assert.Equal(t, "Tritanium", trit.Name)
+	assert.Equal(t, int32(18), trit.GroupId)
+	assert.Equal(t, int32(1857), trit.MarketGroupId)
+	assert.Equal(t, float32(0.01), trit.PackagedVolume, "packs to its volume")
+	assert.True(t, trit.Published)
+
+	rifter := types[byID[587]]
+	assert.Equal(t, float32(27289), rifter.Volume)
+	assert.Equal(t, float32(2500), rifter.PackagedVolume)
+	assert.Equal(t, int32(46), rifter.GraphicId)
+
+	can := types[byID[3467]]
+	assert.Zero(t, can.MarketGroupId)
+	assert.False(t, can.Published)
+}
+
+func TestListTypesWithoutVolumes(t *testing.T) {
+	sde := writeSDE(t, invTypes)
+
+	types, err := sde.ListTypes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, types, 3)
+	for _, td := range types {
+		assert.Equal(t, td.Volume, td.PackagedVolume)
+	}
+}
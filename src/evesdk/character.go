@@ -0,0 +1,170 @@
+package evesdk
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/antihax/goesi/esi"
+	"github.com/antihax/goesi/optional"
+)
+
+// CharacterOrder is one of a character's open market orders. The JSON matches ESI's, so a saved
+// /characters/{id}/orders/ response reads straight into a []*CharacterOrder.
+type CharacterOrder struct {
+	OrderID       int64     `json:"order_id"`
+	TypeID        int32     `json:"type_id"`
+	RegionID      int32     `json:"region_id"`
+	LocationID    int64     `json:"location_id"`
+	VolumeTotal   int32     `json:"volume_total"`
+	VolumeRemain  int32     `json:"volume_remain"`
+	MinVolume     int32     `json:"min_volume,omitempty"`
+	Price         float64   `json:"price"`
+	IsBuyOrder    bool      `json:"is_buy_order,omitempty"`
+	Issued        time.Time `json:"issued"`
+	Duration      int32     `json:"duration"`
+	Range_        string    `json:"range"`
+	Escrow        float64   `json:"escrow,omitempty"`
+	IsCorporation bool      `json:"is_corporation"`
+}
+
+// ListCharacterOrders returns the character's open market orders. ctx must be authenticated, see evesso, as
+// that character with the esi-markets.read_character_orders.v1 scope.
+func (e *EveLand) ListCharacterOrders(ctx context.Context, characterID int32) ([]*CharacterOrder, error) {
+	if e == nil {
+		return nil, ErrNilEveLand
+	}
+	orders, _, err := e.Eve.ESI.MarketApi.GetCharactersCharacterIdOrders(ctx, characterID, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*CharacterOrder, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, &CharacterOrder{
+			OrderID:       o.OrderId,
+			TypeID:        o.TypeId,
+			RegionID:      o.RegionId,
+			LocationID:    o.LocationId,
+			VolumeTotal:   o.VolumeTotal,
+			VolumeRemain:  o.VolumeRemain,
+			MinVolume:     o.MinVolume,
+			Price:         o.Price,
+			IsBuyOrder:    o.IsBuyOrder,
+			Issued:        o.Issued,
+			Duration:      o.Duration,
+			Range_:        o.Range_,
+			Escrow:        o.Escrow,
+			IsCorporation: o.IsCorporation,
+		})
+	}
+	return out, nil
+}
+
+// WalletTransaction is one market transaction from a character's wallet. The JSON matches ESI's.
+type WalletTransaction struct {
+	TransactionID int64     `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+	TypeID        int32     `json:"type_id"`
+	LocationID    int64     `json:"location_id"`
+	Quantity      int32     `json:"quantity"`
+	UnitPrice     float64   `json:"unit_price"`
+	IsBuy         bool      `json:"is_buy,omitempty"`
+	IsPersonal    bool      `json:"is_personal,omitempty"`
+	ClientID      int32     `json:"client_id,omitempty"`
+	JournalRefID  int64     `json:"journal_ref_id,omitempty"`
+}
+
+// ListWalletTransactions returns the character's wallet transactions newer than afterID, newest first. ESI
+// hands them out in batches walking back from the newest, and only keeps the last 30 days, so import them
+// regularly and pass the newest ID already imported as afterID. ctx must be authenticated as that character
+// with the esi-wallet.read_character_wallet.v1 scope.
+func (e *EveLand) ListWalletTransactions(ctx context.Context, characterID int32, afterID int64) ([]*WalletTransaction, error) {
+	if e == nil {
+		return nil, ErrNilEveLand
+	}
+	out := []*WalletTransaction{}
+	opts := &esi.GetCharactersCharacterIdWalletTransactionsOpts{}
+	for {
+		txs, _, err := e.Eve.ESI.WalletApi.GetCharactersCharacterIdWalletTransactions(ctx, characterID, opts)
+		if err != nil {
+			return nil, err
+		}
+		oldest := int64(0)
+		for _, t := range txs {
+			if oldest == 0 || t.TransactionId < oldest {
+				oldest = t.TransactionId
+			}
+			if t.TransactionId <= afterID {
+				continue
+			}
+			out = append(out, &WalletTransaction{
+				TransactionID: t.TransactionId,
+				Date:          t.Date,
+				TypeID:        t.TypeId,
+				LocationID:    t.LocationId,
+				Quantity:      t.Quantity,
+				UnitPrice:     t.UnitPrice,
+				IsBuy:         t.IsBuy,
+				IsPersonal:    t.IsPersonal,
+				ClientID:      t.ClientId,
+				JournalRefID:  t.JournalRefId,
+			})
+		}
+		// from_id includes the transaction itself, so the next batch starts just below the oldest seen.
+		if len(txs) == 0 || oldest <= afterID+1 {
+			return out, nil
+		}
+		opts.FromId = optional.NewInt64(oldest - 1)
+	}
+}
+
+// Asset is one item stack a character owns. Items inside a container or a ship have the container's ItemID as
+// their LocationID. The JSON matches ESI's, so a saved /characters/{id}/assets/ response reads straight into a
+// []*Asset.
+type Asset struct {
+	ItemID          int64  `json:"item_id"`
+	TypeID          int32  `json:"type_id"`
+	LocationID      int64  `json:"location_id"`
+	LocationType    string `json:"location_type"`
+	LocationFlag    string `json:"location_flag"`
+	Quantity        int32  `json:"quantity"`
+	IsSingleton     bool   `json:"is_singleton"`
+	IsBlueprintCopy bool   `json:"is_blueprint_copy,omitempty"`
+}
+
+// ListCharacterAssets returns every page of the character's assets. ctx must be authenticated, see evesso, as
+// that character with the esi-assets.read_assets.v1 scope.
+// If some pages couldn't be fetched the assets from the other pages are returned with an *IncompleteError.
+func (e *EveLand) ListCharacterAssets(ctx context.Context, characterID int32) ([]*Asset, error) {
+	if e == nil {
+		return nil, ErrNilEveLand
+	}
+	fetch := func(ctx context.Context, page int32) ([]esi.GetCharactersCharacterIdAssets200Ok, *http.Response, error) {
+		return e.Eve.ESI.AssetsApi.GetCharactersCharacterIdAssets(
+			ctx,
+			characterID,
+			&esi.GetCharactersCharacterIdAssetsOpts{Page: optional.NewInt32(page)},
+		)
+	}
+
+	out := []*Asset{}
+	report, err := StreamAllPages(ctx, e.Pager, fetch, func(page int32, assets []esi.GetCharactersCharacterIdAssets200Ok, resp *http.Response) error {
+		for _, a := range assets {
+			out = append(out, &Asset{
+				ItemID:          a.ItemId,
+				TypeID:          a.TypeId,
+				LocationID:      a.LocationId,
+				LocationType:    a.LocationType,
+				LocationFlag:    a.LocationFlag,
+				Quantity:        a.Quantity,
+				IsSingleton:     a.IsSingleton,
+				IsBlueprintCopy: a.IsBlueprintCopy,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, report.Err()
+}
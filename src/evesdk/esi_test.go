@@ -0,0 +1,172 @@
+package evesdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/antihax/goesi"
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/epsniff/eveland/src/evesso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestListAllMarketOrdersForRegion(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 10
+
+	forge := &evesdk.Region{RegionID: 10000002, Name: "The Forge"}
+	esi.AddRegion(forge)
+	for i := 1; i <= 35; i++ {
+		location := int64(60003760)
+		if i == 35 {
+			location = 1028858195912
+		}
+		esi.AddOrders(forge.RegionID, &evesdk.MarketOrder{OrderID: int64(i), TypeID: 34, SystemID: 30000142, LocationID: location, Price: float64(i), Issued: time.Now().UTC()})
+	}
+	ordersPath := "/v1/markets/10000002/orders/"
+	esi.Fail(esitest.Failure{Path: ordersPath, Page: 2, Status: http.StatusBadGateway, Times: 2})
+
+	eve := esi.EveLand()
+	eve.Pager = evesdk.PagerOptions{Concurrency: 2, Retries: 3, Backoff: time.Millisecond}
+
+	orders, err := eve.ListAllMarketOrdersForRegion(context.Background(), forge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, o := range orders {
+		ids = append(ids, int(o.OrderID))
+		assert.Equal(t, o.OrderID == 35, o.IsStructureOrder, "only the order outside an NPC station is a structure order")
+	}
+	sort.Ints(ids)
+	assert.Equal(t, 35, len(ids))
+	assert.Equal(t, 1, ids[0])
+	assert.Equal(t, 35, ids[34])
+	// 4 pages plus 2 retries of page 2.
+	assert.Equal(t, 6, esi.Requests(ordersPath))
+
+	// A page that never comes back is reported rather than dropped.
+	esi.Fail(esitest.Failure{Path: ordersPath, Page: 3, Status: http.StatusNotFound})
+	orders, err = eve.ListAllMarketOrdersForRegion(context.Background(), forge)
+	var incomplete *evesdk.IncompleteError
+	if assert.True(t, errors.As(err, &incomplete)) {
+		assert.Equal(t, int32(3), incomplete.Failed[0].Page)
+	}
+	assert.Equal(t, 25, len(orders))
+}
+
+func TestListAllTypeIDs(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 2
+
+	for _, td := range []*evesdk.TypeData{{TypeId: 34, Name: "Tritanium"}, {TypeId: 35, Name: "Pyerite"}, {TypeId: 36, Name: "Mexallon"}} {
+		esi.AddType(td)
+	}
+
+	eve := esi.EveLand()
+	ids, err := eve.ListAllTypeIDs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	assert.Equal(t, []int32{34, 35, 36}, ids)
+
+	td, err := eve.GetTypeData(context.Background(), 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Pyerite", td.Name)
+}
+
+func TestListCharacterOrders(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	esi.UseSSO(sso)
+	esi.AddCharacterOrders(90000001, &evesdk.CharacterOrder{OrderID: 100, TypeID: 34, RegionID: 10000002, LocationID: 60003760, Price: 5.2, VolumeRemain: 10, VolumeTotal: 10})
+	esi.AddCharacterOrders(90000002, &evesdk.CharacterOrder{OrderID: 200, TypeID: 35, RegionID: 10000002, LocationID: 60003760, Price: 9, IsBuyOrder: true})
+
+	store, err := evesso.NewTokenStore(t.TempDir(), []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	defer store.Close()
+	s := evesso.New(sso.Config("esi-markets.read_character_orders.v1"), store)
+	sso.LoginAs(90000001, "Jita Trader")
+	_, err = s.Login(context.Background(), func(authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	require.NoError(t, err)
+
+	eve := esi.EveLand()
+	_, err = eve.ListCharacterOrders(context.Background(), 90000001)
+	assert.Error(t, err, "character orders need a token")
+
+	ctx, err := s.Context(context.Background(), 90000001)
+	require.NoError(t, err)
+	orders, err := eve.ListCharacterOrders(ctx, 90000001)
+	require.NoError(t, err)
+	if assert.Len(t, orders, 1) {
+		assert.Equal(t, int64(100), orders[0].OrderID)
+		assert.Equal(t, 5.2, orders[0].Price)
+	}
+	_, err = eve.ListCharacterOrders(ctx, 90000002)
+	assert.Error(t, err, "the token is only good for its own character")
+}
+
+func TestListWalletTransactions(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 2
+	day := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	for id := int64(1); id <= 5; id++ {
+		esi.AddWalletTransactions(90000001, &evesdk.WalletTransaction{TransactionID: id, Date: day, TypeID: 34, Quantity: 10, UnitPrice: 5, IsBuy: id%2 == 1})
+	}
+
+	// Without an SSO the fake takes any token.
+	ctx := context.WithValue(context.Background(), goesi.ContextOAuth2, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	eve := esi.EveLand()
+	txs, err := eve.ListWalletTransactions(ctx, 90000001, 0)
+	require.NoError(t, err)
+	require.Len(t, txs, 5, "walks back through every batch")
+	assert.Equal(t, int64(5), txs[0].TransactionID)
+	assert.True(t, txs[4].IsBuy)
+
+	txs, err = eve.ListWalletTransactions(ctx, 90000001, 3)
+	require.NoError(t, err)
+	require.Len(t, txs, 2, "only the transactions after the last imported one")
+	assert.Equal(t, int64(4), txs[1].TransactionID)
+}
+
+func TestListCharacterAssets(t *testing.T) {
+	esi := esitest.New()
+	defer esi.Close()
+	esi.PageSize = 2
+	for id := int64(1); id <= 5; id++ {
+		esi.AddAssets(90000001, &evesdk.Asset{ItemID: id, TypeID: 34, LocationID: 60003760, LocationType: "station", Quantity: 10})
+	}
+	assetsPath := "/v5/characters/90000001/assets/"
+	esi.Fail(esitest.Failure{Path: assetsPath, Page: 2, Status: http.StatusNotFound})
+
+	ctx := context.WithValue(context.Background(), goesi.ContextOAuth2, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	eve := esi.EveLand()
+	eve.Pager = evesdk.PagerOptions{Concurrency: 2, Retries: 1, Backoff: time.Millisecond}
+	assets, err := eve.ListCharacterAssets(ctx, 90000001)
+	var incomplete *evesdk.IncompleteError
+	if assert.True(t, errors.As(err, &incomplete), "a missing page is reported rather than dropped") {
+		assert.Equal(t, int32(2), incomplete.Failed[0].Page)
+	}
+	assert.Len(t, assets, 3)
+}
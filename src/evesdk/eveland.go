@@ -8,10 +8,22 @@ import (
 
 type EveLand struct {
 	Eve *goesi.APIClient
+	// Governor is the transport guarding ESI's error budget, it may be nil.
+	Governor *Governor
+	// Pager controls concurrency and retries for paged endpoints.
+	Pager PagerOptions
 }
 
-func New(eve *goesi.APIClient) *EveLand {
-	return &EveLand{Eve: eve}
+func New(eve *goesi.APIClient, governor *Governor) *EveLand {
+	return &EveLand{Eve: eve, Governor: governor, Pager: DefaultPagerOptions}
+}
+
+// ESIStats returns the error budget metrics for requests made so far.
+func (e *EveLand) ESIStats() GovernorStats {
+	if e == nil {
+		return GovernorStats{Remain: -1}
+	}
+	return e.Governor.Stats()
 }
 
 var ErrNilEveLand = fmt.Errorf("nil eveland")
@@ -0,0 +1,194 @@
+package evesdk
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ESI gives every client an error budget (100 errors per 60 second window at the time of writing). Each error
+// response carries X-ESI-Error-Limit-Remain and X-ESI-Error-Limit-Reset, and running the budget down to zero
+// gets the IP temporarily banned with 420 responses. The Governor watches those headers on every response
+// and holds back new requests from all pagers when the budget gets low.
+
+const (
+	errorLimitRemainHeader = "X-Esi-Error-Limit-Remain"
+	errorLimitResetHeader  = "X-Esi-Error-Limit-Reset"
+
+	// StatusErrorLimited is the status ESI answers with once the error budget is spent.
+	StatusErrorLimited = 420
+)
+
+// GovernorOptions tunes when the Governor starts throttling and pausing requests.
+type GovernorOptions struct {
+	// ThrottleBelow spreads requests out over the rest of the window once fewer errors than this remain.
+	ThrottleBelow int
+	// PauseBelow holds every request until the window resets once fewer errors than this remain.
+	PauseBelow int
+}
+
+// DefaultGovernorOptions leaves plenty of the budget for the requests already in flight when we start pausing.
+var DefaultGovernorOptions = GovernorOptions{ThrottleBelow: 50, PauseBelow: 10}
+
+// GovernorStats is a snapshot of the Governor's metrics.
+type GovernorStats struct {
+	Requests   int64         // requests sent to ESI
+	Errors     int64         // responses with a 4xx or 5xx status
+	Limited    int64         // 420 responses, each means the budget ran out
+	Throttled  int64         // requests delayed because the budget was low
+	Paused     int64         // requests held until the window reset
+	WaitedFor  time.Duration // total time requests spent waiting on the governor
+	Remain     int           // errors left in the current window, -1 until ESI has told us
+	ResetAt    time.Time     // when the current window resets
+	LastStatus int
+}
+
+func (s GovernorStats) String() string {
+	remain := "unknown"
+	if s.Remain >= 0 {
+		remain = strconv.Itoa(s.Remain)
+	}
+	return fmt.Sprintf("requests: %d, errors: %d, error limited: %d, throttled: %d, paused: %d, waited: %v, error budget remaining: %s",
+		s.Requests, s.Errors, s.Limited, s.Throttled, s.Paused, s.WaitedFor.Round(time.Millisecond), remain)
+}
+
+// Governor is an http.RoundTripper shared by every ESI request, it tracks the error budget and delays
+// requests when it runs low. Put it underneath the cache transport so cached responses never wait on it.
+type Governor struct {
+	next http.RoundTripper
+	opts GovernorOptions
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(req *http.Request, d time.Duration) error
+
+	mu       sync.Mutex
+	stats    GovernorStats
+	nextSend time.Time // earliest time the next throttled request may go out
+}
+
+// NewGovernor wraps next, http.DefaultTransport is used when next is nil.
+func NewGovernor(next http.RoundTripper, opts GovernorOptions) *Governor {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Governor{
+		next:  next,
+		opts:  opts,
+		now:   time.Now,
+		sleep: sleepContext,
+		stats: GovernorStats{Remain: -1},
+	}
+}
+
+// Stats returns a snapshot of the governor's metrics.
+func (g *Governor) Stats() GovernorStats {
+	if g == nil {
+		return GovernorStats{Remain: -1}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+// RoundTrip waits until the error budget allows another request, sends it and records the budget ESI reports back.
+func (g *Governor) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := g.wait(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := g.next.RoundTrip(req)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stats.Requests++
+	if err != nil {
+		return nil, err
+	}
+	g.observe(resp)
+	return resp, nil
+}
+
+// wait blocks until the request may be sent. Pauses and throttle slots are decided under the lock, so
+// concurrent pagers queue up behind each other instead of all waking at once.
+func (g *Governor) wait(req *http.Request) error {
+	g.mu.Lock()
+	now := g.now()
+	var delay time.Duration
+	switch {
+	case g.stats.Remain < 0 || !now.Before(g.stats.ResetAt):
+		// Budget unknown or the window has reset.
+	case g.stats.Remain < g.opts.PauseBelow:
+		delay = g.stats.ResetAt.Sub(now)
+		g.stats.Paused++
+	case g.stats.Remain < g.opts.ThrottleBelow:
+		// Spread what's left of the window over the remaining budget, so even if every request failed
+		// we'd reach the pause threshold no sooner than the reset.
+		spacing := g.stats.ResetAt.Sub(now) / time.Duration(g.stats.Remain-g.opts.PauseBelow+1)
+		if g.nextSend.Before(now) {
+			g.nextSend = now
+		}
+		delay = g.nextSend.Sub(now)
+		g.nextSend = g.nextSend.Add(spacing)
+		if delay > 0 {
+			g.stats.Throttled++
+		}
+	}
+	if delay > 0 {
+		g.stats.WaitedFor += delay
+	}
+	g.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	return g.sleep(req, delay)
+}
+
+// observe records the error budget from resp. Must be called with g.mu held.
+func (g *Governor) observe(resp *http.Response) {
+	g.stats.LastStatus = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		g.stats.Errors++
+	}
+	if resp.StatusCode == StatusErrorLimited {
+		g.stats.Limited++
+	}
+
+	remain, rerr := strconv.Atoi(resp.Header.Get(errorLimitRemainHeader))
+	reset, err := strconv.Atoi(resp.Header.Get(errorLimitResetHeader))
+	resetAt := g.now().Add(time.Duration(reset) * time.Second)
+
+	if resp.StatusCode == StatusErrorLimited {
+		if err != nil {
+			// Banned without telling us for how long, assume a full window.
+			resetAt = g.now().Add(time.Minute)
+		}
+		g.stats.Remain = 0
+		g.stats.ResetAt = resetAt
+		return
+	}
+	if rerr != nil || err != nil {
+		return
+	}
+
+	// Responses can arrive out of order, so within a window only ever lower the remaining budget.
+	if g.stats.Remain >= 0 && g.now().Before(g.stats.ResetAt) && remain > g.stats.Remain && resetAt.Sub(g.stats.ResetAt) < time.Second {
+		return
+	}
+	g.stats.Remain = remain
+	g.stats.ResetAt = resetAt
+}
+
+func sleepContext(req *http.Request, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,80 @@
+package evesdk
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestGovernor(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+
+	status, remain := http.StatusOK, 100
+	g := NewGovernor(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		h := http.Header{}
+		h.Set(errorLimitRemainHeader, strconv.Itoa(remain))
+		h.Set(errorLimitResetHeader, "30")
+		return &http.Response{StatusCode: status, Header: h, Body: http.NoBody}, nil
+	}), GovernorOptions{ThrottleBelow: 50, PauseBelow: 10})
+	g.now = func() time.Time { return now }
+	g.sleep = func(req *http.Request, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	do := func() {
+		req, _ := http.NewRequest(http.MethodGet, "https://esi.evetech.net/latest/markets/prices/", nil)
+		_, err := g.RoundTrip(req)
+		assert.NoError(t, err)
+	}
+
+	// A healthy budget never waits.
+	do()
+	do()
+	assert.Empty(t, slept)
+	assert.Equal(t, 100, g.Stats().Remain)
+
+	// Low budget spreads requests over the rest of the window.
+	status, remain = http.StatusBadGateway, 29
+	do()
+	do()
+	do()
+	assert.Equal(t, []time.Duration{30 * time.Second / 20}, slept)
+	assert.Equal(t, int64(1), g.Stats().Throttled)
+
+	// Out of order responses don't raise the budget within a window.
+	remain = 40
+	do()
+	assert.Equal(t, 29, g.Stats().Remain)
+
+	// A 420 pauses until the reset.
+	status = StatusErrorLimited
+	do()
+	assert.Equal(t, 0, g.Stats().Remain)
+	slept = nil
+	do()
+	assert.Equal(t, []time.Duration{30 * time.Second}, slept)
+
+	// Once the window resets requests flow again.
+	slept = nil
+	now = now.Add(time.Minute)
+	status, remain = http.StatusOK, 100
+	do()
+	do()
+	assert.Empty(t, slept)
+
+	stats := g.Stats()
+	assert.Equal(t, int64(10), stats.Requests)
+	assert.Equal(t, int64(6), stats.Errors)
+	assert.Equal(t, int64(2), stats.Limited)
+	assert.Equal(t, int64(3), stats.Throttled)
+	assert.Equal(t, int64(1), stats.Paused)
+}
@@ -0,0 +1,116 @@
+package evesdk
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/antihax/goesi/esi"
+	"github.com/antihax/goesi/optional"
+)
+
+// MarketGroup is a node of the market browser's tree. Only the leaves hold types, ParentGroupID is zero for
+// the top level groups.
+type MarketGroup struct {
+	MarketGroupID int32   `json:"market_group_id,omitempty"`
+	ParentGroupID int32   `json:"parent_group_id,omitempty"`
+	Name          string  `json:"name,omitempty"`
+	Description   string  `json:"description,omitempty"`
+	TypeIDs       []int32 `json:"types,omitempty"`
+}
+
+// Group is an item group, e.g. Hybrid Charge, its type's TypeData.GroupId.
+type Group struct {
+	GroupID    int32   `json:"group_id,omitempty"`
+	CategoryID int32   `json:"category_id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Published  bool    `json:"published,omitempty"`
+	TypeIDs    []int32 `json:"types,omitempty"`
+}
+
+// Category is a group's category, e.g. Charge.
+type Category struct {
+	CategoryID int32   `json:"category_id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Published  bool    `json:"published,omitempty"`
+	GroupIDs   []int32 `json:"groups,omitempty"`
+}
+
+// ListMarketGroupIDs returns the IDs of every market group.
+func (e *EveLand) ListMarketGroupIDs(ctx context.Context) ([]int32, error) {
+	ids, _, err := e.Eve.ESI.MarketApi.GetMarketsGroups(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetMarketGroup returns a market group.
+func (e *EveLand) GetMarketGroup(ctx context.Context, marketGroupID int32) (*MarketGroup, error) {
+	g, _, err := e.Eve.ESI.MarketApi.GetMarketsGroupsMarketGroupId(ctx, marketGroupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MarketGroup{
+		MarketGroupID: g.MarketGroupId,
+		ParentGroupID: g.ParentGroupId,
+		Name:          g.Name,
+		Description:   g.Description,
+		TypeIDs:       g.Types,
+	}, nil
+}
+
+// ListAllGroupIDs returns the IDs of every item group.
+// If some pages couldn't be fetched the groups from the other pages are returned with an *IncompleteError.
+func (e *EveLand) ListAllGroupIDs(ctx context.Context) ([]int32, error) {
+	groupIDs := []int32{}
+	report, err := StreamAllPages(ctx, e.Pager,
+		func(ctx context.Context, page int32) ([]int32, *http.Response, error) {
+			return e.Eve.ESI.UniverseApi.GetUniverseGroups(ctx, &esi.GetUniverseGroupsOpts{Page: optional.NewInt32(page)})
+		},
+		func(page int32, ids []int32, resp *http.Response) error {
+			groupIDs = append(groupIDs, ids...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return groupIDs, report.Err()
+}
+
+// GetGroup returns an item group.
+func (e *EveLand) GetGroup(ctx context.Context, groupID int32) (*Group, error) {
+	g, _, err := e.Eve.ESI.UniverseApi.GetUniverseGroupsGroupId(ctx, groupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{
+		GroupID:    g.GroupId,
+		CategoryID: g.CategoryId,
+		Name:       g.Name,
+		Published:  g.Published,
+		TypeIDs:    g.Types,
+	}, nil
+}
+
+// ListCategoryIDs returns the IDs of every item category.
+func (e *EveLand) ListCategoryIDs(ctx context.Context) ([]int32, error) {
+	ids, _, err := e.Eve.ESI.UniverseApi.GetUniverseCategories(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetCategory returns an item category.
+func (e *EveLand) GetCategory(ctx context.Context, categoryID int32) (*Category, error) {
+	c, _, err := e.Eve.ESI.UniverseApi.GetUniverseCategoriesCategoryId(ctx, categoryID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Category{
+		CategoryID: c.CategoryId,
+		Name:       c.Name,
+		Published:  c.Published,
+		GroupIDs:   c.Groups,
+	}, nil
+}
@@ -2,62 +2,36 @@ package evesdk
 
 import (
 	"context"
-	"sync"
+	"net/http"
 
 	"github.com/antihax/goesi/esi"
 	"github.com/antihax/goesi/optional"
 )
 
 // ListAllTypeIDs returns all types in the game, as an array of TypeIDs.
+// If some pages couldn't be fetched the types from the other pages are returned with an *IncompleteError.
 func (e *EveLand) ListAllTypeIDs(ctx context.Context) ([]int32, error) {
-	types, resp, err := e.Eve.ESI.UniverseApi.GetUniverseTypes(ctx, nil)
+	typeIDs := []int32{}
+	report, err := e.StreamTypeIDs(ctx, func(page []int32) error {
+		typeIDs = append(typeIDs, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return typeIDs, report.Err()
+}
 
-	// Extract the number of pages from the response header	and use it to get the other pages concurrently.
-	pages, err := getPages(resp)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a waitgroup to keep track of the goroutines
-	var wg sync.WaitGroup
-	wg.Add(int(pages))
-	// sem is a channel that will allow up to 4 concurrent operations.
-	var sem = make(chan int, 4)
-
-	// Create a mutex to protect the marketOrders slice
-	typeMu := &sync.RWMutex{}
-	typesAcc := []int32{}
-
-	addTypes := func(myTypes []int32) {
-		for _, t := range myTypes {
-			typeMu.Lock()
-			typesAcc = append(typesAcc, t)
-			typeMu.Unlock()
-		}
-	}
-	addTypes(types)
-
-	for i := int32(1); i <= pages; i++ {
-		sem <- 1
-		go func(page int32) {
-			defer func() {
-				wg.Done()
-				<-sem
-			}()
-			myTypes, _, err := e.Eve.ESI.UniverseApi.GetUniverseTypes(ctx, &esi.GetUniverseTypesOpts{Page: optional.NewInt32(page)})
-			if err != nil {
-				return
-			}
-			addTypes(myTypes)
-		}(i)
-	}
-
-	wg.Wait() // Wait for all goroutines to finish.
-
-	return typesAcc, nil
+// StreamTypeIDs hands each page of type IDs to fn as it arrives instead of collecting them all first.
+// Pages that couldn't be fetched are listed in the report.
+func (e *EveLand) StreamTypeIDs(ctx context.Context, fn func(typeIDs []int32) error) (*PageReport, error) {
+	return StreamAllPages(ctx, e.Pager,
+		func(ctx context.Context, page int32) ([]int32, *http.Response, error) {
+			return e.Eve.ESI.UniverseApi.GetUniverseTypes(ctx, &esi.GetUniverseTypesOpts{Page: optional.NewInt32(page)})
+		},
+		func(page int32, typeIDs []int32, resp *http.Response) error {
+			return fn(typeIDs)
+		})
 }
 
 type TypeData struct {
@@ -86,8 +60,32 @@ func (e *EveLand) GetTypeData(ctx context.Context, typeID int32) (*TypeData, err
 	if err != nil {
 		return nil, err
 	}
+	return typeDataFromESI(typeData), nil
+}
+
+// GetTypeDataIfChanged is GetTypeData sending etag, from an earlier response, as If-None-Match. td is nil when
+// ESI answers 304 Not Modified. newETag is the response's ETag, etag again for a 304.
+func (e *EveLand) GetTypeDataIfChanged(ctx context.Context, typeID int32, etag string) (td *TypeData, newETag string, err error) {
+	opts := &esi.GetUniverseTypesTypeIdOpts{}
+	if etag != "" {
+		opts.IfNoneMatch = optional.NewString(etag)
+	}
+	typeData, resp, err := e.Eve.ESI.UniverseApi.GetUniverseTypesTypeId(ctx, typeID, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	// goesi hands back an empty type and no error for a 304.
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp != nil {
+		newETag = resp.Header.Get("ETag")
+	}
+	return typeDataFromESI(typeData), newETag, nil
+}
 
-	t := &TypeData{
+func typeDataFromESI(typeData esi.GetUniverseTypesTypeIdOk) *TypeData {
+	return &TypeData{
 		Capacity:    typeData.Capacity,
 		Description: typeData.Description,
 		// DogmaAttributes: typeData.DogmaAttributes,
@@ -105,6 +103,4 @@ func (e *EveLand) GetTypeData(ctx context.Context, typeID int32) (*TypeData, err
 		TypeId:         typeData.TypeId,
 		Volume:         typeData.Volume,
 	}
-	// fmt.Println("TypeData:", t)
-	return t, nil
 }
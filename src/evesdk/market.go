@@ -3,7 +3,7 @@ package evesdk
 import (
 	"context"
 	"encoding/json"
-	"sync"
+	"net/http"
 	"time"
 
 	"github.com/antihax/goesi/esi"
@@ -26,10 +26,24 @@ type MarketOrder struct {
 	Issued       time.Time `json:"issued,omitempty"`
 	Duration     int32     `json:"duration,omitempty"`
 	Range_       string    `json:"range,omitempty"`
+	// IsStructureOrder is set for orders in a player structure's market, LocationID is the structure ID. They
+	// are only visible to characters with docking access.
+	IsStructureOrder bool `json:"is_structure_order,omitempty"`
 
 	ExpiresIn time.Duration `json:"expires_in,omitempty"`
 }
 
+// NPC stations have IDs in this range, the location ID of anything outside it is a player structure.
+const (
+	minNPCStationID = 60000000
+	maxNPCStationID = 64000000
+)
+
+// IsNPCStation reports whether locationID is an NPC station rather than a player structure.
+func IsNPCStation(locationID int64) bool {
+	return locationID >= minNPCStationID && locationID < maxNPCStationID
+}
+
 func (m *MarketOrder) String() string {
 	s, err := json.Marshal(m)
 	if err != nil {
@@ -39,34 +53,40 @@ func (m *MarketOrder) String() string {
 }
 
 // ListAllMarketOrdersForRegion returns all market orders for a region.
-// ToDo: Add regionID as parameter.
+// If some pages couldn't be fetched the orders from the other pages are returned with an *IncompleteError.
+// Large regions are better read with StreamMarketOrdersForRegion.
 func (e *EveLand) ListAllMarketOrdersForRegion(ctx context.Context, region *Region) ([]*MarketOrder, error) {
-
-	const allOrderType = "all" // ToDo: Add orderType as parameter.
-	orders, resp, err := e.Eve.ESI.MarketApi.GetMarketsRegionIdOrders(ctx, allOrderType, region.RegionID, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Extract the number of pages from the response header	and use it to get the other pages concurrently.
-	pages, err := getPages(resp)
+	marketOrders := []*MarketOrder{}
+	report, err := e.StreamMarketOrdersForRegion(ctx, region, func(orders []*MarketOrder) error {
+		marketOrders = append(marketOrders, orders...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return marketOrders, report.Err()
+}
 
-	// Create a waitgroup to keep track of the goroutines
-	var wg sync.WaitGroup
-	wg.Add(int(pages))
-	// sem is a channel that will allow up to 4 concurrent operations.
-	var sem = make(chan int, 4)
+// StreamMarketOrdersForRegion hands each page of a region's market orders to fn as it arrives, so only a few
+// pages are ever held in memory. Calls to fn are never concurrent. Pages that couldn't be fetched are listed
+// in the report, callers that can't use partial data should check report.Err().
+func (e *EveLand) StreamMarketOrdersForRegion(ctx context.Context, region *Region, fn func(orders []*MarketOrder) error) (*PageReport, error) {
 
-	// Create a mutex to protect the marketOrders slice
-	marketMu := &sync.RWMutex{}
-	marketOrders := []*MarketOrder{}
+	const allOrderType = "all" // ToDo: Add orderType as parameter.
+	fetch := func(ctx context.Context, page int32) ([]esi.GetMarketsRegionIdOrders200Ok, *http.Response, error) {
+		return e.Eve.ESI.MarketApi.GetMarketsRegionIdOrders(
+			ctx,
+			allOrderType,
+			region.RegionID,
+			&esi.GetMarketsRegionIdOrdersOpts{Page: optional.NewInt32(page)},
+		)
+	}
 
-	addOrders := func(orders []esi.GetMarketsRegionIdOrders200Ok) {
+	return StreamAllPages(ctx, e.Pager, fetch, func(page int32, orders []esi.GetMarketsRegionIdOrders200Ok, resp *http.Response) error {
+		expiresIn := timeUntilCacheExpires(resp)
+		marketOrders := make([]*MarketOrder, 0, len(orders))
 		for _, order := range orders {
-			m := &MarketOrder{
+			marketOrders = append(marketOrders, &MarketOrder{
 				OrderID:      order.OrderId,
 				TypeID:       order.TypeId,
 				LocationID:   order.LocationId,
@@ -79,36 +99,78 @@ func (e *EveLand) ListAllMarketOrdersForRegion(ctx context.Context, region *Regi
 				Issued:       order.Issued,
 				Duration:     order.Duration,
 				Range_:       order.Range_,
-				ExpiresIn:    timeUntilCacheExpires(resp),
-			}
-
-			marketMu.Lock()
-			marketOrders = append(marketOrders, m)
-			marketMu.Unlock()
+				// Region listings include public structure markets.
+				IsStructureOrder: !IsNPCStation(order.LocationId),
+				ExpiresIn:        expiresIn,
+			})
 		}
-	}
-	addOrders(orders)
-
-	// Get the other pages concurrently. We skip page 0 because we already have it.
-	for i := 1; int32(i) <= pages; i++ {
-		sem <- 1
-		go func(page int32) {
-			defer func() {
-				<-sem
-				wg.Done()
-			}()
+		return fn(marketOrders)
+	})
+}
 
-			orders, _, err = e.Eve.ESI.MarketApi.GetMarketsRegionIdOrders(
-				ctx,
-				allOrderType,
-				region.RegionID,
-				&esi.GetMarketsRegionIdOrdersOpts{Page: optional.NewInt32(page)},
-			)
-			addOrders(orders)
-		}(int32(i))
+// StreamMarketOrdersForStructure hands each page of a structure's market orders to fn, like
+// StreamMarketOrdersForRegion. ctx must be authenticated, see evesso, as a character with the
+// esi-markets.structure_markets.v1 scope and docking access. ESI leaves the system out of structure orders,
+// so it is taken from structure, see GetStructure.
+func (e *EveLand) StreamMarketOrdersForStructure(ctx context.Context, structure *Structure, fn func(orders []*MarketOrder) error) (*PageReport, error) {
+	fetch := func(ctx context.Context, page int32) ([]esi.GetMarketsStructuresStructureId200Ok, *http.Response, error) {
+		return e.Eve.ESI.MarketApi.GetMarketsStructuresStructureId(
+			ctx,
+			structure.StructureID,
+			&esi.GetMarketsStructuresStructureIdOpts{Page: optional.NewInt32(page)},
+		)
 	}
 
-	wg.Wait() // Wait for everything to finish
+	return StreamAllPages(ctx, e.Pager, fetch, func(page int32, orders []esi.GetMarketsStructuresStructureId200Ok, resp *http.Response) error {
+		expiresIn := timeUntilCacheExpires(resp)
+		marketOrders := make([]*MarketOrder, 0, len(orders))
+		for _, order := range orders {
+			marketOrders = append(marketOrders, &MarketOrder{
+				OrderID:          order.OrderId,
+				TypeID:           order.TypeId,
+				LocationID:       order.LocationId,
+				SystemID:         structure.SolarSystemID,
+				VolumeTotal:      order.VolumeTotal,
+				VolumeRemain:     order.VolumeRemain,
+				MinVolume:        order.MinVolume,
+				Price:            order.Price,
+				IsBuyOrder:       order.IsBuyOrder,
+				Issued:           order.Issued,
+				Duration:         order.Duration,
+				Range_:           order.Range_,
+				IsStructureOrder: true,
+				ExpiresIn:        expiresIn,
+			})
+		}
+		return fn(marketOrders)
+	})
+}
+
+// MarketPrice is CCP's price for a type. AveragePrice is a rolling average of trades across New Eden,
+// AdjustedPrice is what industry job costs and reprocessing are based on. Either can be zero for types that
+// aren't traded.
+type MarketPrice struct {
+	TypeID        int32   `json:"type_id,omitempty"`
+	AveragePrice  float64 `json:"average_price,omitempty"`
+	AdjustedPrice float64 `json:"adjusted_price,omitempty"`
+}
 
-	return marketOrders, nil
+// ListMarketPrices returns the market price of every type, from one unpaged request.
+func (e *EveLand) ListMarketPrices(ctx context.Context) ([]*MarketPrice, error) {
+	if e == nil {
+		return nil, ErrNilEveLand
+	}
+	prices, _, err := e.Eve.ESI.MarketApi.GetMarketsPrices(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*MarketPrice, 0, len(prices))
+	for _, p := range prices {
+		out = append(out, &MarketPrice{
+			TypeID:        p.TypeId,
+			AveragePrice:  p.AveragePrice,
+			AdjustedPrice: p.AdjustedPrice,
+		})
+	}
+	return out, nil
 }
@@ -0,0 +1,218 @@
+package evesdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageFunc fetches one page of a paged ESI endpoint. Pages are numbered from 1.
+type PageFunc[T any] func(ctx context.Context, page int32) ([]T, *http.Response, error)
+
+// PagerOptions controls how FetchAllPages and StreamAllPages fetch and retry pages.
+type PagerOptions struct {
+	Concurrency int           // pages fetched at once
+	Retries     int           // extra attempts per page after the first one fails
+	Backoff     time.Duration // wait before the first retry, doubled on each one after
+	MaxBackoff  time.Duration
+}
+
+// DefaultPagerOptions are used by the evesdk list calls.
+var DefaultPagerOptions = PagerOptions{Concurrency: 4, Retries: 3, Backoff: time.Second, MaxBackoff: 30 * time.Second}
+
+// PageError is a page that still failed after all its retries.
+type PageError struct {
+	Page     int32
+	Attempts int
+	Err      error
+}
+
+// IncompleteError reports the pages that couldn't be fetched. The items from the other pages are still returned
+// alongside it, so callers decide for themselves whether partial data is acceptable.
+type IncompleteError struct {
+	Pages  int32
+	Failed []PageError
+}
+
+func (e *IncompleteError) Error() string {
+	pages := make([]string, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		pages = append(pages, fmt.Sprint(f.Page))
+	}
+	return fmt.Sprintf("failed to fetch %d of %d pages (%s): %v", len(e.Failed), e.Pages, strings.Join(pages, ", "), e.Failed[0].Err)
+}
+
+// PageReport describes a paged fetch, it's returned on its own by StreamAllPages.
+type PageReport struct {
+	Pages int32
+	// FailedPages is sorted by page number and empty when every page was fetched.
+	FailedPages []PageError
+	// First is the response for page 1, it carries the cache headers for the whole set.
+	First *http.Response
+	// Stale is set when any page was served from an expired cache entry, Age is the oldest page's age.
+	Stale bool
+	Age   time.Duration
+}
+
+func (r *PageReport) observe(resp *http.Response) {
+	age, stale := ResponseAge(resp)
+	r.Stale = r.Stale || stale
+	if age > r.Age {
+		r.Age = age
+	}
+}
+
+// Err returns an *IncompleteError if any page failed, nil otherwise.
+func (r *PageReport) Err() error {
+	if len(r.FailedPages) == 0 {
+		return nil
+	}
+	return &IncompleteError{Pages: r.Pages, Failed: r.FailedPages}
+}
+
+// PageResult is everything fetched from a paged endpoint.
+type PageResult[T any] struct {
+	Items []T
+	PageReport
+}
+
+// PageHandler receives each page's items as they arrive. Calls are never concurrent, but pages arrive in
+// whatever order they finish in.
+type PageHandler[T any] func(page int32, items []T, resp *http.Response) error
+
+// FetchAllPages fetches every page into memory. See StreamAllPages for how pages are fetched and retried.
+func FetchAllPages[T any](ctx context.Context, opts PagerOptions, fetch PageFunc[T]) (*PageResult[T], error) {
+	res := &PageResult[T]{}
+	report, err := StreamAllPages(ctx, opts, fetch, func(page int32, items []T, resp *http.Response) error {
+		res.Items = append(res.Items, items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.PageReport = *report
+	return res, nil
+}
+
+// StreamAllPages fetches page 1, reads the page count from its X-Pages header and then fetches the remaining
+// pages concurrently, retrying each with backoff and handing each page to fn as soon as it arrives, so at most
+// opts.Concurrency pages are held in memory at once.
+//
+// It returns an error if page 1 can't be fetched or fn fails, in which case the remaining pages are abandoned.
+// Failures on later pages are reported in the report's FailedPages.
+func StreamAllPages[T any](ctx context.Context, opts PagerOptions, fetch PageFunc[T], fn PageHandler[T]) (*PageReport, error) {
+	first, resp, attempts, err := fetchPage(ctx, opts, fetch, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching page 1 after %d attempts: %v", attempts, err)
+	}
+
+	pages := int32(1)
+	if resp != nil {
+		// A missing X-Pages header means there is only one page.
+		if p, err := getPages(resp); err == nil && p > 1 {
+			pages = p
+		}
+	}
+
+	report := &PageReport{Pages: pages, First: resp}
+	report.observe(resp)
+	if err := fn(1, first, resp); err != nil {
+		return nil, err
+	}
+	if pages == 1 {
+		return report, nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// A failing handler cancels the pages still in flight.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var handlerErr error
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for page := int32(2); page <= pages; page++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			report.FailedPages = append(report.FailedPages, PageError{Page: page, Err: ctx.Err()})
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(page int32) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			items, resp, attempts, err := fetchPage(ctx, opts, fetch, page)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if handlerErr != nil {
+				return
+			}
+			if err != nil {
+				report.FailedPages = append(report.FailedPages, PageError{Page: page, Attempts: attempts, Err: err})
+				return
+			}
+			report.observe(resp)
+			if err := fn(page, items, resp); err != nil {
+				handlerErr = err
+				cancel()
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	if handlerErr != nil {
+		return nil, handlerErr
+	}
+	sort.Slice(report.FailedPages, func(i, j int) bool { return report.FailedPages[i].Page < report.FailedPages[j].Page })
+	return report, nil
+}
+
+// fetchPage fetches one page, retrying failures that might succeed on another attempt.
+func fetchPage[T any](ctx context.Context, opts PagerOptions, fetch PageFunc[T], page int32) ([]T, *http.Response, int, error) {
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		items, resp, err := fetch(ctx, page)
+		if err == nil {
+			return items, resp, attempt, nil
+		}
+		if attempt > opts.Retries || !retryable(resp) || ctx.Err() != nil {
+			return nil, resp, attempt, err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, resp, attempt, ctx.Err()
+		}
+		backoff *= 2
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// retryable reports whether a failed request is worth trying again. Network errors, server errors and
+// error-limit responses are; any other client error will fail the same way again.
+func retryable(resp *http.Response) bool {
+	if resp == nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == StatusErrorLimited || resp.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,75 @@
+package evesdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchAllPages(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[int32]int{}
+
+	fetch := func(ctx context.Context, page int32) ([]int32, *http.Response, error) {
+		mu.Lock()
+		calls[page]++
+		n := calls[page]
+		mu.Unlock()
+
+		h := http.Header{}
+		h.Set("X-Pages", "5")
+		switch {
+		case page == 3 && n < 3:
+			return nil, &http.Response{StatusCode: http.StatusBadGateway, Header: h}, fmt.Errorf("502 Bad Gateway")
+		case page == 4:
+			return nil, &http.Response{StatusCode: http.StatusNotFound, Header: h}, fmt.Errorf("404 Not Found")
+		}
+		return []int32{page * 10, page*10 + 1}, &http.Response{StatusCode: http.StatusOK, Header: h}, nil
+	}
+
+	opts := PagerOptions{Concurrency: 2, Retries: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	res, err := FetchAllPages(context.Background(), opts, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(res.Items, func(i, j int) bool { return res.Items[i] < res.Items[j] })
+	assert.Equal(t, []int32{10, 11, 20, 21, 30, 31, 50, 51}, res.Items)
+	assert.Equal(t, int32(5), res.Pages)
+	assert.Equal(t, 1, calls[1], "page 1 is only fetched once")
+	assert.Equal(t, 3, calls[3], "server errors are retried")
+	assert.Equal(t, 1, calls[4], "client errors are not retried")
+
+	var incomplete *IncompleteError
+	if assert.True(t, errors.As(res.Err(), &incomplete)) {
+		assert.Equal(t, 1, len(incomplete.Failed))
+		assert.Equal(t, int32(4), incomplete.Failed[0].Page)
+	}
+}
+
+func TestStreamAllPagesHandlerError(t *testing.T) {
+	fetch := func(ctx context.Context, page int32) ([]int32, *http.Response, error) {
+		h := http.Header{}
+		h.Set("X-Pages", "20")
+		return []int32{page}, &http.Response{StatusCode: http.StatusOK, Header: h}, nil
+	}
+
+	seen := 0
+	stop := errors.New("stop")
+	_, err := StreamAllPages(context.Background(), DefaultPagerOptions, fetch, func(page int32, items []int32, resp *http.Response) error {
+		seen++
+		if seen == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 3, seen, "no pages are handed over after the handler fails")
+}
@@ -34,3 +34,31 @@ func (e *EveLand) ListAllRegions(ctx context.Context) (*Regions, error) {
 
 	return regions, nil
 }
+
+// Structure is a player owned structure, a citadel or engineering complex, as far as its market goes.
+type Structure struct {
+	StructureID   int64  `json:"structure_id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	SolarSystemID int32  `json:"solar_system_id,omitempty"`
+	OwnerID       int32  `json:"owner_id,omitempty"`
+	TypeID        int32  `json:"type_id,omitempty"`
+}
+
+// GetStructure looks up a structure. ctx must be authenticated, see evesso, as a character with the
+// esi-universe.read_structures.v1 scope and docking access to the structure.
+func (e *EveLand) GetStructure(ctx context.Context, structureID int64) (*Structure, error) {
+	if e == nil {
+		return nil, ErrNilEveLand
+	}
+	info, _, err := e.Eve.ESI.UniverseApi.GetUniverseStructuresStructureId(ctx, structureID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Structure{
+		StructureID:   structureID,
+		Name:          info.Name,
+		SolarSystemID: info.SolarSystemId,
+		OwnerID:       info.OwnerId,
+		TypeID:        info.TypeId,
+	}, nil
+}
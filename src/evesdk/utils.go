@@ -28,3 +28,16 @@ func timeUntilCacheExpires(r *http.Response) time.Duration {
 	}
 	return duration
 }
+
+// staleHeader marks responses evecache served after they expired, see evecache.StaleHeader.
+const staleHeader = "X-Eveland-Stale"
+
+// ResponseAge returns how old a cached response is and whether it had expired when it was served.
+// Responses straight from ESI are zero and not stale.
+func ResponseAge(r *http.Response) (time.Duration, bool) {
+	if r == nil {
+		return 0, false
+	}
+	age, _ := strconv.Atoi(r.Header.Get("Age"))
+	return time.Duration(age) * time.Second, r.Header.Get(staleHeader) != ""
+}
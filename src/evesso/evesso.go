@@ -0,0 +1,301 @@
+// Package evesso logs characters in through EVE SSO and hands out authenticated contexts for goesi.
+//
+// eveland is a native application, so it uses the authorization code flow with PKCE and no client secret.
+// Login opens the SSO authorize page, waits for the browser to come back to a listener on the callback URL,
+// then exchanges the code. Refresh tokens are kept per character in an encrypted TokenStore, and refreshed
+// tokens are written back to it, since EVE SSO rotates refresh tokens on use.
+package evesso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antihax/goesi"
+	"golang.org/x/oauth2"
+)
+
+// Config is the SSO application and endpoints to log in with.
+type Config struct {
+	// ClientID of the application registered at developers.eveonline.com.
+	ClientID string
+	// CallbackURL must match the application's registered callback exactly. Login listens on its host, port 0
+	// picks a free port and is only useful against a fake SSO.
+	CallbackURL string
+	Scopes      []string
+
+	AuthURL   string
+	TokenURL  string
+	RevokeURL string
+
+	// HTTPClient talks to the token and revoke endpoints, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// DefaultConfig is EVE SSO v2. Fill in ClientID and Scopes.
+var DefaultConfig = Config{
+	CallbackURL: "http://localhost:8089/callback",
+	AuthURL:     "https://login.eveonline.com/v2/oauth/authorize",
+	TokenURL:    "https://login.eveonline.com/v2/oauth/token",
+	RevokeURL:   "https://login.eveonline.com/v2/oauth/revoke",
+}
+
+// SSO logs characters in and keeps their tokens in a TokenStore.
+type SSO struct {
+	cfg   Config
+	store *TokenStore
+}
+
+// New returns an SSO for cfg that keeps tokens in store.
+func New(cfg Config, store *TokenStore) *SSO {
+	return &SSO{cfg: cfg, store: store}
+}
+
+func (s *SSO) oauthConfig(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:    s.cfg.ClientID,
+		RedirectURL: redirectURL,
+		Scopes:      s.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   s.cfg.AuthURL,
+			TokenURL:  s.cfg.TokenURL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// httpContext makes oauth2 use the configured http client.
+func (s *SSO) httpContext(ctx context.Context) context.Context {
+	if s.cfg.HTTPClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, s.cfg.HTTPClient)
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Login runs the SSO flow for one character. It calls open with the authorize URL, which should send the
+// user's browser there, and waits for the SSO to redirect back to the callback or for ctx to be done. The
+// character's tokens are saved to the store.
+func (s *SSO) Login(ctx context.Context, open func(authURL string) error) (*Character, error) {
+	if s.cfg.ClientID == "" {
+		return nil, fmt.Errorf("no sso client id configured")
+	}
+	callback, err := url.Parse(s.cfg.CallbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing callback url: %v", err)
+	}
+	ln, err := net.Listen("tcp", callback.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for the sso callback on %s: %v", callback.Host, err)
+	}
+	defer ln.Close()
+	if callback.Port() == "0" {
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		callback.Host = net.JoinHostPort(callback.Hostname(), port)
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newVerifier()
+	if err != nil {
+		return nil, err
+	}
+	oc := s.oauthConfig(callback.String())
+	authURL := oc.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+
+	results := make(chan callbackResult, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != callback.Path {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		var res callbackResult
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("sso refused the login: %s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("state") != state:
+			res.err = fmt.Errorf("sso callback state doesn't match this login")
+		case q.Get("code") == "":
+			res.err = fmt.Errorf("sso callback is missing the code")
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Logged in to eveland, you can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if err := open(authURL); err != nil {
+		return nil, fmt.Errorf("error opening the sso login page: %v", err)
+	}
+
+	var res callbackResult
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("error waiting for the sso callback: %v", ctx.Err())
+	case res = <-results:
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	tok, err := oc.Exchange(s.httpContext(ctx), res.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging the sso code: %v", err)
+	}
+	char, err := characterFromToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Save(char); err != nil {
+		return nil, err
+	}
+	return char, nil
+}
+
+// Characters returns the logged in characters.
+func (s *SSO) Characters() ([]*Character, error) {
+	return s.store.List()
+}
+
+// Logout revokes a character's refresh token and removes it from the store. The character is removed even
+// if the SSO can't be reached, the error says so.
+func (s *SSO) Logout(ctx context.Context, characterID int32) error {
+	char, err := s.store.Get(characterID)
+	if err != nil {
+		return err
+	}
+	revokeErr := s.revoke(ctx, char.Token.RefreshToken)
+	if err := s.store.Delete(characterID); err != nil {
+		return err
+	}
+	if revokeErr != nil {
+		return fmt.Errorf("removed %s but couldn't revoke its token: %v", char.Name, revokeErr)
+	}
+	return nil
+}
+
+func (s *SSO) revoke(ctx context.Context, refreshToken string) error {
+	if s.cfg.RevokeURL == "" || refreshToken == "" {
+		return nil
+	}
+	form := url.Values{
+		"token_type_hint": {"refresh_token"},
+		"token":           {refreshToken},
+		"client_id":       {s.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.RevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := s.cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoke returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ErrNotLoggedIn is returned for characters that aren't in the store.
+var ErrNotLoggedIn = errors.New("character isn't logged in")
+
+// TokenSource returns the character's tokens, refreshing the access token when it expires and saving the
+// rotated refresh token.
+func (s *SSO) TokenSource(ctx context.Context, characterID int32) (oauth2.TokenSource, error) {
+	char, err := s.store.Get(characterID)
+	if err != nil {
+		return nil, err
+	}
+	return &storeTokenSource{
+		store: s.store,
+		char:  char,
+		src:   s.oauthConfig(s.cfg.CallbackURL).TokenSource(s.httpContext(ctx), char.Token),
+	}, nil
+}
+
+// Context returns ctx carrying the character's token source, as goesi expects for authenticated endpoints.
+func (s *SSO) Context(ctx context.Context, characterID int32) (context.Context, error) {
+	ts, err := s.TokenSource(ctx, characterID)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, goesi.ContextOAuth2, ts), nil
+}
+
+// storeTokenSource writes refreshed tokens back to the store, the old refresh token stops working once used.
+type storeTokenSource struct {
+	mu    sync.Mutex
+	store *TokenStore
+	char  *Character
+	src   oauth2.TokenSource
+}
+
+func (ts *storeTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tok, err := ts.src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing the token for %s, try logging in again: %v", ts.char.Name, err)
+	}
+	if tok.AccessToken == ts.char.Token.AccessToken {
+		return tok, nil
+	}
+	char := *ts.char
+	char.Token = tok
+	if err := ts.store.Save(&char); err != nil {
+		// The access token is good, failing the request wouldn't help. The next login fixes the store.
+		fmt.Printf("evesso: error saving the refreshed token for %s: %v\n", char.Name, err)
+	}
+	ts.char = &char
+	return tok, nil
+}
+
+// Character is a logged in character and its tokens.
+type Character struct {
+	ID      int32         `json:"id"`
+	Name    string        `json:"name"`
+	Scopes  []string      `json:"scopes"`
+	Token   *oauth2.Token `json:"token"`
+	Updated time.Time     `json:"updated"`
+}
+
+// HasScope reports whether the character granted scope.
+func (c *Character) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
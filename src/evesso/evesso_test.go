@@ -0,0 +1,180 @@
+package evesso_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/antihax/goesi"
+	"github.com/epsniff/eveland/src/esitest"
+	"github.com/epsniff/eveland/src/evesso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// browse follows the authorize URL like a browser would, through the fake SSO and back to the callback.
+func browse(authURL string) error {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func login(t *testing.T, sso *esitest.SSO, dir string, id int32, name string, scopes ...string) (*evesso.SSO, *evesso.TokenStore, *evesso.Character) {
+	store, err := evesso.NewTokenStore(dir, testKey)
+	require.NoError(t, err)
+	s := evesso.New(sso.Config(scopes...), store)
+
+	sso.LoginAs(id, name)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	char, err := s.Login(ctx, browse)
+	require.NoError(t, err)
+	return s, store, char
+}
+
+func TestLogin(t *testing.T) {
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	dir := t.TempDir()
+
+	s, store, char := login(t, sso, dir, 90000001, "Jita Trader", "esi-markets.read_character_orders.v1")
+	assert.Equal(t, int32(90000001), char.ID)
+	assert.Equal(t, "Jita Trader", char.Name)
+	assert.Equal(t, []string{"esi-markets.read_character_orders.v1"}, char.Scopes)
+	assert.True(t, char.HasScope("esi-markets.read_character_orders.v1"))
+
+	sso.LoginAs(90000002, "Amarr Hauler")
+	_, err := s.Login(context.Background(), browse)
+	require.NoError(t, err)
+
+	chars, err := s.Characters()
+	require.NoError(t, err)
+	require.Len(t, chars, 2)
+	assert.Equal(t, "Amarr Hauler", chars[0].Name)
+	assert.Equal(t, "Jita Trader", chars[1].Name)
+
+	// The tokens survive a restart, and need the same key to read.
+	require.NoError(t, store.Close())
+	store, err = evesso.NewTokenStore(dir, testKey)
+	require.NoError(t, err)
+	got, err := store.Get(90000001)
+	require.NoError(t, err)
+	assert.Equal(t, char.Token.RefreshToken, got.Token.RefreshToken)
+	require.NoError(t, store.Close())
+
+	other, err := evesso.NewTokenStore(dir, []byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Get(90000001)
+	assert.Error(t, err)
+}
+
+func TestLoginRefusesWrongState(t *testing.T) {
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	store, err := evesso.NewTokenStore(t.TempDir(), testKey)
+	require.NoError(t, err)
+	defer store.Close()
+	s := evesso.New(sso.Config(), store)
+	sso.LoginAs(90000001, "Jita Trader")
+
+	_, err = s.Login(context.Background(), func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		q.Set("state", "forged")
+		u.RawQuery = q.Encode()
+		return browse(u.String())
+	})
+	assert.Error(t, err)
+	chars, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, chars)
+}
+
+func TestTokenSourceRefreshes(t *testing.T) {
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	s, store, char := login(t, sso, t.TempDir(), 90000001, "Jita Trader")
+	defer store.Close()
+
+	// Expire the access token so the next use refreshes it.
+	char.Token.Expiry = time.Now().Add(-time.Minute)
+	require.NoError(t, store.Save(char))
+
+	ctx, err := s.Context(context.Background(), 90000001)
+	require.NoError(t, err)
+	ts, ok := ctx.Value(goesi.ContextOAuth2).(oauth2.TokenSource)
+	require.True(t, ok, "goesi reads an oauth2.TokenSource from the context")
+	tok, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, sso.Refreshes())
+	id, ok := sso.Character(tok.AccessToken)
+	assert.True(t, ok)
+	assert.Equal(t, int32(90000001), id)
+
+	// The SSO rotated the refresh token, the store must have the new one or the next run can't log in.
+	stored, err := store.Get(90000001)
+	require.NoError(t, err)
+	assert.NotEqual(t, char.Token.RefreshToken, stored.Token.RefreshToken)
+	assert.Equal(t, tok.RefreshToken, stored.Token.RefreshToken)
+
+	// Until it expires the token is reused.
+	_, err = ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, sso.Refreshes())
+}
+
+func TestLogout(t *testing.T) {
+	sso := esitest.NewSSO()
+	defer sso.Close()
+	s, store, _ := login(t, sso, t.TempDir(), 90000001, "Jita Trader")
+	defer store.Close()
+	assert.Equal(t, 1, sso.RefreshTokens())
+
+	require.NoError(t, s.Logout(context.Background(), 90000001))
+	assert.Equal(t, 0, sso.RefreshTokens())
+	_, err := s.Context(context.Background(), 90000001)
+	assert.True(t, errors.Is(err, evesso.ErrNotLoggedIn))
+}
+
+func TestKeyKeptOutOfDataDir(t *testing.T) {
+	t.Setenv(evesso.KeyEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	sso := esitest.NewSSO()
+	defer sso.Close()
+
+	// A store from before the key moved, with its key next to it.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "evesso.key"), testKey, 0600))
+	_, store, _ := login(t, sso, dir, 90000001, "Jita Trader")
+	require.NoError(t, store.Close())
+
+	store, err := evesso.OpenTokenStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	char, err := store.Get(90000001)
+	require.NoError(t, err, "the old key still opens the store")
+	assert.Equal(t, "Jita Trader", char.Name)
+
+	_, err = os.Stat(filepath.Join(dir, "evesso.key"))
+	assert.True(t, os.IsNotExist(err), "the key was moved out of the data directory")
+	path, err := evesso.KeyPath(dir)
+	require.NoError(t, err)
+	key, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, testKey, key)
+}
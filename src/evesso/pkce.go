@@ -0,0 +1,73 @@
+package evesso
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newVerifier returns a PKCE code verifier, RFC 7636 asks for 43 to 128 characters.
+func newVerifier() (string, error) {
+	return randomString(32)
+}
+
+// challenge is the S256 code challenge for verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ssoClaims are the parts of an EVE SSO access token we use. scp is a string for one scope and a list for more.
+type ssoClaims struct {
+	Subject string          `json:"sub"`
+	Name    string          `json:"name"`
+	Scopes  json.RawMessage `json:"scp"`
+}
+
+// characterFromToken reads the character out of an SSO access token. The token came straight from the SSO's
+// token endpoint over TLS, so its signature isn't checked, it is only ever sent back to ESI which does.
+func characterFromToken(tok *oauth2.Token) (*Character, error) {
+	parts := strings.Split(tok.AccessToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("sso access token isn't a jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding sso access token: %v", err)
+	}
+	var claims ssoClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error unmarshalling sso access token claims: %v", err)
+	}
+
+	// sub is CHARACTER:EVE:<character id>.
+	id, err := strconv.ParseInt(strings.TrimPrefix(claims.Subject, "CHARACTER:EVE:"), 10, 32)
+	if err != nil || !strings.HasPrefix(claims.Subject, "CHARACTER:EVE:") {
+		return nil, fmt.Errorf("sso access token subject %q isn't a character", claims.Subject)
+	}
+	char := &Character{ID: int32(id), Name: claims.Name, Token: tok}
+	if len(claims.Scopes) > 0 {
+		var one string
+		if err := json.Unmarshal(claims.Scopes, &one); err == nil {
+			char.Scopes = []string{one}
+		} else if err := json.Unmarshal(claims.Scopes, &char.Scopes); err != nil {
+			return nil, fmt.Errorf("error unmarshalling sso access token scopes: %v", err)
+		}
+	}
+	return char, nil
+}
@@ -0,0 +1,238 @@
+package evesso
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// KeyEnv holds a base64 encoded 32 byte key for the token store, e.g. from `openssl rand -base64 32`. Without
+// it the key is kept in a 0600 file under the user's config directory, see KeyPath, so copying the data
+// directory doesn't copy the key with it. Anyone who can read the user's files can still read both.
+const KeyEnv = "EVELAND_SSO_KEY"
+
+// keyFile is where the key used to be kept, next to the store. It is moved to KeyPath on first use.
+const keyFile = "evesso.key"
+
+// KeyPath is the key file for the token store under dbpath, e.g. ~/.config/eveland/evesso-<hash>.key. Each
+// data directory gets its own key.
+func KeyPath(dbpath string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding config directory: %v", err)
+	}
+	abs, err := filepath.Abs(dbpath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %v", dbpath, err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(configDir, "eveland", fmt.Sprintf("evesso-%x.key", sum[:8])), nil
+}
+
+// TokenStore keeps characters and their tokens in pebble, each value sealed with AES-256-GCM.
+type TokenStore struct {
+	mu   sync.Mutex
+	pdb  *pebble.DB
+	aead cipher.AEAD
+	now  func() time.Time
+}
+
+// OpenTokenStore opens the token store under dbpath with the key from KeyEnv or the key file at KeyPath,
+// creating the key file on first use.
+func OpenTokenStore(dbpath string) (*TokenStore, error) {
+	key, err := loadKey(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenStore(dbpath, key)
+}
+
+// NewTokenStore opens the token store under dbpath with a 32 byte key.
+func NewTokenStore(dbpath string, key []byte) (*TokenStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("token store key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gcm: %v", err)
+	}
+
+	pebDbPath, err := db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error prepping db location: %v", err)
+	}
+	pdb, err := pebble.Open(pebDbPath, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening: %v", err)
+	}
+	return &TokenStore{pdb: pdb, aead: aead, now: time.Now}, nil
+}
+
+func (s *TokenStore) Close() error {
+	err := s.pdb.Close()
+	if err != nil {
+		return fmt.Errorf("error closing: %v", err)
+	}
+	return nil
+}
+
+// Save stores a character, replacing its earlier tokens.
+func (s *TokenStore) Save(char *Character) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	char.Updated = s.now()
+	plain, err := json.Marshal(char)
+	if err != nil {
+		return fmt.Errorf("error marshalling character: %v", err)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("error generating nonce: %v", err)
+	}
+	key := characterKey(char.ID)
+	// The key is the additional data, so a value can't be moved to another character.
+	sealed := s.aead.Seal(nonce, nonce, plain, key)
+	if err := s.pdb.Set(key, sealed, pebble.Sync); err != nil {
+		return fmt.Errorf("error writing to db: %v", err)
+	}
+	return nil
+}
+
+// Get returns a character, ErrNotLoggedIn if it isn't stored.
+func (s *TokenStore) Get(characterID int32) (*Character, error) {
+	key := characterKey(characterID)
+	value, closer, err := s.pdb.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, fmt.Errorf("character %d: %w", characterID, ErrNotLoggedIn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading from db: %v", err)
+	}
+	defer closer.Close()
+	return s.open(key, value)
+}
+
+// List returns every stored character, by name.
+func (s *TokenStore) List() ([]*Character, error) {
+	var chars []*Character
+	iter := s.pdb.NewIter(&pebble.IterOptions{})
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		char, err := s.open(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		chars = append(chars, char)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("error iterating over characters: %v", err)
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i].Name < chars[j].Name })
+	return chars, nil
+}
+
+// Delete removes a character.
+func (s *TokenStore) Delete(characterID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.pdb.Delete(characterKey(characterID), pebble.Sync); err != nil {
+		return fmt.Errorf("error deleting from db: %v", err)
+	}
+	return nil
+}
+
+func (s *TokenStore) open(key, sealed []byte) (*Character, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("token for %s is truncated", key)
+	}
+	plain, err := s.aead.Open(nil, sealed[:n], sealed[n:], key)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting token for %s, has the key changed? %v", key, err)
+	}
+	var char Character
+	if err := json.Unmarshal(plain, &char); err != nil {
+		return nil, fmt.Errorf("error unmarshalling character: %v", err)
+	}
+	return &char, nil
+}
+
+func characterKey(characterID int32) []byte {
+	return []byte(strconv.Itoa(int(characterID)))
+}
+
+func loadKey(dbpath string) ([]byte, error) {
+	if env := os.Getenv(KeyEnv); env != "" {
+		key, err := base64.StdEncoding.DecodeString(env)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %v", KeyEnv, err)
+		}
+		return key, nil
+	}
+
+	path, err := KeyPath(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	// Move a key from before KeyPath out of the data directory, or make a new one.
+	legacy := filepath.Join(dbpath, keyFile)
+	key, err = os.ReadFile(legacy)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", legacy, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create directory %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := os.Remove(legacy); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error removing %s: %v", legacy, err)
+	}
+	return key, nil
+}
+
+func db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "evesso_peb_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
@@ -0,0 +1,131 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// csvDateLayouts are the date formats ReadCSV accepts, the last one is the game's own wallet export.
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006.01.02 15:04"}
+
+// ReadCSV reads wallet transactions from a CSV file with a header row naming the columns after ESI's fields.
+// date, type_id, quantity, unit_price and is_buy are required, is_buy being true/false or buy/sell.
+// transaction_id, location_id and client_id are optional. Rows without a transaction_id get a negative ID
+// hashed from the row and how many identical rows came before it, so importing the same file twice doesn't
+// count its rows twice while two identical fills in the same minute stay two transactions.
+func ReadCSV(r io.Reader) ([]*evesdk.WalletTransaction, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv header: %v", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "type_id", "quantity", "unit_price", "is_buy"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("csv is missing the %s column", name)
+		}
+	}
+
+	txs := []*evesdk.WalletTransaction{}
+	seen := map[string]int{}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return txs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading csv: %v", err)
+		}
+		joined := strings.Join(row, "\x00")
+		repeat := seen[joined]
+		seen[joined]++
+		t, err := parseRow(cols, row, repeat)
+		if err != nil {
+			return nil, fmt.Errorf("error on csv line %d: %v", line, err)
+		}
+		txs = append(txs, t)
+	}
+}
+
+// parseRow parses a row, repeat being how many identical rows came before it.
+func parseRow(cols map[string]int, row []string, repeat int) (*evesdk.WalletTransaction, error) {
+	field := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var err error
+	t := &evesdk.WalletTransaction{}
+
+	if t.Date, err = parseDate(field("date")); err != nil {
+		return nil, err
+	}
+	typeID, err := strconv.ParseInt(field("type_id"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad type_id: %v", err)
+	}
+	t.TypeID = int32(typeID)
+	quantity, err := strconv.ParseInt(strings.ReplaceAll(field("quantity"), ",", ""), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad quantity: %v", err)
+	}
+	t.Quantity = int32(quantity)
+	if t.UnitPrice, err = strconv.ParseFloat(strings.ReplaceAll(field("unit_price"), ",", ""), 64); err != nil {
+		return nil, fmt.Errorf("bad unit_price: %v", err)
+	}
+	switch strings.ToLower(field("is_buy")) {
+	case "buy":
+		t.IsBuy = true
+	case "sell":
+	default:
+		if t.IsBuy, err = strconv.ParseBool(field("is_buy")); err != nil {
+			return nil, fmt.Errorf("bad is_buy: %v", err)
+		}
+	}
+	if v := field("location_id"); v != "" {
+		if t.LocationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("bad location_id: %v", err)
+		}
+	}
+	if v := field("client_id"); v != "" {
+		clientID, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad client_id: %v", err)
+		}
+		t.ClientID = int32(clientID)
+	}
+	if v := field("transaction_id"); v != "" {
+		if t.TransactionID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("bad transaction_id: %v", err)
+		}
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(row, "\x00")))
+		// The first of identical rows hashes as it always has, so files imported before keep their IDs.
+		if repeat > 0 {
+			fmt.Fprintf(h, "\x00#%d", repeat)
+		}
+		t.TransactionID = -int64(h.Sum64() >> 1)
+	}
+	return t, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range csvDateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"time"
+)
+
+// Fees is the fee model applied to transactions, as fractions of the transaction value.
+type Fees struct {
+	// SalesTax is paid on every sale.
+	SalesTax float64
+	// BrokerFee is paid on both sides for orders placed on the market. Transactions don't say whether they
+	// filled an order the character placed or one somebody else did, so it is charged on every transaction,
+	// set it to 0 when trading by taking orders directly.
+	BrokerFee float64
+}
+
+// DefaultFees is Accounting and Broker Relations trained to 5 at an NPC station with no standings.
+var DefaultFees = Fees{SalesTax: 0.036, BrokerFee: 0.015}
+
+// Trade is a quantity sold matched to the purchase it came from. A sale spanning several purchases makes one
+// Trade per purchase.
+type Trade struct {
+	CharacterID    int32
+	TypeID         int32
+	Quantity       int64
+	BuyLocationID  int64
+	SellLocationID int64
+	Bought         time.Time
+	Sold           time.Time
+	// Cost is what was paid for the quantity, Revenue what it sold for, both before fees.
+	Cost    float64
+	Revenue float64
+	Fees    float64
+}
+
+// Profit is the realized profit after fees.
+func (t *Trade) Profit() float64 {
+	return t.Revenue - t.Cost - t.Fees
+}
+
+// Lot is a purchase, or what is left of it after sales.
+type Lot struct {
+	CharacterID int32
+	TypeID      int32
+	LocationID  int64
+	Bought      time.Time
+	Quantity    int64
+	UnitPrice   float64
+}
+
+// Result is the outcome of matching transactions.
+type Result struct {
+	Trades []*Trade
+	// Open are the lots not sold yet, oldest first per type.
+	Open []*Lot
+	// Unmatched are sales with no purchase recorded before them, e.g. of items bought before the first import.
+	// Lot.Bought is the sale date and UnitPrice the sale price.
+	Unmatched []*Lot
+}
+
+// Match matches each sale with the earliest unsold purchases of the same type, per character, and applies the
+// fees. txs must be sorted oldest first, as Ledger.Transactions returns them.
+func Match(txs []*Transaction, fees Fees) *Result {
+	type key struct {
+		characterID int32
+		typeID      int32
+	}
+	lots := map[key][]*Lot{}
+	var order []key
+	res := &Result{}
+
+	for _, t := range txs {
+		k := key{t.CharacterID, t.TypeID}
+		if _, ok := lots[k]; !ok {
+			lots[k] = nil
+			order = append(order, k)
+		}
+		if t.IsBuy {
+			lots[k] = append(lots[k], &Lot{
+				CharacterID: t.CharacterID,
+				TypeID:      t.TypeID,
+				LocationID:  t.LocationID,
+				Bought:      t.Date,
+				Quantity:    int64(t.Quantity),
+				UnitPrice:   t.UnitPrice,
+			})
+			continue
+		}
+
+		remaining := int64(t.Quantity)
+		for remaining > 0 && len(lots[k]) > 0 {
+			lot := lots[k][0]
+			n := lot.Quantity
+			if remaining < n {
+				n = remaining
+			}
+			cost := float64(n) * lot.UnitPrice
+			revenue := float64(n) * t.UnitPrice
+			res.Trades = append(res.Trades, &Trade{
+				CharacterID:    t.CharacterID,
+				TypeID:         t.TypeID,
+				Quantity:       n,
+				BuyLocationID:  lot.LocationID,
+				SellLocationID: t.LocationID,
+				Bought:         lot.Bought,
+				Sold:           t.Date,
+				Cost:           cost,
+				Revenue:        revenue,
+				Fees:           cost*fees.BrokerFee + revenue*(fees.BrokerFee+fees.SalesTax),
+			})
+			lot.Quantity -= n
+			remaining -= n
+			if lot.Quantity == 0 {
+				lots[k] = lots[k][1:]
+			}
+		}
+		if remaining > 0 {
+			res.Unmatched = append(res.Unmatched, &Lot{
+				CharacterID: t.CharacterID,
+				TypeID:      t.TypeID,
+				LocationID:  t.LocationID,
+				Bought:      t.Date,
+				Quantity:    remaining,
+				UnitPrice:   t.UnitPrice,
+			})
+		}
+	}
+
+	for _, k := range order {
+		res.Open = append(res.Open, lots[k]...)
+	}
+	return res
+}
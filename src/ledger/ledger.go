@@ -0,0 +1,156 @@
+// Package ledger keeps a character's wallet transactions and works out the realized profit of trading, matching
+// sales to earlier purchases of the same type first in, first out.
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// Transaction is a wallet transaction and the character it belongs to. Transactions imported from a CSV file
+// without IDs get negative ones, see ReadCSV.
+type Transaction struct {
+	CharacterID int32 `json:"character_id"`
+	evesdk.WalletTransaction
+}
+
+// Ledger stores wallet transactions in pebble, keyed by character and transaction ID so importing the same
+// transactions again doesn't count them twice.
+type Ledger struct {
+	pdb *pebble.DB
+}
+
+func New(dbpath string) (*Ledger, error) {
+	pebDbPath, err := db_location(dbpath)
+	if err != nil {
+		return nil, fmt.Errorf("error prepping db location: %v", err)
+	}
+
+	pdb, err := pebble.Open(pebDbPath, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening: %v", err)
+	}
+
+	return &Ledger{pdb: pdb}, nil
+}
+
+func (l *Ledger) Close() error {
+	err := l.pdb.Close()
+	if err != nil {
+		return fmt.Errorf("error closing: %v", err)
+	}
+	return nil
+}
+
+// Add stores the character's transactions, returning how many were new.
+func (l *Ledger) Add(ctx context.Context, characterID int32, txs []*evesdk.WalletTransaction) (int, error) {
+	batch := l.pdb.NewBatch()
+	defer batch.Close()
+
+	added := 0
+	// The batch isn't visible to Get, so repeats within txs are caught here.
+	staged := map[int64]struct{}{}
+	for _, t := range txs {
+		if _, ok := staged[t.TransactionID]; ok {
+			continue
+		}
+		staged[t.TransactionID] = struct{}{}
+		key := transactionKey(characterID, t.TransactionID)
+		_, closer, err := l.pdb.Get(key)
+		if err == nil {
+			closer.Close()
+			continue
+		} else if err != pebble.ErrNotFound {
+			return 0, fmt.Errorf("error reading transaction %d: %v", t.TransactionID, err)
+		}
+		data, err := json.Marshal(&Transaction{CharacterID: characterID, WalletTransaction: *t})
+		if err != nil {
+			return 0, fmt.Errorf("error marshalling transaction: %v", err)
+		}
+		if err := batch.Set(key, data, nil); err != nil {
+			return 0, fmt.Errorf("error writing to batch: %v", err)
+		}
+		added++
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return 0, fmt.Errorf("error writing to db: %v", err)
+	}
+	return added, nil
+}
+
+// Transactions returns the character's transactions, or every character's for a zero characterID, oldest
+// first.
+func (l *Ledger) Transactions(ctx context.Context, characterID int32) ([]*Transaction, error) {
+	opts := &pebble.IterOptions{}
+	if characterID != 0 {
+		prefix := []byte(strconv.Itoa(int(characterID)) + ":")
+		opts.LowerBound = prefix
+		opts.UpperBound = append(prefix[:len(prefix)-1:len(prefix)-1], ':'+1)
+	}
+	iter := l.pdb.NewIter(opts)
+	defer iter.Close()
+
+	txs := []*Transaction{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var t Transaction
+		if err := json.Unmarshal(iter.Value(), &t); err != nil {
+			return nil, fmt.Errorf("error unmarshalling transaction: %v", err)
+		}
+		txs = append(txs, &t)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("error iterating over transactions: %v", err)
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		if !txs[i].Date.Equal(txs[j].Date) {
+			return txs[i].Date.Before(txs[j].Date)
+		}
+		return txs[i].TransactionID < txs[j].TransactionID
+	})
+	return txs, nil
+}
+
+// LastTransactionID returns the newest ESI transaction ID stored for the character, 0 if there are none.
+func (l *Ledger) LastTransactionID(ctx context.Context, characterID int32) (int64, error) {
+	txs, err := l.Transactions(ctx, characterID)
+	if err != nil {
+		return 0, err
+	}
+	var last int64
+	for _, t := range txs {
+		if t.TransactionID > last {
+			last = t.TransactionID
+		}
+	}
+	return last, nil
+}
+
+func transactionKey(characterID int32, transactionID int64) []byte {
+	return []byte(strconv.Itoa(int(characterID)) + ":" + strconv.FormatInt(transactionID, 10))
+}
+
+func db_location(baseDir string) (string, error) {
+	dbpath := filepath.Join(baseDir, "ledger_peb_db")
+
+	_, err := os.Stat(dbpath)
+	if os.IsNotExist(err) {
+		err := os.Mkdir(dbpath, 0700)
+		if err != nil {
+			return "", fmt.Errorf("could not create directory %s: %w", dbpath, err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("could not stat directory %s: %w", dbpath, err)
+	}
+
+	return dbpath, nil
+}
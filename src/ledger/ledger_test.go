@@ -0,0 +1,162 @@
+package ledger
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jita, amarr = 60003760, 60008494
+
+func tx(id int64, day int, typeID int32, quantity int32, price float64, buy bool, location int64) *evesdk.WalletTransaction {
+	return &evesdk.WalletTransaction{
+		TransactionID: id,
+		Date:          time.Date(2023, 3, day, 12, 0, 0, 0, time.UTC),
+		TypeID:        typeID,
+		LocationID:    location,
+		Quantity:      quantity,
+		UnitPrice:     price,
+		IsBuy:         buy,
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	l, err := New(t.TempDir())
+	require.NoError(t, err)
+	defer l.Close()
+
+	added, err := l.Add(ctx, 90000001, []*evesdk.WalletTransaction{tx(2, 2, 34, 10, 6, false, jita), tx(1, 1, 34, 10, 5, true, jita)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = l.Add(ctx, 90000001, []*evesdk.WalletTransaction{tx(2, 2, 34, 10, 6, false, jita), tx(3, 3, 34, 5, 5, true, jita)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added, "transactions already stored are skipped")
+	_, err = l.Add(ctx, 90000002, []*evesdk.WalletTransaction{tx(9, 1, 35, 1, 1, true, jita)})
+	require.NoError(t, err)
+
+	txs, err := l.Transactions(ctx, 90000001)
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+	assert.Equal(t, int64(1), txs[0].TransactionID, "oldest first")
+	assert.Equal(t, int32(90000001), txs[0].CharacterID)
+	all, err := l.Transactions(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	last, err := l.LastTransactionID(ctx, 90000001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), last)
+}
+
+func TestMatch(t *testing.T) {
+	var txs []*Transaction
+	for _, w := range []*evesdk.WalletTransaction{
+		tx(1, 1, 34, 10, 5, true, jita),
+		tx(2, 2, 34, 10, 6, true, jita),
+		tx(3, 3, 34, 15, 8, false, amarr), // all of the first purchase and half the second
+		tx(4, 4, 35, 3, 100, false, jita), // never bought
+	} {
+		txs = append(txs, &Transaction{CharacterID: 90000001, WalletTransaction: *w})
+	}
+
+	res := Match(txs, Fees{SalesTax: 0.05, BrokerFee: 0.01})
+	require.Len(t, res.Trades, 2)
+	first := res.Trades[0]
+	assert.Equal(t, int64(10), first.Quantity)
+	assert.Equal(t, 50.0, first.Cost)
+	assert.Equal(t, 80.0, first.Revenue)
+	assert.InDelta(t, 0.5+4.8, first.Fees, 1e-9)
+	assert.InDelta(t, 24.7, first.Profit(), 1e-9)
+	assert.Equal(t, int64(amarr), first.SellLocationID)
+	assert.Equal(t, int64(5), res.Trades[1].Quantity)
+	assert.Equal(t, 30.0, res.Trades[1].Cost)
+
+	require.Len(t, res.Open, 1)
+	assert.Equal(t, int64(5), res.Open[0].Quantity)
+	assert.Equal(t, 6.0, res.Open[0].UnitPrice)
+	require.Len(t, res.Unmatched, 1)
+	assert.Equal(t, int32(35), res.Unmatched[0].TypeID)
+
+	byItem, err := Summarize(res.Trades, ByItem)
+	require.NoError(t, err)
+	require.Len(t, byItem, 1)
+	assert.Equal(t, int64(15), byItem[0].Quantity)
+	assert.Equal(t, 2, byItem[0].Trades)
+
+	byRoute, err := Summarize(res.Trades, ByRoute)
+	require.NoError(t, err)
+	require.Len(t, byRoute, 1)
+	assert.Equal(t, int64(jita), byRoute[0].BuyLocationID)
+
+	// 2023-03-03 was a Friday.
+	byWeek, err := Summarize(res.Trades, ByWeek)
+	require.NoError(t, err)
+	require.Len(t, byWeek, 1)
+	assert.Equal(t, time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC), byWeek[0].Period)
+
+	_, err = Summarize(res.Trades, "year")
+	assert.Error(t, err)
+}
+
+func TestReadCSV(t *testing.T) {
+	body := `date,type_id,quantity,unit_price,is_buy,location_id
+2023-03-01 12:00:00,34,"1,000",5.5,buy,60003760
+2023.03.02 13:30,34,500,"6,000.25",sell,
+`
+	txs, err := ReadCSV(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.True(t, txs[0].IsBuy)
+	assert.Equal(t, int32(1000), txs[0].Quantity)
+	assert.Equal(t, int64(60003760), txs[0].LocationID)
+	assert.Equal(t, 6000.25, txs[1].UnitPrice)
+	assert.Equal(t, time.Date(2023, 3, 2, 13, 30, 0, 0, time.UTC), txs[1].Date)
+	assert.Less(t, txs[0].TransactionID, int64(0))
+
+	again, err := ReadCSV(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, txs[0].TransactionID, again[0].TransactionID, "the same row gets the same ID")
+	assert.NotEqual(t, txs[0].TransactionID, txs[1].TransactionID)
+
+	_, err = ReadCSV(strings.NewReader("date,type_id\n"))
+	assert.Error(t, err)
+}
+
+func TestIdenticalCSVRows(t *testing.T) {
+	// The game's export only has minutes, two partial fills at the same price look the same.
+	body := `date,type_id,quantity,unit_price,is_buy
+2023.03.01 12:00,34,100,5,buy
+2023.03.01 12:00,34,100,5,buy
+`
+	txs, err := ReadCSV(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.NotEqual(t, txs[0].TransactionID, txs[1].TransactionID)
+
+	ctx := context.Background()
+	l, err := New(t.TempDir())
+	require.NoError(t, err)
+	defer l.Close()
+	added, err := l.Add(ctx, 90000001, txs)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	again, err := ReadCSV(strings.NewReader(body))
+	require.NoError(t, err)
+	added, err = l.Add(ctx, 90000001, again)
+	require.NoError(t, err)
+	assert.Equal(t, 0, added, "importing the file again adds nothing")
+
+	// The same ID twice in one call is stored once.
+	added, err = l.Add(ctx, 90000001, []*evesdk.WalletTransaction{tx(7, 2, 34, 10, 6, false, jita), tx(7, 2, 34, 10, 6, false, jita)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	stored, err := l.Transactions(ctx, 90000001)
+	require.NoError(t, err)
+	assert.Len(t, stored, 3)
+}
@@ -0,0 +1,95 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GroupBy is how Summarize groups trades.
+type GroupBy string
+
+const (
+	ByItem  GroupBy = "item"
+	ByRoute GroupBy = "route"
+	ByDay   GroupBy = "day"
+	ByWeek  GroupBy = "week"
+	ByMonth GroupBy = "month"
+)
+
+// Summary totals the trades in one group. Only the fields the grouping is by are set: TypeID for ByItem,
+// the locations for ByRoute and Period, the group's first day, for the periods.
+type Summary struct {
+	TypeID         int32
+	BuyLocationID  int64
+	SellLocationID int64
+	Period         time.Time
+
+	Trades   int
+	Quantity int64
+	Cost     float64
+	Revenue  float64
+	Fees     float64
+	Profit   float64
+}
+
+// Summarize groups trades, periods by the day they were sold on in UTC. Periods come oldest first, items and
+// routes most profitable first.
+func Summarize(trades []*Trade, by GroupBy) ([]*Summary, error) {
+	type key struct {
+		typeID     int32
+		buy, sell  int64
+		periodUnix int64
+	}
+	groups := map[key]*Summary{}
+	var out []*Summary
+	for _, t := range trades {
+		var k key
+		s := &Summary{}
+		switch by {
+		case ByItem:
+			k.typeID, s.TypeID = t.TypeID, t.TypeID
+		case ByRoute:
+			k.buy, k.sell = t.BuyLocationID, t.SellLocationID
+			s.BuyLocationID, s.SellLocationID = t.BuyLocationID, t.SellLocationID
+		case ByDay, ByWeek, ByMonth:
+			s.Period = periodStart(t.Sold, by)
+			k.periodUnix = s.Period.Unix()
+		default:
+			return nil, fmt.Errorf("unknown grouping %q, use item, route, day, week or month", by)
+		}
+		if g, ok := groups[k]; ok {
+			s = g
+		} else {
+			groups[k] = s
+			out = append(out, s)
+		}
+		s.Trades++
+		s.Quantity += t.Quantity
+		s.Cost += t.Cost
+		s.Revenue += t.Revenue
+		s.Fees += t.Fees
+		s.Profit += t.Profit()
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if by == ByItem || by == ByRoute {
+			return out[i].Profit > out[j].Profit
+		}
+		return out[i].Period.Before(out[j].Period)
+	})
+	return out, nil
+}
+
+// periodStart returns the first day of the period d is in, weeks starting on Monday.
+func periodStart(d time.Time, by GroupBy) time.Time {
+	y, m, day := d.UTC().Date()
+	switch by {
+	case ByWeek:
+		start := time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+		return start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	case ByMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+}
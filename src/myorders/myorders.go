@@ -0,0 +1,155 @@
+// Package myorders checks a character's open market orders against the rest of the market, flagging the ones
+// that have been undercut or outbid and suggesting a price to get back on top.
+package myorders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// State is how an order stands against its competition.
+type State int
+
+const (
+	// Best means no competing order beats it.
+	Best State = iota
+	// Undercut means a competing sell order is cheaper.
+	Undercut
+	// Outbid means a competing buy order pays more.
+	Outbid
+	// Alone means there is no competing order at the location.
+	Alone
+)
+
+func (s State) String() string {
+	switch s {
+	case Best:
+		return "best"
+	case Undercut:
+		return "undercut"
+	case Outbid:
+		return "outbid"
+	case Alone:
+		return "alone"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Status is the result of checking one order.
+type Status struct {
+	Order *evesdk.CharacterOrder
+	State State
+	// Competitor is the best competing order, nil when the order is Alone.
+	Competitor *evesdk.MarketOrder
+	// Suggested is the price that beats Competitor by one tick, set for Undercut and Outbid orders.
+	Suggested float64
+}
+
+// LoadFile reads orders saved from ESI's /characters/{id}/orders/, a JSON array, e.g. with
+// `cache export --body`.
+func LoadFile(path string) ([]*evesdk.CharacterOrder, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	var orders []*evesdk.CharacterOrder
+	if err := json.Unmarshal(b, &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling orders from %s: %v", path, err)
+	}
+	return orders, nil
+}
+
+// Check compares each order with the best competing order for the same type and side at the same location
+// in store, which should hold the order's region, and its structure if it is in one. Buy orders are only
+// compared within their station, the ranges of competing buy orders aren't taken into account. The
+// character's own orders never count as competition.
+func Check(ctx context.Context, store dbmarketorders.Querier, orders []*evesdk.CharacterOrder) ([]*Status, error) {
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	own := map[int64]bool{}
+	typeIDs := []int32{}
+	seen := map[int32]bool{}
+	for _, o := range orders {
+		own[o.OrderID] = true
+		if !seen[o.TypeID] {
+			seen[o.TypeID] = true
+			typeIDs = append(typeIDs, o.TypeID)
+		}
+	}
+	market, err := store.Query(ctx, dbmarketorders.Query{TypeIDs: typeIDs})
+	if err != nil {
+		return nil, fmt.Errorf("error querying market orders: %v", err)
+	}
+
+	type key struct {
+		typeID     int32
+		locationID int64
+		buy        bool
+	}
+	best := map[key]*evesdk.MarketOrder{}
+	for _, m := range market {
+		if own[m.OrderID] {
+			continue
+		}
+		k := key{m.TypeID, m.LocationID, m.IsBuyOrder}
+		cur, ok := best[k]
+		if !ok || (m.IsBuyOrder && m.Price > cur.Price) || (!m.IsBuyOrder && m.Price < cur.Price) {
+			best[k] = m
+		}
+	}
+
+	statuses := make([]*Status, 0, len(orders))
+	for _, o := range orders {
+		s := &Status{Order: o, State: Alone}
+		if c, ok := best[key{o.TypeID, o.LocationID, o.IsBuyOrder}]; ok {
+			s.Competitor = c
+			s.State = Best
+			switch {
+			case o.IsBuyOrder && c.Price > o.Price:
+				s.State = Outbid
+				s.Suggested = TickAbove(c.Price)
+			case !o.IsBuyOrder && c.Price < o.Price:
+				s.State = Undercut
+				s.Suggested = TickBelow(c.Price)
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Prices can only be set to four significant digits, so the smallest step depends on the magnitude of the
+// price: 0.01 up to 10 ISK, 1 ISK from 1,000 to 9,999, 1,000 ISK from 1,000,000 and so on.
+func priceStep(price float64) float64 {
+	step := math.Pow(10, math.Floor(math.Log10(price))-3)
+	return math.Max(step, 0.01)
+}
+
+// TickBelow returns the highest valid price below price.
+func TickBelow(price float64) float64 {
+	step := priceStep(price)
+	below := math.Ceil(price/step-1e-9)*step - step
+	// Going below a power of ten the steps get finer, 1,000 goes to 999.9 rather than 999.
+	if below > 0 && priceStep(below) < step {
+		step = priceStep(below)
+		below = math.Ceil(price/step-1e-9)*step - step
+	}
+	return roundISK(below)
+}
+
+// TickAbove returns the lowest valid price above price.
+func TickAbove(price float64) float64 {
+	step := priceStep(price)
+	return roundISK(math.Floor(price/step+1e-9)*step + step)
+}
+
+func roundISK(price float64) float64 {
+	return math.Round(price*100) / 100
+}
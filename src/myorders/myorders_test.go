@@ -0,0 +1,101 @@
+package myorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type market []*evesdk.MarketOrder
+
+func (m market) Query(ctx context.Context, q dbmarketorders.Query) ([]*evesdk.MarketOrder, error) {
+	var out []*evesdk.MarketOrder
+	for _, o := range m {
+		if q.Matches(o) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func TestTicks(t *testing.T) {
+	assert.Equal(t, 4.99, TickBelow(5))
+	assert.Equal(t, 5.01, TickAbove(5))
+	assert.Equal(t, 1234.0, TickBelow(1235))
+	assert.Equal(t, 999.9, TickBelow(1000))
+	assert.Equal(t, 1001.0, TickAbove(1000))
+	assert.Equal(t, 1000.0, TickAbove(999.9))
+	assert.Equal(t, 12340000.0, TickBelow(12350000))
+	// Older orders can have more digits than are allowed now.
+	assert.Equal(t, 12340000.0, TickBelow(12345678.9))
+	assert.Equal(t, 12350000.0, TickAbove(12345678.9))
+	assert.Equal(t, 0.01, TickAbove(0))
+}
+
+func TestCheck(t *testing.T) {
+	const jita, amarr = 60003760, 60008494
+	m := market{
+		{OrderID: 1, TypeID: 34, LocationID: jita, Price: 5.10},
+		{OrderID: 2, TypeID: 34, LocationID: jita, Price: 5.05},
+		{OrderID: 3, TypeID: 34, LocationID: jita, Price: 4.50, IsBuyOrder: true},
+		{OrderID: 4, TypeID: 35, LocationID: jita, Price: 12.00},
+		{OrderID: 5, TypeID: 34, LocationID: amarr, Price: 4.00},
+		// The character's own orders are in the market too.
+		{OrderID: 100, TypeID: 34, LocationID: jita, Price: 5.20},
+		{OrderID: 101, TypeID: 34, LocationID: jita, Price: 4.40, IsBuyOrder: true},
+		{OrderID: 102, TypeID: 35, LocationID: jita, Price: 11.00},
+		{OrderID: 104, TypeID: 34, LocationID: jita, Price: 4.60, IsBuyOrder: true},
+	}
+	mine := []*evesdk.CharacterOrder{
+		{OrderID: 100, TypeID: 34, LocationID: jita, Price: 5.20},
+		{OrderID: 101, TypeID: 34, LocationID: jita, Price: 4.40, IsBuyOrder: true},
+		{OrderID: 102, TypeID: 35, LocationID: jita, Price: 11.00},
+		{OrderID: 103, TypeID: 36, LocationID: jita, Price: 50.00},
+		// Beating order 3, and not outbid by the character's own order 101.
+		{OrderID: 104, TypeID: 34, LocationID: jita, Price: 4.60, IsBuyOrder: true},
+	}
+
+	statuses, err := Check(context.Background(), m, mine)
+	require.NoError(t, err)
+	require.Len(t, statuses, 5)
+
+	assert.Equal(t, Undercut, statuses[0].State)
+	assert.Equal(t, int64(2), statuses[0].Competitor.OrderID, "amarr is cheaper but somewhere else")
+	assert.Equal(t, 5.04, statuses[0].Suggested)
+
+	assert.Equal(t, Outbid, statuses[1].State)
+	assert.Equal(t, 4.51, statuses[1].Suggested)
+
+	assert.Equal(t, Best, statuses[2].State)
+	assert.Equal(t, int64(4), statuses[2].Competitor.OrderID)
+	assert.Zero(t, statuses[2].Suggested)
+
+	assert.Equal(t, Alone, statuses[3].State)
+	assert.Nil(t, statuses[3].Competitor)
+
+	assert.Equal(t, Best, statuses[4].State)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	// As ESI sends it, which leaves out false booleans.
+	body := `[{"duration":90,"issued":"2023-03-01T12:00:00Z","location_id":60003760,"order_id":100,"price":5.2,
+		"range":"station","region_id":10000002,"type_id":34,"volume_remain":10,"volume_total":10,"is_corporation":false},
+		{"duration":90,"escrow":440,"is_buy_order":true,"issued":"2023-03-01T12:00:00Z","location_id":60003760,
+		"min_volume":1,"order_id":101,"price":4.4,"range":"region","region_id":10000002,"type_id":34,
+		"volume_remain":100,"volume_total":100,"is_corporation":false}]`
+	require.NoError(t, os.WriteFile(path, []byte(body), 0644))
+
+	orders, err := LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.False(t, orders[0].IsBuyOrder)
+	assert.True(t, orders[1].IsBuyOrder)
+	assert.Equal(t, 440.0, orders[1].Escrow)
+}
@@ -0,0 +1,237 @@
+// Package networth values a character's assets at the prices of a trade hub.
+package networth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdk"
+)
+
+// Hub is a trade hub station, assets are valued at the orders in its station and the history of its region.
+type Hub struct {
+	Name      string
+	RegionID  int32
+	SystemID  int32
+	StationID int64
+}
+
+// Hubs are the main trade hubs by lower case system name.
+var Hubs = map[string]Hub{
+	"jita":    {Name: "Jita IV - Moon 4 - Caldari Navy Assembly Plant", RegionID: 10000002, SystemID: 30000142, StationID: 60003760},
+	"amarr":   {Name: "Amarr VIII (Oris) - Emperor Family Academy", RegionID: 10000043, SystemID: 30002187, StationID: 60008494},
+	"dodixie": {Name: "Dodixie IX - Moon 20 - Federation Navy Assembly Plant", RegionID: 10000032, SystemID: 30002659, StationID: 60011866},
+	"rens":    {Name: "Rens VI - Moon 8 - Brutor Tribe Treasury", RegionID: 10000030, SystemID: 30002510, StationID: 60004588},
+	"hek":     {Name: "Hek VIII - Moon 12 - Boundless Creation Factory", RegionID: 10000042, SystemID: 30002053, StationID: 60005686},
+}
+
+// Basis is which price an item is valued at.
+type Basis string
+
+const (
+	// BestBuy is the highest buy order, what the items sell for right now.
+	BestBuy Basis = "buy"
+	// BestSell is the lowest sell order, what they cost to buy right now.
+	BestSell Basis = "sell"
+	// Mid is halfway between the best buy and the best sell order.
+	Mid Basis = "mid"
+	// HistoryAverage is the volume weighted average of the region's daily history.
+	HistoryAverage Basis = "history"
+)
+
+// HistorySource is the market history to value at, dbmarkethistory.HistoryDataDB satisfies it.
+type HistorySource interface {
+	AveragePrice(ctx context.Context, regionID, typeID int32, to time.Time, n int) (float64, bool, error)
+}
+
+// Pricer prices types at a hub.
+type Pricer struct {
+	Orders dbmarketorders.Querier
+	// History is only needed for HistoryAverage.
+	History HistorySource
+	Hub     Hub
+	Basis   Basis
+	// Days is how many days of history HistoryAverage averages, up to now.
+	Days int
+}
+
+// Prices returns the price of each type, leaving out types without one, e.g. with no orders in the hub station.
+func (p *Pricer) Prices(ctx context.Context, typeIDs []int32) (map[int32]float64, error) {
+	prices := map[int32]float64{}
+	if len(typeIDs) == 0 {
+		return prices, nil
+	}
+
+	switch p.Basis {
+	case HistoryAverage:
+		if p.History == nil {
+			return nil, fmt.Errorf("pricing at the history average needs market history")
+		}
+		now := time.Now().UTC()
+		for _, typeID := range typeIDs {
+			avg, ok, err := p.History.AveragePrice(ctx, p.Hub.RegionID, typeID, now, p.Days)
+			if err != nil {
+				return nil, fmt.Errorf("error reading history of %d: %v", typeID, err)
+			}
+			if ok {
+				prices[typeID] = avg
+			}
+		}
+		return prices, nil
+	case BestBuy, BestSell, Mid:
+	default:
+		return nil, fmt.Errorf("unknown price basis %q, use buy, sell, mid or history", p.Basis)
+	}
+
+	orders, err := p.Orders.Query(ctx, dbmarketorders.Query{SystemIDs: []int32{p.Hub.SystemID}, TypeIDs: typeIDs})
+	if err != nil {
+		return nil, fmt.Errorf("error querying market orders: %v", err)
+	}
+	buy, sell := map[int32]float64{}, map[int32]float64{}
+	for _, o := range orders {
+		if o.LocationID != p.Hub.StationID {
+			continue
+		}
+		if o.IsBuyOrder {
+			if cur, ok := buy[o.TypeID]; !ok || o.Price > cur {
+				buy[o.TypeID] = o.Price
+			}
+		} else if cur, ok := sell[o.TypeID]; !ok || o.Price < cur {
+			sell[o.TypeID] = o.Price
+		}
+	}
+	for _, typeID := range typeIDs {
+		b, hasBuy := buy[typeID]
+		s, hasSell := sell[typeID]
+		switch {
+		case p.Basis == BestBuy && hasBuy:
+			prices[typeID] = b
+		case p.Basis == BestSell && hasSell:
+			prices[typeID] = s
+		case p.Basis == Mid && hasBuy && hasSell:
+			prices[typeID] = (b + s) / 2
+		}
+	}
+	return prices, nil
+}
+
+// Location is the value of the assets at one station, structure or in space, including everything inside
+// containers and ships there.
+type Location struct {
+	LocationID   int64
+	LocationType string
+	Stacks       int
+	Value        float64
+	// Unpriced is how many stacks had no price, they count as worth nothing.
+	Unpriced int
+}
+
+// Valuation is the value of a set of assets.
+type Valuation struct {
+	Total float64
+	// Locations are most valuable first.
+	Locations []*Location
+	// Unpriced are the types without a price.
+	Unpriced []int32
+}
+
+// TypeIDs returns the distinct types of the assets.
+func TypeIDs(assets []*evesdk.Asset) []int32 {
+	seen := map[int32]bool{}
+	typeIDs := []int32{}
+	for _, a := range assets {
+		if !seen[a.TypeID] {
+			seen[a.TypeID] = true
+			typeIDs = append(typeIDs, a.TypeID)
+		}
+	}
+	return typeIDs
+}
+
+// Value values each asset stack at prices and totals them by the location they are ultimately in. Blueprint
+// copies can't be sold on the market and are worth nothing, their type is the original's.
+func Value(assets []*evesdk.Asset, prices map[int32]float64) *Valuation {
+	items := make(map[int64]*evesdk.Asset, len(assets))
+	for _, a := range assets {
+		items[a.ItemID] = a
+	}
+	// root walks up from containers and ships to the asset they are in, guarding against a corrupt file
+	// with a loop in it.
+	root := func(a *evesdk.Asset) *evesdk.Asset {
+		for i := 0; i < len(assets); i++ {
+			parent, ok := items[a.LocationID]
+			if !ok {
+				break
+			}
+			a = parent
+		}
+		return a
+	}
+
+	v := &Valuation{}
+	locations := map[int64]*Location{}
+	unpriced := map[int32]bool{}
+	for _, a := range assets {
+		r := root(a)
+		loc, ok := locations[r.LocationID]
+		if !ok {
+			loc = &Location{LocationID: r.LocationID, LocationType: r.LocationType}
+			locations[r.LocationID] = loc
+			v.Locations = append(v.Locations, loc)
+		}
+		loc.Stacks++
+		if a.IsBlueprintCopy {
+			continue
+		}
+		price, ok := prices[a.TypeID]
+		if !ok {
+			loc.Unpriced++
+			if !unpriced[a.TypeID] {
+				unpriced[a.TypeID] = true
+				v.Unpriced = append(v.Unpriced, a.TypeID)
+			}
+			continue
+		}
+		quantity := int64(a.Quantity)
+		if quantity < 1 {
+			quantity = 1
+		}
+		value := price * float64(quantity)
+		loc.Value += value
+		v.Total += value
+	}
+
+	sort.SliceStable(v.Locations, func(i, j int) bool { return v.Locations[i].Value > v.Locations[j].Value })
+	sort.Slice(v.Unpriced, func(i, j int) bool { return v.Unpriced[i] < v.Unpriced[j] })
+	return v
+}
+
+// LoadFile reads assets saved from ESI's /characters/{id}/assets/, a JSON array. Several pages can be given
+// as one array.
+func LoadFile(path string) ([]*evesdk.Asset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	var assets []*evesdk.Asset
+	if err := json.Unmarshal(b, &assets); err != nil {
+		return nil, fmt.Errorf("error unmarshalling assets from %s: %v", path, err)
+	}
+	return assets, nil
+}
+
+// HubNames returns the names Hubs knows, sorted.
+func HubNames() string {
+	names := make([]string, 0, len(Hubs))
+	for name := range Hubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
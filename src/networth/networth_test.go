@@ -0,0 +1,95 @@
+package networth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/dbmarketorders"
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type market []*evesdk.MarketOrder
+
+func (m market) Query(ctx context.Context, q dbmarketorders.Query) ([]*evesdk.MarketOrder, error) {
+	var out []*evesdk.MarketOrder
+	for _, o := range m {
+		if q.Matches(o) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+type history map[int32]float64
+
+func (h history) AveragePrice(ctx context.Context, regionID, typeID int32, to time.Time, n int) (float64, bool, error) {
+	avg, ok := h[typeID]
+	return avg, ok, nil
+}
+
+func TestPrices(t *testing.T) {
+	jita := Hubs["jita"]
+	m := market{
+		{TypeID: 34, SystemID: jita.SystemID, LocationID: jita.StationID, Price: 5, IsBuyOrder: true},
+		{TypeID: 34, SystemID: jita.SystemID, LocationID: jita.StationID, Price: 4, IsBuyOrder: true},
+		{TypeID: 34, SystemID: jita.SystemID, LocationID: jita.StationID, Price: 6},
+		{TypeID: 34, SystemID: jita.SystemID, LocationID: jita.StationID, Price: 7},
+		// Elsewhere in the system, not the hub station.
+		{TypeID: 34, SystemID: jita.SystemID, LocationID: 60003761, Price: 1},
+		{TypeID: 35, SystemID: jita.SystemID, LocationID: jita.StationID, Price: 10},
+	}
+	ctx := context.Background()
+
+	p := &Pricer{Orders: m, Hub: jita, Basis: BestBuy}
+	prices, err := p.Prices(ctx, []int32{34, 35, 36})
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]float64{34: 5}, prices)
+
+	p.Basis = BestSell
+	prices, err = p.Prices(ctx, []int32{34, 35})
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]float64{34: 6, 35: 10}, prices)
+
+	p.Basis = Mid
+	prices, err = p.Prices(ctx, []int32{34, 35})
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]float64{34: 5.5}, prices, "mid needs both sides")
+
+	p.Basis = HistoryAverage
+	_, err = p.Prices(ctx, []int32{34})
+	assert.Error(t, err, "no history")
+	p.History = history{35: 9.5}
+	prices, err = p.Prices(ctx, []int32{34, 35})
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]float64{35: 9.5}, prices)
+
+	p.Basis = "median"
+	_, err = p.Prices(ctx, []int32{34})
+	assert.Error(t, err)
+}
+
+func TestValue(t *testing.T) {
+	const jita, amarr = 60003760, 60008494
+	assets := []*evesdk.Asset{
+		{ItemID: 1, TypeID: 34, LocationID: jita, LocationType: "station", Quantity: 1000},
+		// A ship in Amarr with a container in its cargo, and minerals in the container.
+		{ItemID: 2, TypeID: 587, LocationID: amarr, LocationType: "station", Quantity: 1, IsSingleton: true},
+		{ItemID: 3, TypeID: 3467, LocationID: 2, LocationType: "item", Quantity: 1, IsSingleton: true},
+		{ItemID: 4, TypeID: 34, LocationID: 3, LocationType: "item", Quantity: 100},
+		{ItemID: 5, TypeID: 688, LocationID: jita, LocationType: "station", Quantity: 1, IsBlueprintCopy: true},
+	}
+	v := Value(assets, map[int32]float64{34: 5, 587: 400000, 688: 1e9})
+
+	assert.Equal(t, 5000+400000+500.0, v.Total)
+	require.Len(t, v.Locations, 2)
+	assert.Equal(t, int64(amarr), v.Locations[0].LocationID)
+	assert.Equal(t, 400500.0, v.Locations[0].Value)
+	assert.Equal(t, 3, v.Locations[0].Stacks)
+	assert.Equal(t, 1, v.Locations[0].Unpriced)
+	assert.Equal(t, "station", v.Locations[0].LocationType)
+	assert.Equal(t, 5000.0, v.Locations[1].Value, "blueprint copies are worth nothing")
+	assert.Equal(t, []int32{3467}, v.Unpriced)
+}
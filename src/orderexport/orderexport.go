@@ -0,0 +1,205 @@
+// Package orderexport writes market orders to CSV, JSON lines or Parquet files for analysis outside eveland.
+package orderexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	JSONL   Format = "jsonl"
+	Parquet Format = "parquet"
+)
+
+// Row is one exported market order with its type, system and station resolved to names.
+type Row struct {
+	OrderID      int64     `json:"order_id"`
+	TypeID       int32     `json:"type_id"`
+	TypeName     string    `json:"type_name"`
+	LocationID   int64     `json:"location_id"`
+	StationName  string    `json:"station_name"`
+	SystemID     int32     `json:"system_id"`
+	SystemName   string    `json:"system_name"`
+	VolumeTotal  int32     `json:"volume_total"`
+	VolumeRemain int32     `json:"volume_remain"`
+	MinVolume    int32     `json:"min_volume"`
+	Price        float64   `json:"price"`
+	IsBuyOrder   bool      `json:"is_buy_order"`
+	Issued       time.Time `json:"issued"`
+	Duration     int32     `json:"duration"`
+	Range        string    `json:"range"`
+	// IsStructureOrder marks orders in a player structure, StationName is empty for them.
+	IsStructureOrder bool `json:"is_structure_order"`
+}
+
+// NewRow copies an order into an export row, the name columns are left for the caller to fill in.
+func NewRow(order *evesdk.MarketOrder) *Row {
+	return &Row{
+		OrderID:      order.OrderID,
+		TypeID:       order.TypeID,
+		LocationID:   order.LocationID,
+		SystemID:     order.SystemID,
+		VolumeTotal:  order.VolumeTotal,
+		VolumeRemain: order.VolumeRemain,
+		MinVolume:    order.MinVolume,
+		Price:        order.Price,
+		IsBuyOrder:   order.IsBuyOrder,
+		Issued:       order.Issued,
+		Duration:     order.Duration,
+		Range:        order.Range_,
+
+		IsStructureOrder: order.IsStructureOrder,
+	}
+}
+
+// Writer streams rows to an output file.
+type Writer interface {
+	Write(row *Row) error
+	// Close flushes buffered rows. It doesn't close the underlying io.Writer.
+	Close() error
+}
+
+// NewWriter returns a Writer for the given format.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w)
+	case JSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case Parquet:
+		return newParquetWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown export format: %q", format)
+	}
+}
+
+var csvHeader = []string{
+	"order_id", "type_id", "type_name", "location_id", "station_name", "system_id", "system_name",
+	"volume_total", "volume_remain", "min_volume", "price", "is_buy_order", "issued", "duration", "range",
+	"is_structure_order",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	if err := c.w.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("error writing csv header: %v", err)
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(row *Row) error {
+	return c.w.Write([]string{
+		strconv.FormatInt(row.OrderID, 10),
+		strconv.Itoa(int(row.TypeID)),
+		row.TypeName,
+		strconv.FormatInt(row.LocationID, 10),
+		row.StationName,
+		strconv.Itoa(int(row.SystemID)),
+		row.SystemName,
+		strconv.Itoa(int(row.VolumeTotal)),
+		strconv.Itoa(int(row.VolumeRemain)),
+		strconv.Itoa(int(row.MinVolume)),
+		strconv.FormatFloat(row.Price, 'f', -1, 64),
+		strconv.FormatBool(row.IsBuyOrder),
+		row.Issued.UTC().Format(time.RFC3339),
+		strconv.Itoa(int(row.Duration)),
+		row.Range,
+		strconv.FormatBool(row.IsStructureOrder),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(row *Row) error {
+	return j.enc.Encode(row)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// parquetRow is the parquet schema for Row, parquet-go needs explicit physical and logical types.
+type parquetRow struct {
+	OrderID      int64   `parquet:"name=order_id, type=INT64"`
+	TypeID       int32   `parquet:"name=type_id, type=INT32"`
+	TypeName     string  `parquet:"name=type_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	LocationID   int64   `parquet:"name=location_id, type=INT64"`
+	StationName  string  `parquet:"name=station_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	SystemID     int32   `parquet:"name=system_id, type=INT32"`
+	SystemName   string  `parquet:"name=system_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	VolumeTotal  int32   `parquet:"name=volume_total, type=INT32"`
+	VolumeRemain int32   `parquet:"name=volume_remain, type=INT32"`
+	MinVolume    int32   `parquet:"name=min_volume, type=INT32"`
+	Price        float64 `parquet:"name=price, type=DOUBLE"`
+	IsBuyOrder   bool    `parquet:"name=is_buy_order, type=BOOLEAN"`
+	Issued       int64   `parquet:"name=issued, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Duration     int32   `parquet:"name=duration, type=INT32"`
+	Range        string  `parquet:"name=range, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+
+	IsStructureOrder bool `parquet:"name=is_structure_order, type=BOOLEAN"`
+}
+
+type parquetWriter struct {
+	w *writer.ParquetWriter
+}
+
+func newParquetWriter(w io.Writer) (*parquetWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+	if err != nil {
+		return nil, fmt.Errorf("error creating parquet writer: %v", err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetWriter{w: pw}, nil
+}
+
+func (p *parquetWriter) Write(row *Row) error {
+	return p.w.Write(parquetRow{
+		OrderID:      row.OrderID,
+		TypeID:       row.TypeID,
+		TypeName:     row.TypeName,
+		LocationID:   row.LocationID,
+		StationName:  row.StationName,
+		SystemID:     row.SystemID,
+		SystemName:   row.SystemName,
+		VolumeTotal:  row.VolumeTotal,
+		VolumeRemain: row.VolumeRemain,
+		MinVolume:    row.MinVolume,
+		Price:        row.Price,
+		IsBuyOrder:   row.IsBuyOrder,
+		Issued:       row.Issued.UnixMilli(),
+		Duration:     row.Duration,
+		Range:        row.Range,
+
+		IsStructureOrder: row.IsStructureOrder,
+	})
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.w.WriteStop(); err != nil {
+		return fmt.Errorf("error finishing parquet file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package orderexport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epsniff/eveland/src/evesdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriters(t *testing.T) {
+	order := &evesdk.MarketOrder{OrderID: 1, Price: 5.25, SystemID: 30000142, TypeID: 34, LocationID: 60003760,
+		VolumeRemain: 100, VolumeTotal: 100, Issued: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC), Duration: 90, Range_: "region"}
+	row := NewRow(order)
+	row.TypeName = "Tritanium"
+	row.SystemName = "Jita"
+	row.StationName = "Jita IV - Moon 4 - Caldari Navy Assembly Plant"
+
+	for _, format := range []Format{CSV, JSONL, Parquet} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(format, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, w.Write(row))
+			assert.NoError(t, w.Close())
+
+			switch format {
+			case CSV:
+				lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+				assert.Equal(t, 2, len(lines))
+				assert.Equal(t, "1,34,Tritanium,60003760,Jita IV - Moon 4 - Caldari Navy Assembly Plant,30000142,Jita,100,100,0,5.25,false,2023-03-01T12:00:00Z,90,region,false", lines[1])
+			case JSONL:
+				assert.Contains(t, buf.String(), `"type_name":"Tritanium"`)
+			case Parquet:
+				b := buf.Bytes()
+				assert.True(t, bytes.HasPrefix(b, []byte("PAR1")))
+				assert.True(t, bytes.HasSuffix(b, []byte("PAR1")))
+			}
+		})
+	}
+}